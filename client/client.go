@@ -0,0 +1,363 @@
+// Package client is a typed Go client for the subscriptions aggregator REST API (v1).
+//
+// Key behaviors:
+//   - One method per handler of handlers.SubscriptionHandler, using the models types
+//   - Every call takes a context for cancellation and deadlines
+//   - Retries with exponential backoff on 429 responses, and on 5xx responses and network
+//     errors for idempotent calls (never re-sends a create, import, renew or update the server may have processed)
+//   - Updates are conditional: they take the ETag of the version they change
+//   - Failed requests return *Error, matching the sentinels of internal/pkg/errors with errors.Is
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
+	"github.com/google/uuid"
+)
+
+// Types exchanged with the API
+type (
+	SubscriptionRequest = models.SubscriptionRequest
+	Subscription        = models.SubscriptionResponse
+	AdminSubscription   = models.AdminSubscriptionResponse
+	DeletedSubscription = models.DeletedSubscriptionResponse
+	SubscriptionPatch   = models.SubscriptionPatch
+	AuditEvent          = models.AuditEvent
+	AuditFilter         = models.AuditFilter
+	ImportMode          = models.ImportMode
+	ImportReport        = models.ImportReport
+	ImportRowResult     = models.ImportRowResult
+	ErrorResponse       = utils.ErrorResponse
+	Problem             = problem.Problem
+)
+
+// AdminKeyHeader is the header carrying the admin secret key
+const AdminKeyHeader = "secret-key"
+
+// Default retry settings
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+// Options configures a Client. Zero values select the defaults.
+type Options struct {
+	// HTTPClient sends the requests (http.DefaultClient by default)
+	HTTPClient *http.Client
+	// AdminKey is sent in the secret-key header, required by GetSubscriptions, PurgeSubscription
+	// and SearchAuditLog, and raising the row limit of ImportSubscriptions
+	AdminKey string
+
+	// MaxRetries is the number of retries after the first attempt; negative disables retries
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff between attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Client struct {
+	baseURL  *url.URL
+	http     *http.Client
+	adminKey string
+	retry    retryPolicy
+}
+
+// New returns a client for the API served at baseURL (including the public path prefix, if any)
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q: must be an absolute http(s) URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:  u,
+		http:     opts.HTTPClient,
+		adminKey: opts.AdminKey,
+		retry: retryPolicy{
+			maxRetries: opts.MaxRetries,
+			minBackoff: opts.MinBackoff,
+			maxBackoff: opts.MaxBackoff,
+		},
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.retry.maxRetries == 0 {
+		c.retry.maxRetries = DefaultMaxRetries
+	}
+	if c.retry.minBackoff <= 0 {
+		c.retry.minBackoff = DefaultMinBackoff
+	}
+	if c.retry.maxBackoff <= 0 {
+		c.retry.maxBackoff = DefaultMaxBackoff
+	}
+	return c, nil
+}
+
+// CreateSubscription creates a subscription and returns its ID
+func (c *Client) CreateSubscription(ctx context.Context, req SubscriptionRequest) (uint64, error) {
+	var resp struct {
+		ID uint64 `json:"id"`
+	}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/v1/subscriptions", body: req}, &resp)
+	return resp.ID, err
+}
+
+// GetSubscriptions returns every subscription, including deleted ones. Requires the admin key.
+func (c *Client) GetSubscriptions(ctx context.Context) ([]AdminSubscription, error) {
+	var subs []AdminSubscription
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/subscriptions", idempotent: true}, &subs)
+	return subs, err
+}
+
+// GetSubscriptionByID returns a subscription by ID
+func (c *Client) GetSubscriptionByID(ctx context.Context, id uint64) (Subscription, error) {
+	var sub Subscription
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10), idempotent: true}, &sub)
+	return sub, err
+}
+
+// GetSubscriptionWithETag returns a subscription by ID with the ETag of its version, for UpdateSubscription
+func (c *Client) GetSubscriptionWithETag(ctx context.Context, id uint64) (Subscription, string, error) {
+	var sub Subscription
+	var etag string
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10), idempotent: true, etag: &etag}, &sub)
+	return sub, etag, err
+}
+
+// UpdateSubscription applies patch to a subscription if it is still at the version of etag, and
+// returns it with the ETag of its new version. A stale etag returns ErrVersionMismatch.
+func (c *Client) UpdateSubscription(ctx context.Context, id uint64, etag string, patch SubscriptionPatch) (Subscription, string, error) {
+	var sub Subscription
+	var newETag string
+	err := c.do(ctx, call{
+		method: http.MethodPatch, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10), body: patch,
+		contentType: "application/merge-patch+json", header: http.Header{"If-Match": {etag}}, etag: &newETag,
+	}, &sub)
+	return sub, newETag, err
+}
+
+// GetSubscriptionByUserID returns the subscriptions of a user
+func (c *Client) GetSubscriptionByUserID(ctx context.Context, userID uuid.UUID) ([]Subscription, error) {
+	var subs []Subscription
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/subscriptions/user/" + userID.String(), idempotent: true}, &subs)
+	return subs, err
+}
+
+// RenewOrExtendSubscription renews or extends a subscription and returns the ID of the new one
+func (c *Client) RenewOrExtendSubscription(ctx context.Context, id uint64) (uint64, error) {
+	var resp struct {
+		NewID uint64 `json:"new_id"`
+	}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10)}, &resp)
+	return resp.NewID, err
+}
+
+// DeleteSubscription soft-deletes a subscription. Deleting an already deleted subscription
+// succeeds; an unknown ID returns ErrSubscriptionNotFound.
+func (c *Client) DeleteSubscription(ctx context.Context, id uint64) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10), idempotent: true}, nil)
+}
+
+// GetDeletedSubscriptionsByUserID returns the trash of a user: their soft-deleted subscriptions,
+// most recently deleted first
+func (c *Client) GetDeletedSubscriptionsByUserID(ctx context.Context, userID uuid.UUID) ([]DeletedSubscription, error) {
+	var subs []DeletedSubscription
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/subscriptions/user/" + userID.String() + "/trash", idempotent: true}, &subs)
+	return subs, err
+}
+
+// RestoreSubscription un-deletes a subscription. Restoring a subscription that is not deleted
+// succeeds; one overlapping a current subscription returns ErrAlreadyExists.
+func (c *Client) RestoreSubscription(ctx context.Context, id uint64) error {
+	return c.do(ctx, call{method: http.MethodPost, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10) + "/restore", idempotent: true}, nil)
+}
+
+// PurgeSubscription permanently removes a soft-deleted subscription; one that is not deleted
+// returns ErrNotDeleted. Requires the admin key.
+func (c *Client) PurgeSubscription(ctx context.Context, id uint64) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10) + "/purge", idempotent: true}, nil)
+}
+
+// GetSubscriptionHistory returns the audit log of a subscription, oldest first. It is kept after
+// the subscription is purged.
+func (c *Client) GetSubscriptionHistory(ctx context.Context, id uint64) ([]AuditEvent, error) {
+	var events []AuditEvent
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/subscriptions/" + strconv.FormatUint(id, 10) + "/history", idempotent: true}, &events)
+	return events, err
+}
+
+// SearchAuditLog returns the audit events matching filter, newest first; zero fields match every
+// event, and the server limits a search without Limit to 100 events. Requires the admin key.
+func (c *Client) SearchAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	query := url.Values{}
+	if filter.SubscriptionID != 0 {
+		query.Set("subscription_id", strconv.FormatUint(filter.SubscriptionID, 10))
+	}
+	if filter.UserID != uuid.Nil {
+		query.Set("user_id", filter.UserID.String())
+	}
+	if filter.Actor != "" {
+		query.Set("actor", filter.Actor)
+	}
+	if filter.Action != "" {
+		query.Set("action", string(filter.Action))
+	}
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var events []AuditEvent
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/audit", query: query, idempotent: true}, &events)
+	return events, err
+}
+
+// ImportSubscriptions creates the subscriptions of the CSV or JSON Lines file read from file, of
+// the given contentType ("text/csv" or "application/x-ndjson"), and returns the report of every
+// row. Rows that fail are reported, not returned as an error; with mode "all_or_nothing" (the
+// default when empty) none is created if one fails. With dryRun the rows are only checked.
+// The admin key, if set, allows larger files.
+func (c *Client) ImportSubscriptions(ctx context.Context, file io.Reader, contentType string, mode ImportMode, dryRun bool) (ImportReport, error) {
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("error reading import file: %w", err)
+	}
+	query := url.Values{}
+	if mode != "" {
+		query.Set("mode", string(mode))
+	}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	var report ImportReport
+	err = c.do(ctx, call{method: http.MethodPost, path: "/v1/subscriptions/import", query: query, raw: raw, contentType: contentType}, &report)
+	return report, err
+}
+
+// GetCostByDateRange returns the total cost in rubles of a user's subscriptions to a service
+// between the months of from and to
+func (c *Client) GetCostByDateRange(ctx context.Context, userID uuid.UUID, serviceName string, from, to time.Time) (int, error) {
+	query := url.Values{
+		"service_name": {serviceName},
+		"from":         {from.Format("01-2006")},
+		"to":           {to.Format("01-2006")},
+	}
+	var resp map[string]int
+	err := c.do(ctx, call{method: http.MethodGet, path: "/v1/costs/" + userID.String(), query: query, idempotent: true}, &resp)
+	return resp["total cost"], err
+}
+
+// call describes one API request
+type call struct {
+	method     string
+	path       string
+	query      url.Values
+	body       any
+	raw        []byte // sent as is instead of body, if set
+	idempotent bool   // safe to retry after a 5xx response or a network error
+
+	contentType string      // of the body, application/json by default
+	header      http.Header // extra request headers
+	etag        *string     // if set, receives the ETag of the response
+}
+
+// do sends the call, retrying as allowed, and decodes the JSON response into out (if not nil)
+func (c *Client) do(ctx context.Context, cl call, out any) error {
+	body := cl.raw
+	if cl.body != nil {
+		var err error
+		if body, err = json.Marshal(cl.body); err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+	}
+
+	u := c.baseURL.JoinPath(cl.path)
+	u.RawQuery = cl.query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, cl, u.String(), body)
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			defer resp.Body.Close()
+			if cl.etag != nil {
+				*cl.etag = resp.Header.Get("ETag")
+			}
+			if out == nil {
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("error decoding response: %w", err)
+			}
+			return nil
+		}
+
+		var retryAfter time.Duration
+		if err == nil {
+			retryAfter, err = readError(resp)
+		}
+
+		wait, retry := c.retry.next(attempt, cl.idempotent, err, retryAfter)
+		if !retry || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send performs a single HTTP request of cl
+func (c *Client) send(ctx context.Context, cl call, u string, body []byte) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, cl.method, u, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", problem.ContentType+", application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", cmp.Or(cl.contentType, "application/json"))
+	}
+	for k, v := range cl.header {
+		req.Header[k] = v
+	}
+	if c.adminKey != "" {
+		req.Header.Set(AdminKeyHeader, c.adminKey)
+	}
+	return c.http.Do(req)
+}
+
+// readError consumes a failed response and returns its Retry-After delay and *Error
+func readError(resp *http.Response) (time.Duration, error) {
+	defer resp.Body.Close()
+
+	// Either a Problem or, from servers predating problem details, an ErrorResponse
+	var payload errorPayload
+	_ = json.NewDecoder(resp.Body).Decode(&payload)
+	return parseRetryAfter(resp.Header.Get("Retry-After")), newError(resp.StatusCode, payload)
+}
@@ -0,0 +1,349 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/client"
+	"github.com/Joshdike/subscriptions_aggregator/internal/handlers"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/memory"
+	"github.com/Joshdike/subscriptions_aggregator/internal/router"
+	"github.com/google/uuid"
+)
+
+const adminKey = "test-admin-secret-key"
+
+// newServer serves the real router over an in-memory repository, optionally wrapped
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+
+	var h http.Handler = router.New(router.Options{
+		Handler:            handlers.New(memory.NewSubscriptionRepo()),
+		AdminSecret:        adminKey,
+		LegacyDeprecatedAt: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		LegacySunset:       time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+	})
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newClient(t *testing.T, baseURL string, opts client.Options) *client.Client {
+	t.Helper()
+
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+		opts.MaxBackoff = 5 * time.Millisecond
+	}
+	c, err := client.New(baseURL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, nil)
+	c := newClient(t, srv.URL, client.Options{AdminKey: adminKey})
+	user := uuid.New()
+
+	id, err := c.CreateSubscription(ctx, client.SubscriptionRequest{
+		ServiceName: "Yandex Plus", Price: 400, UserID: user, StartDate: "01-2025", EndDate: "03-2025",
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	sub, err := c.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetSubscriptionByID: %v", err)
+	}
+	if sub.ID != id || sub.ServiceName != "Yandex Plus" || sub.Price != 400 || sub.UserID != user ||
+		sub.StartDate != "01-2025" || sub.EndDate != "03-2025" {
+		t.Errorf("GetSubscriptionByID = %+v", sub)
+	}
+
+	subs, err := c.GetSubscriptionByUserID(ctx, user)
+	if err != nil {
+		t.Fatalf("GetSubscriptionByUserID: %v", err)
+	}
+	if len(subs) != 1 || subs[0].ID != id {
+		t.Errorf("GetSubscriptionByUserID = %+v", subs)
+	}
+
+	total, err := c.GetCostByDateRange(ctx, user, "Yandex Plus",
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetCostByDateRange: %v", err)
+	}
+	if total != 400 {
+		t.Errorf("GetCostByDateRange = %d, want 400", total)
+	}
+
+	_, etag, err := c.GetSubscriptionWithETag(ctx, id)
+	if err != nil || etag == "" {
+		t.Fatalf("GetSubscriptionWithETag = %q, %v", etag, err)
+	}
+	price := 450
+	updated, newETag, err := c.UpdateSubscription(ctx, id, etag, client.SubscriptionPatch{Price: &price})
+	if err != nil {
+		t.Fatalf("UpdateSubscription: %v", err)
+	}
+	if updated.Price != 450 || updated.StartDate != "01-2025" || newETag == "" || newETag == etag {
+		t.Errorf("UpdateSubscription = %+v, ETag %q", updated, newETag)
+	}
+	if _, _, err := c.UpdateSubscription(ctx, id, etag, client.SubscriptionPatch{Price: &price}); !errors.Is(err, client.ErrVersionMismatch) {
+		t.Errorf("UpdateSubscription(stale ETag) = %v, want ErrVersionMismatch", err)
+	}
+	if _, _, err := c.UpdateSubscription(ctx, id, "", client.SubscriptionPatch{Price: &price}); !errors.Is(err, client.ErrPreconditionRequired) {
+		t.Errorf("UpdateSubscription(no ETag) = %v, want ErrPreconditionRequired", err)
+	}
+
+	newID, err := c.RenewOrExtendSubscription(ctx, id)
+	if err != nil {
+		t.Fatalf("RenewOrExtendSubscription: %v", err)
+	}
+	if newID == id || newID == 0 {
+		t.Errorf("RenewOrExtendSubscription = %d", newID)
+	}
+
+	if err := c.DeleteSubscription(ctx, id); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+	if _, err := c.GetSubscriptionByID(ctx, id); !errors.Is(err, client.ErrSubscriptionNotFound) {
+		t.Errorf("GetSubscriptionByID after delete: %v, want ErrSubscriptionNotFound", err)
+	}
+
+	all, err := c.GetSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("GetSubscriptions: %v", err)
+	}
+	if len(all) != 2 || !all[0].Deleted || all[1].Deleted {
+		t.Errorf("GetSubscriptions = %+v", all)
+	}
+
+	trash, err := c.GetDeletedSubscriptionsByUserID(ctx, user)
+	if err != nil {
+		t.Fatalf("GetDeletedSubscriptionsByUserID: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != id || trash[0].DeletedAt.IsZero() {
+		t.Errorf("GetDeletedSubscriptionsByUserID = %+v", trash)
+	}
+	if err := c.PurgeSubscription(ctx, newID); !errors.Is(err, client.ErrNotDeleted) {
+		t.Errorf("PurgeSubscription(current) = %v, want ErrNotDeleted", err)
+	}
+	if err := c.RestoreSubscription(ctx, id); err != nil {
+		t.Fatalf("RestoreSubscription: %v", err)
+	}
+	if _, err := c.GetSubscriptionByID(ctx, id); err != nil {
+		t.Errorf("GetSubscriptionByID after restore: %v", err)
+	}
+	if err := c.DeleteSubscription(ctx, id); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+	if err := c.PurgeSubscription(ctx, id); err != nil {
+		t.Fatalf("PurgeSubscription: %v", err)
+	}
+	if err := c.RestoreSubscription(ctx, id); !errors.Is(err, client.ErrSubscriptionNotFound) {
+		t.Errorf("RestoreSubscription after purge: %v, want ErrSubscriptionNotFound", err)
+	}
+
+	events, err := c.GetSubscriptionHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("GetSubscriptionHistory: %v", err)
+	}
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, string(event.Action))
+	}
+	if got, want := strings.Join(actions, ","), "create,update,delete,restore,delete,purge"; got != want {
+		t.Errorf("GetSubscriptionHistory = %s, want %s", got, want)
+	}
+	purges, err := c.SearchAuditLog(ctx, client.AuditFilter{UserID: user, Action: models.AuditPurge})
+	if err != nil {
+		t.Fatalf("SearchAuditLog: %v", err)
+	}
+	if len(purges) != 1 || purges[0].SubscriptionID != id || purges[0].Actor != "api_key" {
+		t.Errorf("SearchAuditLog(purges) = %+v", purges)
+	}
+}
+
+func TestImportSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, nil)
+	c := newClient(t, srv.URL, client.Options{})
+	user := uuid.New().String()
+	file := "service_name,price,user_id,start_date\n" +
+		"Yandex Plus,400," + user + ",01-2025\n" +
+		"Yandex Plus,400," + user + ",01-2025\n" +
+		"Kinopoisk,299," + user + ",01-2025\n"
+
+	report, err := c.ImportSubscriptions(ctx, strings.NewReader(file), "text/csv", models.ImportBestEffort, true)
+	if err != nil {
+		t.Fatalf("ImportSubscriptions(dry run): %v", err)
+	}
+	if !report.DryRun || report.Total != 3 || report.Created != 0 || report.Failed != 1 ||
+		report.Rows[0].Status != models.ImportValid || report.Rows[1].Code != "subscription_already_exists" {
+		t.Errorf("ImportSubscriptions(dry run) = %+v", report)
+	}
+
+	report, err = c.ImportSubscriptions(ctx, strings.NewReader(file), "text/csv", models.ImportBestEffort, false)
+	if err != nil {
+		t.Fatalf("ImportSubscriptions: %v", err)
+	}
+	if report.Created != 2 || report.Rows[0].ID == 0 || report.Rows[1].Status != models.ImportFailed || report.Rows[2].Line != 4 {
+		t.Errorf("ImportSubscriptions = %+v", report)
+	}
+
+	_, err = c.ImportSubscriptions(ctx, strings.NewReader(file), "application/json", "", false)
+	if !errors.Is(err, client.ErrInvalidInput) {
+		t.Errorf("ImportSubscriptions(application/json) error = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, nil)
+	c := newClient(t, srv.URL, client.Options{})
+	user := uuid.New()
+
+	if _, err := c.CreateSubscription(ctx, client.SubscriptionRequest{ServiceName: "Netflix", Price: 700, UserID: user, StartDate: "01-2025"}); err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		call   func() error
+		want   error
+		status int
+	}{
+		{"invalid start date", func() error {
+			_, err := c.CreateSubscription(ctx, client.SubscriptionRequest{ServiceName: "Netflix", UserID: user, StartDate: "2025-01"})
+			return err
+		}, client.ErrInvalidInput, http.StatusBadRequest},
+		{"overlap", func() error {
+			_, err := c.CreateSubscription(ctx, client.SubscriptionRequest{ServiceName: "Netflix", Price: 700, UserID: user, StartDate: "01-2025"})
+			return err
+		}, client.ErrAlreadyExists, http.StatusConflict},
+		{"not found", func() error {
+			_, err := c.GetSubscriptionByID(ctx, 42)
+			return err
+		}, client.ErrSubscriptionNotFound, http.StatusNotFound},
+		{"missing admin key", func() error {
+			_, err := c.GetSubscriptions(ctx)
+			return err
+		}, client.ErrUnauthorized, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			var apiErr *client.Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Errorf("error = %#v, want status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+// failFirst answers the first n requests with status, then passes them to the router
+func failFirst(n int32, status int, attempts *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) <= n {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{"error":"An error occurred","details":"Internal server error"}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.New()
+
+	t.Run("idempotent call retried on 5xx", func(t *testing.T) {
+		var attempts atomic.Int32
+		srv := newServer(t, failFirst(2, http.StatusServiceUnavailable, &attempts))
+		c := newClient(t, srv.URL, client.Options{})
+
+		if _, err := c.GetSubscriptionByUserID(ctx, user); err != nil {
+			t.Fatalf("GetSubscriptionByUserID: %v", err)
+		}
+		if n := attempts.Load(); n != 3 {
+			t.Errorf("attempts = %d, want 3", n)
+		}
+	})
+
+	t.Run("create not retried on 5xx", func(t *testing.T) {
+		var attempts atomic.Int32
+		srv := newServer(t, failFirst(1, http.StatusInternalServerError, &attempts))
+		c := newClient(t, srv.URL, client.Options{})
+
+		_, err := c.CreateSubscription(ctx, client.SubscriptionRequest{ServiceName: "Netflix", Price: 700, UserID: user, StartDate: "01-2025"})
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("error = %v, want a 500 *client.Error", err)
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts = %d, want 1", n)
+		}
+	})
+
+	t.Run("create retried on 429", func(t *testing.T) {
+		var attempts atomic.Int32
+		srv := newServer(t, failFirst(1, http.StatusTooManyRequests, &attempts))
+		c := newClient(t, srv.URL, client.Options{})
+
+		if _, err := c.CreateSubscription(ctx, client.SubscriptionRequest{ServiceName: "Netflix", Price: 700, UserID: user, StartDate: "01-2025"}); err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+		if n := attempts.Load(); n != 2 {
+			t.Errorf("attempts = %d, want 2", n)
+		}
+	})
+
+	t.Run("gives up after MaxRetries", func(t *testing.T) {
+		var attempts atomic.Int32
+		srv := newServer(t, failFirst(10, http.StatusBadGateway, &attempts))
+		c := newClient(t, srv.URL, client.Options{MaxRetries: 2})
+
+		if _, err := c.GetSubscriptionByID(ctx, 1); err == nil {
+			t.Fatal("expected an error")
+		}
+		if n := attempts.Load(); n != 3 {
+			t.Errorf("attempts = %d, want 3", n)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		var attempts atomic.Int32
+		srv := newServer(t, failFirst(10, http.StatusServiceUnavailable, &attempts))
+		c := newClient(t, srv.URL, client.Options{MaxRetries: 10, MinBackoff: time.Second, MaxBackoff: time.Second})
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if _, err := c.GetSubscriptionByID(ctx, 1); err == nil {
+			t.Fatal("expected an error")
+		}
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("attempts = %d, want 1", n)
+		}
+	})
+}
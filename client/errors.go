@@ -0,0 +1,110 @@
+package client
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+)
+
+// Sentinel errors matched by errors.Is on the *Error returned for failed requests. They are the
+// errors of internal/pkg/errors, so code sharing this module can match either.
+var (
+	ErrSubscriptionNotFound = errors.ErrSubscriptionNotFound // 404
+	ErrInvalidInput         = errors.ErrInvalidInput         // 400 validation failed
+	ErrAlreadyExists        = errors.ErrAlreadyExists        // 409
+	ErrDecodingJSON         = errors.ErrDecodingJSON         // 400 invalid request format
+	ErrEncodingJSON         = errors.ErrEncodingJSON         // 500 the server failed to encode its response
+	ErrUnauthorized         = errors.ErrUnauthorized         // 401
+	ErrNotDeleted           = errors.ErrNotDeleted           // 409 the subscription must be deleted first
+	ErrVersionMismatch      = errors.ErrVersionMismatch      // 412 the subscription changed since its ETag was read
+	ErrPreconditionRequired = errors.ErrPreconditionRequired // 428 the update lacks an If-Match header
+	ErrIdempotencyKeyReused = errors.ErrIdempotencyKeyReused // 422 the Idempotency-Key was sent with another request
+	ErrIdempotencyKeyInUse  = errors.ErrIdempotencyKeyInUse  // 409 the request holding the Idempotency-Key is in flight
+	ErrUnsupportedMediaType = errors.ErrUnsupportedMediaType // 415 the body is not of a type the endpoint accepts
+	ErrPayloadTooLarge      = errors.ErrPayloadTooLarge      // 413 the body is larger than the endpoint accepts
+)
+
+// Error is a non-2xx response of the API, decoded from its Problem (or legacy ErrorResponse) payload
+type Error struct {
+	StatusCode int
+	Code       string // the stable problem code, e.g. "subscription_not_found"; empty for legacy payloads
+	Message    string // the problem title, or the legacy "error" field
+	Details    string // the problem detail, or the legacy "details" field, if any
+	RequestID  string // the problem instance, if any
+
+	sentinel error
+}
+
+func (e *Error) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%s (%d): %s", e.Message, e.StatusCode, e.Details)
+	}
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+// Unwrap returns the sentinel error matching the response, or nil
+func (e *Error) Unwrap() error {
+	return e.sentinel
+}
+
+// errorPayload holds the members of both error formats
+type errorPayload struct {
+	Problem
+	Error   string `json:"error"`
+	Details any    `json:"details"`
+}
+
+// sentinels maps the problem codes to the sentinel errors
+var sentinels = map[string]error{
+	problem.SubscriptionNotFound.Code: ErrSubscriptionNotFound,
+	problem.InvalidInput.Code:         ErrInvalidInput,
+	problem.AlreadyExists.Code:        ErrAlreadyExists,
+	problem.MalformedRequest.Code:     ErrDecodingJSON,
+	problem.EncodingFailed.Code:       ErrEncodingJSON,
+	problem.Unauthorized.Code:         ErrUnauthorized,
+	problem.NotDeleted.Code:           ErrNotDeleted,
+	problem.VersionMismatch.Code:      ErrVersionMismatch,
+	problem.PreconditionRequired.Code: ErrPreconditionRequired,
+	problem.IdempotencyKeyReused.Code: ErrIdempotencyKeyReused,
+	problem.IdempotencyKeyInUse.Code:  ErrIdempotencyKeyInUse,
+	problem.UnsupportedMediaType.Code: ErrUnsupportedMediaType,
+	problem.PayloadTooLarge.Code:      ErrPayloadTooLarge,
+}
+
+// newError builds the error of a failed response from its status and payload, choosing the
+// sentinel from the problem code, or for legacy payloads the way utils.WriteError chose the status
+func newError(status int, resp errorPayload) *Error {
+	if resp.Code != "" {
+		return &Error{
+			StatusCode: status,
+			Code:       resp.Code,
+			Message:    cmp.Or(resp.Title, http.StatusText(status)),
+			Details:    resp.Detail,
+			RequestID:  resp.Instance,
+			sentinel:   sentinels[resp.Code],
+		}
+	}
+
+	e := &Error{StatusCode: status, Message: cmp.Or(resp.Error, http.StatusText(status))}
+	if details, ok := resp.Details.(string); ok {
+		e.Details = details
+	}
+	switch {
+	case status == http.StatusBadRequest && resp.Error == "Invalid Request Format":
+		e.sentinel = ErrDecodingJSON
+	case status == http.StatusBadRequest:
+		e.sentinel = ErrInvalidInput
+	case status == http.StatusNotFound:
+		e.sentinel = ErrSubscriptionNotFound
+	case status == http.StatusConflict:
+		e.sentinel = ErrAlreadyExists
+	case status == http.StatusUnauthorized:
+		e.sentinel = ErrUnauthorized
+	case status == http.StatusInternalServerError && resp.Error == "Failed to process Response":
+		e.sentinel = ErrEncodingJSON
+	}
+	return e
+}
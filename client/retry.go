@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy decides whether and when a failed attempt is retried
+type retryPolicy struct {
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// next returns the delay before the attempt following the failed attempt (0-based), and whether
+// to retry at all: 429 responses are always retried (the request was not processed); 5xx
+// responses and network errors only for idempotent calls.
+func (p retryPolicy) next(attempt int, idempotent bool, err error, retryAfter time.Duration) (time.Duration, bool) {
+	if attempt >= p.maxRetries {
+		return 0, false
+	}
+
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusInternalServerError:
+		if !idempotent {
+			return 0, false
+		}
+	case errors.As(err, &apiErr):
+		return 0, false
+	default:
+		// network error
+		if !idempotent {
+			return 0, false
+		}
+	}
+
+	if retryAfter > 0 {
+		return min(retryAfter, p.maxBackoff), true
+	}
+	return p.backoff(attempt), true
+}
+
+// backoff returns an exponential delay with full jitter, between minBackoff and maxBackoff
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.minBackoff << min(attempt, 30)
+	if ceiling <= 0 || ceiling > p.maxBackoff {
+		ceiling = p.maxBackoff
+	}
+	return p.minBackoff + rand.N(ceiling-p.minBackoff+1)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
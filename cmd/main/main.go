@@ -1,9 +1,11 @@
 // @title Subscriptions Aggregator API
 // @version 1.0
 // @description API for managing user subscriptions and cost calculations
+// @description Errors are answered in one of two representations, chosen by the Accept header: clients listing
+// @description application/problem+json get RFC 9457 problem details (problem.Problem); every other client, including
+// @description those sending no Accept header or */*, gets the legacy utils.ErrorResponse documented on each operation.
 // @contact.name API Support
 // @contact.email dikejoshua@gmail.com
-// @host localhost:8080
 // @BasePath /
 // @securityDefinitions.apikey AdminAuth
 // @in header
@@ -12,77 +14,348 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	_ "github.com/Joshdike/subscriptions_aggregator/docs"
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/apidocs"
+	"github.com/Joshdike/subscriptions_aggregator/internal/cache"
+	"github.com/Joshdike/subscriptions_aggregator/internal/config"
+	"github.com/Joshdike/subscriptions_aggregator/internal/graph"
+	"github.com/Joshdike/subscriptions_aggregator/internal/grpcapi"
 	"github.com/Joshdike/subscriptions_aggregator/internal/handlers"
+	"github.com/Joshdike/subscriptions_aggregator/internal/health"
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/metrics"
 	mw "github.com/Joshdike/subscriptions_aggregator/internal/middleware"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
 	"github.com/Joshdike/subscriptions_aggregator/internal/repository/pg"
+	"github.com/Joshdike/subscriptions_aggregator/internal/router"
+	"github.com/Joshdike/subscriptions_aggregator/internal/tracing"
+	"github.com/Joshdike/subscriptions_aggregator/internal/worker"
+	"github.com/Joshdike/subscriptions_aggregator/migrations"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/multitracer"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
-	httpSwagger "github.com/swaggo/http-swagger"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatal(err)
+	// Load the configuration from defaults, config file, environment (.env) and flags
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if cfg != nil && cfg.PrintConfig {
+		if printErr := cfg.Print(os.Stdout); printErr != nil {
+			fatal(slog.Default(), "error printing configuration", printErr)
+		}
+	}
+	if err != nil {
+		// Report every configuration problem at once, in plain text
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		return
 	}
 
-	// Create a new context
-	ctx := context.Background()
+	// Configure the structured logger
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal(slog.Default(), "error configuring logger", err)
+	}
+	slog.SetDefault(logger)
 
-	// Establish a new connection pool to the database
-	pool, err := pgxpool.New(ctx, os.Getenv("DATABASE_URL"))
+	if err := run(cfg, logger); err != nil {
+		fatal(logger, "server stopped", err)
+	}
+	logger.Info("server stopped")
+}
+
+// run wires the application and serves HTTP and gRPC until SIGINT or SIGTERM is received, then shuts down
+// gracefully: stop accepting connections, drain in-flight requests and background jobs within
+// the shutdown timeout, close the database pool and finally flush traces, which happens on failures too.
+func run(cfg *config.Config, logger *slog.Logger) error {
+	// Create a context canceled on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Configure OpenTelemetry tracing (none, stdout or otlp exporter)
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Exporter, cfg.Tracing.ServiceName, os.Stdout)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	// Flush the buffered spans however run returns, with a context of its own since ctx may be
+	// canceled by then
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.Error("error flushing traces", slog.Any("error_chain", logging.ErrorChain(err)))
+		}
+	}()
+
+	// Establish a new connection pool to the database, logging and tracing every SQL statement
+	pool, err := newPool(ctx, cfg.Database.URL, logger)
+	if err != nil {
+		return err
 	}
 	defer pool.Close()
 
 	// Check if the database connection is alive
 	if err := pool.Ping(ctx); err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	// Read replica pools, not required to be reachable: reads fall back to the primary
+	var replicas []*pgxpool.Pool
+	for i, url := range cfg.Database.ReplicaURLs {
+		replica, err := newPool(ctx, url, logger)
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+		defer replica.Close()
+		replicas = append(replicas, replica)
+	}
+
+	// Background jobs run until ctx is canceled
+	workers := worker.NewGroup(logger)
+
+	// Register the readiness checks: database reachability and schema version
+	migrationVersion, err := migrations.LatestVersion()
+	if err != nil {
+		return err
+	}
+	checker := health.New(cfg.Health.Timeout)
+	checker.AddCheck("database", health.DatabaseCheck(pool))
+	checker.AddCheck("migrations", health.MigrationCheck(pool, migrationVersion))
+
+	// Create the Prometheus metrics with pool statistics
+	m := metrics.New()
+	if err := m.Register(metrics.NewPoolCollector(pool)); err != nil {
+		return fmt.Errorf("error registering metrics: %w", err)
 	}
 
 	// Initialize a new router using Chi
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)    // Middleware for logging
-	r.Use(middleware.Recoverer) // Middleware for recovering from panics
+	r.Use(tracing.Middleware)          // Middleware for tracing, continuing incoming traceparent headers
+	r.Use(mw.RequestIDMiddleware)      // Middleware for request ID propagation
+	r.Use(mw.LoggerMiddleware(logger)) // Middleware for structured request logging
+	r.Use(m.Middleware)                // Middleware for HTTP metrics
+	r.Use(middleware.Recoverer)        // Middleware for recovering from panics
+
+	// Middleware choosing the language of messages (lang parameter, Accept-Language, api.default_language)
+	r.Use(i18n.Middleware(cfg.API.Language()))
 
-	// Swagger UI route
-	r.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger/doc.json")))
+	// Prometheus metrics route
+	r.Handle("/metrics", m.Handler())
 
-	// Create a new Subscription repository
-	subRepo := pg.NewSubscriptionRepo(pool)
+	// Liveness and readiness probes
+	r.Get("/healthz", checker.Liveness)
+	r.Get("/readyz", checker.Readiness)
 
-	// Create a new Subscription handler
-	h := handlers.New(subRepo)
+	// API documentation routes: Swagger UI and the OpenAPI 3.1 document for the public base URL
+	apiDocs, err := apidocs.New(cfg.Public.URL())
+	if err != nil {
+		return err
+	}
+	r.Get("/swagger/*", apiDocs.SwaggerUI())
+	r.Get("/openapi.json", apiDocs.OpenAPI)
 
-	// Define routes and their handler functions
-	r.Post("/subscriptions", h.CreateSubscription)
-	r.Get("/subscriptions/user/{user_id}", h.GetSubscriptionByUserID)
-	r.Get("/subscriptions/{id}", h.GetSubscriptionByID)
-	r.Post("/subscriptions/{id}", h.RenewOrExtendSubscription)
-	r.Patch("/subscriptions/{id}", h.DeleteSubscription)
+	// Error types: the "type" of problem details responses points at their description
+	problem.SetTypeBase(cfg.Public.URL().JoinPath("problems").String())
+	r.Get("/problems/{code}", problem.Describe)
 
-	r.Get("/costs/{user_id}", h.GetCostByDateRange)
+	// Create a new Subscription repository and expose its business gauges
+	subRepo := pg.NewSubscriptionRepo(pool, pg.Options{Replicas: replicas, ReadYourWrites: cfg.Database.ReadYourWritesWindow})
+	if len(replicas) > 0 {
+		if err := subRepo.CheckReplicas(ctx); err != nil {
+			logger.Warn("read replicas unavailable, reading from the primary", slog.Any("error", err))
+		}
+		replicaCheck := workers.Every(ctx, "replica-check", cfg.Database.ReplicaCheckInterval, subRepo.CheckReplicas)
+		checker.AddCheck("replica-check", health.WorkerCheck(replicaCheck))
+	}
+	// Trash retention: purge the subscriptions soft-deleted more than trash.retention_days ago
+	if days := cfg.Trash.RetentionDays; days > 0 {
+		retention := workers.Every(ctx, "trash-retention", cfg.Trash.PurgeInterval, func(ctx context.Context) error {
+			purged, err := subRepo.PurgeDeleted(actor.With(ctx, actor.System("retention")), time.Now().AddDate(0, 0, -days))
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				logger.Info("purged deleted subscriptions", slog.Int64("count", purged), slog.Int("retention_days", days))
+			}
+			return nil
+		})
+		checker.AddCheck("trash-retention", health.WorkerCheck(retention))
+	}
+	// Idempotency keys: delete the ones whose responses are no longer replayed
+	idempotencyRepo := pg.NewIdempotencyRepo(pool)
+	idempotencyCleanup := workers.Every(ctx, "idempotency-cleanup", cfg.Idempotency.CleanupInterval, func(ctx context.Context) error {
+		removed, err := idempotencyRepo.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			logger.Info("deleted expired idempotency keys", slog.Int("count", removed))
+		}
+		return nil
+	})
+	checker.AddCheck("idempotency-cleanup", health.WorkerCheck(idempotencyCleanup))
+	if err := m.Register(metrics.NewBusinessCollector(subRepo)); err != nil {
+		return fmt.Errorf("error registering metrics: %w", err)
+	}
 
-	// Admin route
-	r.With(mw.AdminSecretMiddleware(os.Getenv("SECRET_KEY"))).Get("/subscriptions", h.GetSubscriptions)
+	// Create a new Subscription handler on top of the instrumented (and optionally cached) repository
+	var instrumented repository.SubscriptionRepository = metrics.NewRepository(subRepo, m)
+	if cfg.Cache.Enabled {
+		instrumented = cache.NewRepository(instrumented, cache.Options{Size: cfg.Cache.Size, TTL: cfg.Cache.TTL, Recorder: m})
+	}
+	repo := tracing.NewRepository(instrumented)
+	h := handlers.New(repo)
+
+	// GraphQL endpoint over the same repository, with query depth and complexity limits
+	gql, err := graph.New(repo, graph.Options{MaxDepth: cfg.GraphQL.MaxDepth, MaxComplexity: cfg.GraphQL.MaxComplexity})
+	if err != nil {
+		return err
+	}
+	r.Handle("/graphql", gql)
+
+	// Mount the versioned API routes (/v1, /v2 and the deprecated unversioned aliases)
+	r.Mount("/", router.New(router.Options{
+		Handler:            h,
+		AdminSecret:        cfg.Admin.SecretKey,
+		LegacyDeprecatedAt: cfg.API.LegacyDeprecatedAt,
+		LegacySunset:       cfg.API.LegacySunset,
+		Idempotency:        idempotencyRepo,
+		IdempotencyOptions: mw.IdempotencyOptions{
+			TTL:          cfg.Idempotency.TTL,
+			LockTimeout:  cfg.Idempotency.LockTimeout,
+			MaxBodyBytes: cfg.Idempotency.MaxBodyBytes,
+		},
+	}))
+
+	// Serve the API under the path prefix of the public base URL, if any
+	var handler http.Handler = r
+	if prefix := cfg.Public.PathPrefix(); prefix != "" {
+		root := chi.NewRouter()
+		root.Mount(prefix, r)
+		handler = root
+	}
+
+	// Create the server with the configured port and timeouts
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	// Create the gRPC server on its own port, serving the same repository
+	grpcSrv := grpcapi.NewServer(logger, grpcapi.NewService(repo))
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPC.Port))
+	if err != nil {
+		return fmt.Errorf("error listening for grpc: %w", err)
+	}
 
-	// Get the port from environment variable and start the server
-	port := fmt.Sprintf(":%s", os.Getenv("PORT"))
-	fmt.Println("Server starting ...")
 	// Start the HTTP server
-	err = http.ListenAndServe(port, r)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server starting", slog.String("addr", srv.Addr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Start the gRPC server
+	grpcErr := make(chan error, 1)
+	go func() {
+		logger.Info("grpc server starting", slog.String("addr", grpcListener.Addr().String()))
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			grpcErr <- err
+		}
+	}()
+
+	// Wait for a shutdown signal or a server failure
+	select {
+	case err := <-serverErr:
+		grpcSrv.Stop()
+		return fmt.Errorf("error serving http: %w", err)
+	case err := <-grpcErr:
+		_ = srv.Close()
+		return fmt.Errorf("error serving grpc: %w", err)
+	case <-ctx.Done():
+		stop()
+		logger.Info("shutdown signal received, draining", slog.Duration("timeout", cfg.Server.ShutdownTimeout))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and wait for in-flight requests, then for background jobs
+	var shutdownErr error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		shutdownErr = errors.Join(shutdownErr, fmt.Errorf("error shutting down server: %w", err))
+	}
+	if err := stopGRPC(shutdownCtx, grpcSrv); err != nil {
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+	if err := workers.Wait(shutdownCtx); err != nil {
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+	// The database pools are closed and the traces flushed by the deferred calls once run returns
+	return shutdownErr
+}
+
+// newPool creates a connection pool to the database at url, logging and tracing every SQL statement
+func newPool(ctx context.Context, url string, logger *slog.Logger) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing database url: %w", err)
+	}
+	poolConfig.ConnConfig.Tracer = multitracer.New(pg.NewQueryLogger(logger), tracing.NewQueryTracer())
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("error creating database pool: %w", err)
 	}
+	return pool, nil
+}
+
+// stopGRPC stops the gRPC server gracefully, waiting for pending calls, and forcibly once ctx expires
+func stopGRPC(ctx context.Context, srv *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return fmt.Errorf("error shutting down grpc server: %w", ctx.Err())
+	}
+}
 
+// fatal logs the error and exits the process
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, slog.Any("error_chain", logging.ErrorChain(err)))
+	os.Exit(1)
 }
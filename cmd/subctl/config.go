@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds the connection settings of one API deployment
+type Profile struct {
+	BaseURL  string `yaml:"base_url"`
+	AdminKey string `yaml:"admin_key,omitempty"`
+	Output   string `yaml:"output,omitempty"`
+}
+
+// fileConfig is the subctl configuration file:
+//
+//	current_profile: local
+//	profiles:
+//	  local:
+//	    base_url: http://localhost:8080
+//	  prod:
+//	    base_url: https://api.example.com/subscriptions
+//	    admin_key: ...
+//	    output: json
+type fileConfig struct {
+	CurrentProfile string             `yaml:"current_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+const defaultBaseURL = "http://localhost:8080"
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/subctl/config.yaml (or its OS equivalent)
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "subctl", "config.yaml")
+}
+
+// loadProfile reads the named profile (or the current one) from the configuration file. A missing
+// file yields a default profile pointing at a local server.
+func loadProfile(path, name string) (Profile, error) {
+	cfg := fileConfig{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return Profile{}, err
+		default:
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				return Profile{}, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		return Profile{BaseURL: defaultBaseURL}, nil
+	}
+
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	if profile.BaseURL == "" {
+		profile.BaseURL = defaultBaseURL
+	}
+	return profile, nil
+}
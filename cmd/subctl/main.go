@@ -0,0 +1,557 @@
+// Command subctl is a command-line client for the subscriptions aggregator REST API (v1).
+//
+// Usage:
+//
+//	subctl [global flags] <command> [command flags]
+//
+// Connection settings come from a profile of the configuration file (see fileConfig), overridden by
+// the SUBCTL_* environment variables and the global flags. The exit code reflects the API error:
+// see the exit* constants.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/client"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/google/uuid"
+)
+
+// Exit codes, mapped from the HTTP status of the API errors (client.Error, decoded from their
+// problem details); statuses not listed here exit with exitError
+const (
+	exitOK           = 0
+	exitError        = 1 // internal server error, network or decoding failure
+	exitUsage        = 2 // invalid command line or configuration
+	exitInvalidInput = 3 // 400: invalid request or validation failed; 413, 415, 422 and 428: request rejected as sent
+	exitNotFound     = 4 // 404: no subscription found
+	exitConflict     = 5 // 409: overlapping subscription, or purging one that is not deleted; 412: changed while updating
+	exitUnauthorized = 6 // 401: missing or wrong admin key
+)
+
+const usage = `Usage: subctl [global flags] <command> [command flags]
+
+Commands:
+  create    --user UUID --service NAME --price RUBLES --start MM-YYYY [--end MM-YYYY]
+  get       ID
+  list      --user UUID
+  update    ID [--service NAME] [--price RUBLES] [--start MM-YYYY] [--end MM-YYYY, or '' to reset]
+  renew     ID
+  delete    ID
+  trash     --user UUID
+  restore   ID
+  history   ID
+  cost      --user UUID --service NAME --from MM-YYYY --to MM-YYYY
+  import    [--format csv|ndjson, from the extension by default]
+            [--mode all_or_nothing|best_effort] [--dry-run] FILE (larger files with the admin key)
+  list-all  (admin key required)
+  purge     ID (admin key required)
+  audit     [--subscription ID] [--user UUID] [--actor ACTOR] [--action ACTION]
+            [--from RFC3339] [--to RFC3339] [--limit N] (admin key required)
+
+Global flags:
+`
+
+// globalOptions are the flags accepted before the command
+type globalOptions struct {
+	config   string
+	profile  string
+	baseURL  string
+	adminKey string
+	output   string
+	timeout  time.Duration
+}
+
+// usageError is an invalid command line, reported with exit code 2
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	opts := globalOptions{}
+	global := flag.NewFlagSet("subctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.StringVar(&opts.config, "config", envOr("SUBCTL_CONFIG", defaultConfigPath()), "configuration file with the profiles (SUBCTL_CONFIG)")
+	global.StringVar(&opts.profile, "profile", os.Getenv("SUBCTL_PROFILE"), "profile to use instead of current_profile (SUBCTL_PROFILE)")
+	global.StringVar(&opts.baseURL, "base-url", os.Getenv("SUBCTL_BASE_URL"), "API base URL, overriding the profile (SUBCTL_BASE_URL)")
+	global.StringVar(&opts.adminKey, "admin-key", os.Getenv("SUBCTL_ADMIN_KEY"), "admin secret key, overriding the profile (SUBCTL_ADMIN_KEY)")
+	global.StringVar(&opts.output, "o", "", "output format: table, json or csv (default from the profile, else table)")
+	global.DurationVar(&opts.timeout, "timeout", 10*time.Second, "request timeout")
+	global.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		global.PrintDefaults()
+	}
+
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return exitUsage
+	}
+
+	client, format, err := newClient(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "subctl:", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	res, err := runCommand(ctx, client, global.Arg(0), global.Args()[1:], stderr)
+	if err == nil {
+		err = res.write(stdout, format)
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintln(stderr, "subctl:", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// newClient builds the API client from the selected profile and the overrides
+func newClient(opts globalOptions) (*client.Client, string, error) {
+	profile, err := loadProfile(opts.config, opts.profile)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.baseURL != "" {
+		profile.BaseURL = opts.baseURL
+	}
+	if opts.adminKey != "" {
+		profile.AdminKey = opts.adminKey
+	}
+
+	format := FormatTable
+	if profile.Output != "" {
+		format = profile.Output
+	}
+	if opts.output != "" {
+		format = opts.output
+	}
+	if format != FormatTable && format != FormatJSON && format != FormatCSV {
+		return nil, "", fmt.Errorf("unknown output format %q (use table, json or csv)", format)
+	}
+
+	c, err := client.New(profile.BaseURL, client.Options{AdminKey: profile.AdminKey})
+	if err != nil {
+		return nil, "", err
+	}
+	return c, format, nil
+}
+
+// runCommand parses the command flags and calls the API
+func runCommand(ctx context.Context, c *client.Client, name string, args []string, stderr io.Writer) (result, error) {
+	fs := flag.NewFlagSet("subctl "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	switch name {
+	case "create":
+		user := fs.String("user", "", "user UUID")
+		service := fs.String("service", "", "service name")
+		price := fs.Int("price", 0, "monthly price in rubles")
+		start := fs.String("start", "", "start month (MM-YYYY)")
+		end := fs.String("end", "", "optional end month (MM-YYYY)")
+		if err := parseFlags(fs, args, 0); err != nil {
+			return result{}, err
+		}
+		userID, err := parseUser(*user)
+		if err != nil {
+			return result{}, err
+		}
+
+		id, err := c.CreateSubscription(ctx, client.SubscriptionRequest{ServiceName: *service, Price: *price, UserID: userID, StartDate: *start, EndDate: *end})
+		if err != nil {
+			return result{}, err
+		}
+		return idResult(id), nil
+
+	case "get":
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+		sub, err := c.GetSubscriptionByID(ctx, id)
+		if err != nil {
+			return result{}, err
+		}
+		r := subscriptionsResult([]models.SubscriptionResponse{sub})
+		r.value = sub
+		return r, nil
+
+	case "list":
+		user := fs.String("user", "", "user UUID")
+		if err := parseFlags(fs, args, 0); err != nil {
+			return result{}, err
+		}
+		userID, err := parseUser(*user)
+		if err != nil {
+			return result{}, err
+		}
+		subs, err := c.GetSubscriptionByUserID(ctx, userID)
+		if err != nil {
+			return result{}, err
+		}
+		return subscriptionsResult(subs), nil
+
+	case "list-all":
+		if err := parseFlags(fs, args, 0); err != nil {
+			return result{}, err
+		}
+		subs, err := c.GetSubscriptions(ctx)
+		if err != nil {
+			return result{}, err
+		}
+		return adminSubscriptionsResult(subs), nil
+
+	case "update":
+		service := fs.String("service", "", "new service name")
+		price := fs.Int("price", 0, "new monthly price in rubles")
+		start := fs.String("start", "", "new start month (MM-YYYY)")
+		end := fs.String("end", "", "new end month (MM-YYYY), or empty to reset it to one month after the start")
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+
+		// Only the flags given are patched
+		var patch client.SubscriptionPatch
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "service":
+				patch.ServiceName = service
+			case "price":
+				patch.Price = price
+			case "start":
+				patch.StartDate = start
+			case "end":
+				patch.EndDate = end
+			}
+		})
+		if patch == (client.SubscriptionPatch{}) {
+			return result{}, usagef("%s: nothing to update, set at least one of --service, --price, --start or --end", fs.Name())
+		}
+
+		// Read the current version, so the update fails if the subscription changes in between
+		_, etag, err := c.GetSubscriptionWithETag(ctx, id)
+		if err != nil {
+			return result{}, err
+		}
+		sub, _, err := c.UpdateSubscription(ctx, id, etag, patch)
+		if err != nil {
+			return result{}, err
+		}
+		r := subscriptionsResult([]models.SubscriptionResponse{sub})
+		r.value = sub
+		return r, nil
+
+	case "renew":
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+		newID, err := c.RenewOrExtendSubscription(ctx, id)
+		if err != nil {
+			return result{}, err
+		}
+		return idResult(newID), nil
+
+	case "delete":
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+		if err := c.DeleteSubscription(ctx, id); err != nil {
+			return result{}, err
+		}
+		return idResult(id), nil
+
+	case "trash":
+		user := fs.String("user", "", "user UUID")
+		if err := parseFlags(fs, args, 0); err != nil {
+			return result{}, err
+		}
+		userID, err := parseUser(*user)
+		if err != nil {
+			return result{}, err
+		}
+		subs, err := c.GetDeletedSubscriptionsByUserID(ctx, userID)
+		if err != nil {
+			return result{}, err
+		}
+		return deletedSubscriptionsResult(subs), nil
+
+	case "restore":
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+		if err := c.RestoreSubscription(ctx, id); err != nil {
+			return result{}, err
+		}
+		return idResult(id), nil
+
+	case "purge":
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+		if err := c.PurgeSubscription(ctx, id); err != nil {
+			return result{}, err
+		}
+		return idResult(id), nil
+
+	case "history":
+		id, err := parseIDArg(fs, args)
+		if err != nil {
+			return result{}, err
+		}
+		events, err := c.GetSubscriptionHistory(ctx, id)
+		if err != nil {
+			return result{}, err
+		}
+		return auditEventsResult(events), nil
+
+	case "audit":
+		subscription := fs.Uint64("subscription", 0, "subscription ID")
+		user := fs.String("user", "", "user UUID")
+		actor := fs.String("actor", "", "actor, e.g. user, api_key or system:retention")
+		action := fs.String("action", "", "action: create, renew, update, delete, restore or purge")
+		from := fs.String("from", "", "earliest event time (RFC3339)")
+		to := fs.String("to", "", "latest event time (RFC3339)")
+		limit := fs.Int("limit", 0, "maximum number of events (server default 100)")
+		if err := parseFlags(fs, args, 0); err != nil {
+			return result{}, err
+		}
+
+		filter := client.AuditFilter{SubscriptionID: *subscription, Actor: *actor, Action: models.AuditAction(*action), Limit: *limit}
+		if *user != "" {
+			userID, err := parseUser(*user)
+			if err != nil {
+				return result{}, err
+			}
+			filter.UserID = userID
+		}
+		var err error
+		if filter.From, err = parseTimestamp("--from", *from); err != nil {
+			return result{}, err
+		}
+		if filter.To, err = parseTimestamp("--to", *to); err != nil {
+			return result{}, err
+		}
+
+		events, err := c.SearchAuditLog(ctx, filter)
+		if err != nil {
+			return result{}, err
+		}
+		return auditEventsResult(events), nil
+
+	case "cost":
+		user := fs.String("user", "", "user UUID")
+		service := fs.String("service", "", "service name")
+		from := fs.String("from", "", "first month (MM-YYYY)")
+		to := fs.String("to", "", "last month (MM-YYYY)")
+		if err := parseFlags(fs, args, 0); err != nil {
+			return result{}, err
+		}
+		userID, err := parseUser(*user)
+		if err != nil {
+			return result{}, err
+		}
+
+		fromMonth, err := parseMonth("--from", *from)
+		if err != nil {
+			return result{}, err
+		}
+		toMonth, err := parseMonth("--to", *to)
+		if err != nil {
+			return result{}, err
+		}
+
+		total, err := c.GetCostByDateRange(ctx, userID, *service, fromMonth, toMonth)
+		if err != nil {
+			return result{}, err
+		}
+		return result{
+			value:  map[string]any{"user_id": userID, "service_name": *service, "from": *from, "to": *to, "total_cost": total},
+			header: []string{"USER", "SERVICE", "FROM", "TO", "TOTAL"},
+			rows:   [][]string{{userID.String(), *service, *from, *to, strconv.Itoa(total)}},
+		}, nil
+
+	case "import":
+		format := fs.String("format", "", "file format: csv or ndjson (default from the file extension)")
+		mode := fs.String("mode", "", "all_or_nothing (default) or best_effort")
+		dryRun := fs.Bool("dry-run", false, "check the rows without creating them")
+		if err := parseFlags(fs, args, 1); err != nil {
+			return result{}, err
+		}
+		contentType, err := importContentType(fs.Arg(0), *format)
+		if err != nil {
+			return result{}, err
+		}
+
+		file, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return result{}, usagef("%s: %v", fs.Name(), err)
+		}
+		defer file.Close()
+		report, err := c.ImportSubscriptions(ctx, file, contentType, client.ImportMode(*mode), *dryRun)
+		if err != nil {
+			return result{}, err
+		}
+		return importReportResult(report), nil
+
+	default:
+		return result{}, usagef("unknown command %q, run subctl -h for the list of commands", name)
+	}
+}
+
+// parseFlags parses the command flags and checks the number of positional arguments
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	if fs.NArg() != nargs {
+		return usagef("%s: expected %d argument(s), got %d", fs.Name(), nargs, fs.NArg())
+	}
+	return nil
+}
+
+// parseIDArg parses the subscription ID given as the only positional argument
+func parseIDArg(fs *flag.FlagSet, args []string) (uint64, error) {
+	if err := parseFlags(fs, args, 1); err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil || id == 0 {
+		return 0, usagef("%s: invalid subscription id %q", fs.Name(), fs.Arg(0))
+	}
+	return id, nil
+}
+
+func parseUser(raw string) (uuid.UUID, error) {
+	if raw == "" {
+		return uuid.UUID{}, usagef("--user is required")
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.UUID{}, usagef("invalid user id %q", raw)
+	}
+	return id, nil
+}
+
+// parseMonth parses a month given as MM-YYYY
+func parseMonth(name, raw string) (time.Time, error) {
+	month, err := time.Parse("01-2006", raw)
+	if err != nil {
+		return time.Time{}, usagef("%s: invalid month %q, expected MM-YYYY", name, raw)
+	}
+	return month, nil
+}
+
+// parseTimestamp parses an optional RFC3339 timestamp
+func parseTimestamp(name, raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	ts, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, usagef("%s: invalid time %q, expected RFC3339", name, raw)
+	}
+	return ts, nil
+}
+
+// importContentType returns the media type of an imported file in format, csv or ndjson, or
+// else in the format given by the extension of path
+func importContentType(path, format string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			return "", usagef("import: cannot tell the format of %q, set --format csv or ndjson", path)
+		}
+	}
+	switch format {
+	case "csv":
+		return "text/csv", nil
+	case "ndjson":
+		return "application/x-ndjson", nil
+	default:
+		return "", usagef("import: invalid format %q, expected csv or ndjson", format)
+	}
+}
+
+func idResult(id uint64) result {
+	return result{
+		value:  map[string]uint64{"id": id},
+		header: []string{"ID"},
+		rows:   [][]string{{strconv.FormatUint(id, 10)}},
+	}
+}
+
+// exitCode maps an error to the process exit code
+func exitCode(err error) int {
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		return exitError
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType,
+		http.StatusUnprocessableEntity, http.StatusPreconditionRequired:
+		return exitInvalidInput
+	case http.StatusNotFound:
+		return exitNotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return exitConflict
+	case http.StatusUnauthorized:
+		return exitUnauthorized
+	default:
+		return exitError
+	}
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var testUser = uuid.MustParse("6f1c8b2e-4a7d-4e21-9c33-2b5d8e9f0a11")
+
+// newTestServer answers GET /v1/subscriptions/1 with a subscription, and GET /v1/subscriptions/{status}
+// with a problem of that status
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Get("/v1/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+		if id == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(models.SubscriptionResponse{
+				ID: 1, ServiceName: "Yandex Plus", Price: 400, UserID: testUser, StartDate: "07-2025", EndDate: "08-2025",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", problem.ContentType)
+		w.WriteHeader(id)
+		json.NewEncoder(w).Encode(problem.Problem{Title: http.StatusText(id), Status: id, Detail: "failed on purpose"})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// runSubctl runs subctl against srv without a configuration file
+func runSubctl(t *testing.T, srv *httptest.Server, args ...string) (int, string, string) {
+	t.Helper()
+	global := []string{"--config", filepath.Join(t.TempDir(), "none.yaml"), "--base-url", srv.URL}
+	var stdout, stderr bytes.Buffer
+	code := run(append(global, args...), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"get", "1"}, exitOK},
+		{"server error", []string{"get", "500"}, exitError},
+		{"unlisted status", []string{"get", "418"}, exitError},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"invalid id", []string{"get", "abc"}, exitUsage},
+		{"unknown output format", []string{"-o", "xml", "get", "1"}, exitUsage},
+		{"bad request", []string{"get", "400"}, exitInvalidInput},
+		{"payload too large", []string{"get", "413"}, exitInvalidInput},
+		{"unsupported media type", []string{"get", "415"}, exitInvalidInput},
+		{"unprocessable", []string{"get", "422"}, exitInvalidInput},
+		{"precondition required", []string{"get", "428"}, exitInvalidInput},
+		{"not found", []string{"get", "404"}, exitNotFound},
+		{"conflict", []string{"get", "409"}, exitConflict},
+		{"precondition failed", []string{"get", "412"}, exitConflict},
+		{"unauthorized", []string{"get", "401"}, exitUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, stderr := runSubctl(t, srv, tt.args...); got != tt.want {
+				t.Errorf("exit code = %d, want %d (stderr %q)", got, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"table", "ID  SERVICE      PRICE  USER                                  START    END\n" +
+			"1   Yandex Plus  400    " + testUser.String() + "  07-2025  08-2025\n"},
+		{"json", "{\n  \"id\": 1,\n  \"service_name\": \"Yandex Plus\",\n  \"price\": 400,\n  \"user_id\": \"" + testUser.String() +
+			"\",\n  \"start_date\": \"07-2025\",\n  \"end_date\": \"08-2025\"\n}\n"},
+		{"csv", "ID,SERVICE,PRICE,USER,START,END\n1,Yandex Plus,400," + testUser.String() + ",07-2025,08-2025\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			code, stdout, stderr := runSubctl(t, srv, "-o", tt.format, "get", "1")
+			if code != exitOK {
+				t.Fatalf("exit code = %d, stderr %q", code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", stdout, tt.want)
+			}
+		})
+	}
+}
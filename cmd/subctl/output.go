@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+)
+
+// Output formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// result is the output of a command: value is written as JSON, header and rows as table or CSV
+type result struct {
+	value  any
+	header []string
+	rows   [][]string
+}
+
+func (r result) write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r.value)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(r.header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(r.rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(r.header, "\t"))
+		for _, row := range r.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q (use table, json or csv)", format)
+	}
+}
+
+var subscriptionHeader = []string{"ID", "SERVICE", "PRICE", "USER", "START", "END"}
+
+func subscriptionRow(sub models.SubscriptionResponse) []string {
+	return []string{
+		strconv.FormatUint(sub.ID, 10),
+		sub.ServiceName,
+		strconv.Itoa(sub.Price),
+		sub.UserID.String(),
+		sub.StartDate,
+		sub.EndDate,
+	}
+}
+
+func subscriptionsResult(subs []models.SubscriptionResponse) result {
+	r := result{value: subs, header: subscriptionHeader, rows: [][]string{}}
+	if subs == nil {
+		r.value = []models.SubscriptionResponse{}
+	}
+	for _, sub := range subs {
+		r.rows = append(r.rows, subscriptionRow(sub))
+	}
+	return r
+}
+
+func adminSubscriptionsResult(subs []models.AdminSubscriptionResponse) result {
+	r := result{value: subs, header: append(append([]string{}, subscriptionHeader...), "DELETED"), rows: [][]string{}}
+	if subs == nil {
+		r.value = []models.AdminSubscriptionResponse{}
+	}
+	for _, sub := range subs {
+		r.rows = append(r.rows, []string{
+			strconv.FormatUint(sub.ID, 10),
+			sub.ServiceName,
+			strconv.Itoa(sub.Price),
+			sub.UserID.String(),
+			sub.StartDate,
+			sub.EndDate,
+			strconv.FormatBool(sub.Deleted),
+		})
+	}
+	return r
+}
+
+func deletedSubscriptionsResult(subs []models.DeletedSubscriptionResponse) result {
+	r := result{value: subs, header: append(append([]string{}, subscriptionHeader...), "DELETED AT"), rows: [][]string{}}
+	if subs == nil {
+		r.value = []models.DeletedSubscriptionResponse{}
+	}
+	for _, sub := range subs {
+		r.rows = append(r.rows, append(subscriptionRow(sub.SubscriptionResponse), sub.DeletedAt.Format(time.RFC3339)))
+	}
+	return r
+}
+
+func auditEventsResult(events []models.AuditEvent) result {
+	r := result{value: events, header: []string{"ID", "SUBSCRIPTION", "ACTION", "ACTOR", "REQUEST", "AT"}, rows: [][]string{}}
+	if events == nil {
+		r.value = []models.AuditEvent{}
+	}
+	for _, event := range events {
+		r.rows = append(r.rows, []string{
+			strconv.FormatUint(event.ID, 10),
+			strconv.FormatUint(event.SubscriptionID, 10),
+			string(event.Action),
+			event.Actor,
+			event.RequestID,
+			event.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return r
+}
+
+func importReportResult(report models.ImportReport) result {
+	r := result{value: report, header: []string{"LINE", "STATUS", "ID", "CODE", "DETAIL"}, rows: [][]string{}}
+	for _, row := range report.Rows {
+		id := ""
+		if row.ID != 0 {
+			id = strconv.FormatUint(row.ID, 10)
+		}
+		r.rows = append(r.rows, []string{strconv.Itoa(row.Line), string(row.Status), id, row.Code, row.Detail})
+	}
+	return r
+}
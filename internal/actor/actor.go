@@ -0,0 +1,55 @@
+// Package actor identifies who makes a change, so repositories can record it.
+//
+// Requests are made on behalf of the subscription's user unless the admin middleware
+// authenticated them with the API key; background jobs act as the system.
+package actor
+
+import "context"
+
+// Kind is the kind of actor making a change
+type Kind string
+
+const (
+	KindUser   Kind = "user"    // a request to the public API
+	KindAPIKey Kind = "api_key" // a request authenticated with the admin secret key
+	KindSystem Kind = "system"  // a background job
+)
+
+// Actor is who makes a change
+type Actor struct {
+	Kind Kind
+	Name string // optional, e.g. the name of a background job
+}
+
+var (
+	User   = Actor{Kind: KindUser}
+	APIKey = Actor{Kind: KindAPIKey}
+)
+
+// System returns the actor of the background job called name
+func System(name string) Actor {
+	return Actor{Kind: KindSystem, Name: name}
+}
+
+// String returns the kind, followed by the name if any (e.g. "system:retention")
+func (a Actor) String() string {
+	if a.Name == "" {
+		return string(a.Kind)
+	}
+	return string(a.Kind) + ":" + a.Name
+}
+
+type ctxKey struct{}
+
+// With returns a copy of ctx carrying a
+func With(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, ctxKey{}, a)
+}
+
+// FromContext returns the actor stored in ctx, or User if there is none
+func FromContext(ctx context.Context) Actor {
+	if a, ok := ctx.Value(ctxKey{}).(Actor); ok {
+		return a
+	}
+	return User
+}
@@ -0,0 +1,107 @@
+// Package apidocs serves the API documentation for the configured public base URL.
+//
+// Key behaviors:
+//   - Rewrites the host, base path and scheme of the swag-generated Swagger 2.0 spec (docs package) at runtime
+//   - Converts that spec to an OpenAPI 3.1 document once at startup, served at /openapi.json, listing
+//     both representations of error responses (legacy JSON and problem details) where Swagger 2.0 has one
+//   - Serves the Swagger UI pointing at the rewritten spec
+package apidocs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Joshdike/subscriptions_aggregator/docs"
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+// OpenAPIVersion is the version of the document served at /openapi.json
+const OpenAPIVersion = "3.1.0"
+
+type Docs struct {
+	baseURL *url.URL
+	openapi []byte
+}
+
+// New applies baseURL to the generated spec and builds the OpenAPI 3.1 document
+func New(baseURL *url.URL) (*Docs, error) {
+	basePath := strings.TrimRight(baseURL.Path, "/")
+
+	// Rewrite the generated Swagger 2.0 spec for the public URL
+	docs.SwaggerInfo.Host = baseURL.Host
+	docs.SwaggerInfo.Schemes = []string{baseURL.Scheme}
+	docs.SwaggerInfo.BasePath = basePath
+	if basePath == "" {
+		docs.SwaggerInfo.BasePath = "/"
+	}
+
+	// Convert it to OpenAPI 3 and declare it as 3.1, which is a superset of what swag generates
+	var doc2 openapi2.T
+	if err := json.Unmarshal([]byte(docs.SwaggerInfo.ReadDoc()), &doc2); err != nil {
+		return nil, fmt.Errorf("error parsing swagger spec: %w", err)
+	}
+	doc3, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("error converting swagger spec to openapi 3: %w", err)
+	}
+	doc3.OpenAPI = OpenAPIVersion
+	negotiateErrors(doc3)
+	doc3.Servers = openapi3.Servers{{URL: strings.TrimRight(baseURL.String(), "/")}}
+
+	openapi, err := json.Marshal(doc3)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding openapi document: %w", err)
+	}
+
+	return &Docs{baseURL: baseURL, openapi: openapi}, nil
+}
+
+// Error representations, negotiated with the Accept header by utils.WriteError
+const (
+	legacyErrorSchema  = "#/components/schemas/utils.ErrorResponse"
+	problemErrorSchema = "#/components/schemas/problem.Problem"
+	problemContentType = "application/problem+json"
+)
+
+// negotiateErrors adds the problem details representation to the error responses documented
+// with the legacy utils.ErrorResponse, which Swagger 2.0 cannot list alongside it
+func negotiateErrors(doc *openapi3.T) {
+	for _, item := range doc.Paths.Map() {
+		for _, op := range item.Operations() {
+			for _, resp := range op.Responses.Map() {
+				if resp.Value == nil {
+					continue
+				}
+				legacy := resp.Value.Content.Get("application/json")
+				if legacy == nil || legacy.Schema == nil || legacy.Schema.Ref != legacyErrorSchema {
+					continue
+				}
+				resp.Value.Content[problemContentType] = openapi3.NewMediaType().WithSchemaRef(openapi3.NewSchemaRef(problemErrorSchema, nil))
+			}
+		}
+	}
+}
+
+// OpenAPI godoc
+// @Summary OpenAPI 3.1 document
+// @Description Returns the OpenAPI 3.1 description of this API, with the configured public base URL as server
+// @Tags docs
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /openapi.json [get]
+func (d *Docs) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(d.openapi)
+}
+
+// SwaggerUI returns the Swagger UI handler, loading the spec from the public base URL
+func (d *Docs) SwaggerUI() http.HandlerFunc {
+	return httpSwagger.Handler(httpSwagger.URL(d.baseURL.JoinPath("swagger", "doc.json").String()))
+}
@@ -0,0 +1,41 @@
+package apidocs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestOpenAPIListsBothErrorRepresentations(t *testing.T) {
+	baseURL, _ := url.Parse("https://api.example.com/subs")
+	d, err := New(baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	d.OpenAPI(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Ref string `json:"$ref"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	content := doc.Paths["/v1/subscriptions/{id}"]["get"].Responses["404"].Content
+	if got := content["application/json"].Schema.Ref; got != legacyErrorSchema {
+		t.Errorf("application/json schema = %q, want %q", got, legacyErrorSchema)
+	}
+	if got := content[problemContentType].Schema.Ref; got != problemErrorSchema {
+		t.Errorf("%s schema = %q, want %q", problemContentType, got, problemErrorSchema)
+	}
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lru is a size-bounded least-recently-used cache whose entries expire after a TTL.
+// Entries are indexed by the user they belong to so all of a user's entries can be dropped at once.
+type lru struct {
+	mu     sync.Mutex
+	size   int
+	ttl    time.Duration
+	now    func() time.Time
+	ll     *list.List // front is the most recently used
+	items  map[string]*list.Element
+	byUser map[uuid.UUID]map[string]struct{}
+
+	// generation is incremented by every invalidation, so loads started before it are not stored
+	generation uint64
+}
+
+type entry struct {
+	key     string
+	user    uuid.UUID
+	value   any
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:   size,
+		ttl:    ttl,
+		now:    time.Now,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+		byUser: make(map[uuid.UUID]map[string]struct{}),
+	}
+}
+
+// get returns the unexpired value stored under key
+func (c *lru) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if c.now().After(e.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// gen returns the current invalidation generation, to be passed to add after a load
+func (c *lru) gen() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// add stores value under key for user, evicting the least recently used entry if the cache is
+// full. Values loaded before an invalidation (generation changed since gen) are not stored.
+func (c *lru) add(key string, user uuid.UUID, value any, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	el := c.ll.PushFront(&entry{key: key, user: user, value: value, expires: c.now().Add(c.ttl)})
+	c.items[key] = el
+	if c.byUser[user] == nil {
+		c.byUser[user] = make(map[string]struct{})
+	}
+	c.byUser[user][key] = struct{}{}
+
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// invalidateUser drops every entry of user
+func (c *lru) invalidateUser(user uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key := range c.byUser[user] {
+		c.removeElement(c.items[key])
+	}
+}
+
+// invalidateKey drops the entry stored under key
+func (c *lru) invalidateKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// invalidateAll drops every entry
+func (c *lru) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.ll.Init()
+	clear(c.items)
+	clear(c.byUser)
+}
+
+// len returns the number of stored entries, expired ones included
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// removeElement unlinks el from the list and the indexes. The caller must hold the lock.
+func (c *lru) removeElement(el *list.Element) {
+	e := el.Value.(*entry)
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	if keys := c.byUser[e.user]; keys != nil {
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(c.byUser, e.user)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Package cache provides a read-through caching decorator for repository.SubscriptionRepository.
+//
+// Key behaviors:
+//   - GetByID, GetByUserID and GetCost results are kept in a size-bounded LRU and expire after a TTL;
+//     errors (including not found) are never cached
+//   - Create, Update, Delete, Restore, Purge and RenewOrExtend drop every cached entry of the affected user
+//     (every entry when the user cannot be found, e.g. for a purged subscription)
+//   - Concurrent misses on the same key are collapsed into a single repository call (singleflight);
+//     a caller whose context is canceled stops waiting without canceling the shared call
+//   - Results loaded while an invalidation happened are returned but not stored
+//   - Hits and misses are reported per method to an optional Recorder
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	er "github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+// Recorder receives the outcome of every cached lookup
+type Recorder interface {
+	ObserveCache(method string, hit bool)
+}
+
+// Options configures the cache
+type Options struct {
+	Size     int           // maximum number of entries
+	TTL      time.Duration // lifetime of an entry
+	Recorder Recorder      // optional
+}
+
+// Repository decorates a SubscriptionRepository with a read-through cache
+type Repository struct {
+	next     repository.SubscriptionRepository
+	cache    *lru
+	group    singleflight.Group
+	recorder Recorder
+}
+
+var _ repository.SubscriptionRepository = (*Repository)(nil)
+
+func NewRepository(next repository.SubscriptionRepository, opts Options) *Repository {
+	return &Repository{
+		next:     next,
+		cache:    newLRU(opts.Size, opts.TTL),
+		recorder: opts.Recorder,
+	}
+}
+
+func idKey(id uint64) string {
+	return "id:" + strconv.FormatUint(id, 10)
+}
+
+func userKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+func costKey(userID uuid.UUID, serviceName string, start, end time.Time) string {
+	return fmt.Sprintf("cost:%s:%d:%d:%s", userID, start.Unix(), end.Unix(), serviceName)
+}
+
+// load returns the value cached under key, or loads it with fn (once for concurrent callers)
+// and caches it under the user fn reports
+func (r *Repository) load(ctx context.Context, method, key string, fn func(ctx context.Context) (any, uuid.UUID, error)) (any, error) {
+	if value, ok := r.cache.get(key); ok {
+		r.observe(method, true)
+		return value, nil
+	}
+	r.observe(method, false)
+
+	ch := r.group.DoChan(key, func() (any, error) {
+		generation := r.cache.gen()
+		// The call is shared by every waiting caller, so it must not be canceled with the first one
+		value, user, err := fn(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		r.cache.add(key, user, value, generation)
+		return value, nil
+	})
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Repository) observe(method string, hit bool) {
+	if r.recorder != nil {
+		r.recorder.ObserveCache(method, hit)
+	}
+}
+
+func (r *Repository) GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error) {
+	value, err := r.load(ctx, "GetByID", idKey(id), func(ctx context.Context) (any, uuid.UUID, error) {
+		sub, err := r.next.GetByID(ctx, id)
+		return sub, sub.UserID, err
+	})
+	if err != nil {
+		return models.SubscriptionResponse{}, err
+	}
+	return value.(models.SubscriptionResponse), nil
+}
+
+func (r *Repository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	value, err := r.load(ctx, "GetByUserID", userKey(userID), func(ctx context.Context) (any, uuid.UUID, error) {
+		subs, err := r.next.GetByUserID(ctx, userID)
+		return subs, userID, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Callers get their own copy of the cached slice
+	return slices.Clone(value.([]models.SubscriptionResponse)), nil
+}
+
+func (r *Repository) GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
+	value, err := r.load(ctx, "GetCost", costKey(userID, serviceName, start, end), func(ctx context.Context) (any, uuid.UUID, error) {
+		total, err := r.next.GetCost(ctx, userID, serviceName, start, end)
+		return total, userID, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value.(int), nil
+}
+
+// Create creates the subscription and drops the cached entries of its user
+func (r *Repository) Create(ctx context.Context, sub *models.SubscriptionRequest) (uint64, error) {
+	id, err := r.next.Create(ctx, sub)
+	if err == nil {
+		r.cache.invalidateUser(sub.UserID)
+	}
+	return id, err
+}
+
+// Import imports the rows and drops the cached entries of the users of the created subscriptions
+func (r *Repository) Import(ctx context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+	outcomes, err := r.next.Import(ctx, rows, opts)
+	for i, outcome := range outcomes {
+		if outcome.ID != 0 {
+			r.cache.invalidateUser(rows[i].Request.UserID)
+		}
+	}
+	return outcomes, err
+}
+
+// Delete deletes the subscription and drops the cached entries of its user
+func (r *Repository) Delete(ctx context.Context, id uint64) (bool, error) {
+	user, known := r.userOf(ctx, id)
+	deleted, err := r.next.Delete(ctx, id)
+	if err == nil {
+		r.cache.invalidateKey(idKey(id))
+		if known {
+			r.cache.invalidateUser(user)
+		}
+	}
+	return deleted, err
+}
+
+// Restore restores the subscription and drops the cached entries of its user
+func (r *Repository) Restore(ctx context.Context, id uint64) (bool, error) {
+	restored, err := r.next.Restore(ctx, id)
+	if err == nil {
+		r.invalidateSubscription(ctx, id)
+	}
+	return restored, err
+}
+
+// Purge removes the subscription and drops the cached entries of its user. Purged subscriptions
+// are deleted, so their user is rarely known (GetByID skips them) and every entry is dropped then:
+// cached costs count deleted subscriptions.
+func (r *Repository) Purge(ctx context.Context, id uint64) error {
+	user, known := r.userOf(ctx, id)
+	err := r.next.Purge(ctx, id)
+	if err == nil {
+		r.cache.invalidateKey(idKey(id))
+		if known {
+			r.cache.invalidateUser(user)
+		} else {
+			r.cache.invalidateAll()
+		}
+	}
+	return err
+}
+
+// invalidateSubscription drops the cached entries of the user of the subscription with the given id,
+// or every entry if it cannot be found
+func (r *Repository) invalidateSubscription(ctx context.Context, id uint64) {
+	if user, known := r.userOf(ctx, id); known {
+		r.cache.invalidateUser(user)
+	} else {
+		r.cache.invalidateAll()
+	}
+}
+
+// RenewOrExtend renews the subscription and drops the cached entries of its user
+func (r *Repository) RenewOrExtend(ctx context.Context, id uint64) (uint64, error) {
+	newID, err := r.next.RenewOrExtend(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	// The renewed subscription may be deleted, the new one never is
+	r.invalidateSubscription(ctx, newID)
+	return newID, nil
+}
+
+// Update updates the subscription and drops the cached entries of its user. A version mismatch
+// drops the cached subscription too, in case another process changed it.
+func (r *Repository) Update(ctx context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+	sub, err := r.next.Update(ctx, id, version, patch)
+	switch {
+	case err == nil:
+		r.cache.invalidateUser(sub.UserID)
+	case errors.Is(err, er.ErrVersionMismatch):
+		r.cache.invalidateKey(idKey(id))
+	}
+	return sub, err
+}
+
+// userOf returns the user of the subscription with the given id, from the cache or the
+// repository, and false if it cannot be found
+func (r *Repository) userOf(ctx context.Context, id uint64) (uuid.UUID, bool) {
+	if value, ok := r.cache.get(idKey(id)); ok {
+		return value.(models.SubscriptionResponse).UserID, true
+	}
+	sub, err := r.next.GetByID(ctx, id)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return sub.UserID, true
+}
+
+// GetAll is not cached: the admin listing must reflect every change immediately
+func (r *Repository) GetAll(ctx context.Context) ([]models.AdminSubscriptionResponse, error) {
+	return r.next.GetAll(ctx)
+}
+
+// GetDeletedByUserID is not cached: the trash is rarely listed
+func (r *Repository) GetDeletedByUserID(ctx context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+	return r.next.GetDeletedByUserID(ctx, userID)
+}
+
+// GetByUserIDs is not cached: its callers (GraphQL loaders) already batch and cache per request
+func (r *Repository) GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	return r.next.GetByUserIDs(ctx, userIDs)
+}
+
+// GetHistory is not cached: the audit log must show every change at once
+func (r *Repository) GetHistory(ctx context.Context, id uint64) ([]models.AuditEvent, error) {
+	return r.next.GetHistory(ctx, id)
+}
+
+// SearchHistory is not cached, like GetHistory
+func (r *Repository) SearchHistory(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	return r.next.SearchHistory(ctx, filter)
+}
+
+func (r *Repository) OverlapCheck(ctx context.Context, sub models.Subscription) error {
+	return r.next.OverlapCheck(ctx, sub)
+}
+
+// Len returns the number of cached entries
+func (r *Repository) Len() int {
+	return r.cache.len()
+}
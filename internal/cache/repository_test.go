@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/memory"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/repotest"
+	"github.com/google/uuid"
+)
+
+// TestContract checks that caching does not change the repository behavior
+func TestContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.SubscriptionRepository {
+		return NewRepository(memory.NewSubscriptionRepo(), Options{Size: 100, TTL: time.Minute})
+	})
+}
+
+type recorder struct {
+	mu           sync.Mutex
+	hits, misses map[string]int
+}
+
+func (r *recorder) ObserveCache(method string, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if hit {
+		r.hits[method]++
+	} else {
+		r.misses[method]++
+	}
+}
+
+var user = uuid.MustParse("0b6f2a4e-1c3d-4e5f-8a9b-0c1d2e3f4a5b")
+
+func setup(t *testing.T, opts Options) (*Repository, *repotest.Counting, uint64) {
+	t.Helper()
+	next := repotest.NewCounting(memory.NewSubscriptionRepo())
+	id, err := next.Create(context.Background(), &models.SubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: user, StartDate: "07-2025"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRepository(next, opts), next, id
+}
+
+func TestReadThrough(t *testing.T) {
+	rec := &recorder{hits: map[string]int{}, misses: map[string]int{}}
+	repo, next, id := setup(t, Options{Size: 100, TTL: time.Minute, Recorder: rec})
+	ctx := context.Background()
+	from, to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	for range 3 {
+		if _, err := repo.GetByID(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.GetByUserID(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if total, err := repo.GetCost(ctx, user, "Yandex Plus", from, to); err != nil || total != 400 {
+			t.Fatalf("GetCost = %d, %v", total, err)
+		}
+	}
+
+	if next.ByID.Load() != 1 || next.ByUser.Load() != 1 || next.Cost.Load() != 1 {
+		t.Errorf("repository calls = %d/%d/%d, want one per method", next.ByID.Load(), next.ByUser.Load(), next.Cost.Load())
+	}
+	for _, method := range []string{"GetByID", "GetByUserID", "GetCost"} {
+		if rec.hits[method] != 2 || rec.misses[method] != 1 {
+			t.Errorf("%s: hits/misses = %d/%d, want 2/1", method, rec.hits[method], rec.misses[method])
+		}
+	}
+
+	// Not found is not cached
+	for range 2 {
+		if _, err := repo.GetByID(ctx, 999); err == nil {
+			t.Fatal("GetByID(999) succeeded")
+		}
+	}
+	if next.ByID.Load() != 3 {
+		t.Errorf("repository GetByID calls = %d, want errors to reach the repository each time", next.ByID.Load())
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	repo, next, id := setup(t, Options{Size: 100, TTL: time.Minute})
+	ctx := context.Background()
+
+	list := func() int {
+		t.Helper()
+		subs, err := repo.GetByUserID(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(subs)
+	}
+
+	if n := list(); n != 1 {
+		t.Fatalf("listed %d subscriptions, want 1", n)
+	}
+
+	// Create
+	if _, err := repo.Create(ctx, &models.SubscriptionRequest{ServiceName: "Kinopoisk", Price: 299, UserID: user, StartDate: "07-2025"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 2 {
+		t.Errorf("after Create listed %d subscriptions, want 2", n)
+	}
+
+	// RenewOrExtend
+	if _, err := repo.RenewOrExtend(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 3 {
+		t.Errorf("after RenewOrExtend listed %d subscriptions, want 3", n)
+	}
+
+	// Delete
+	if _, err := repo.GetByID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 2 {
+		t.Errorf("after Delete listed %d subscriptions, want 2", n)
+	}
+	if _, err := repo.GetByID(ctx, id); err == nil {
+		t.Error("GetByID returned the deleted subscription from the cache")
+	}
+	if calls := next.ByUser.Load(); calls != 4 {
+		t.Errorf("repository GetByUserID calls = %d, want 4 (one per invalidation)", calls)
+	}
+
+	// Restore
+	if _, err := repo.Restore(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 3 {
+		t.Errorf("after Restore listed %d subscriptions, want 3", n)
+	}
+	restored, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID(restored): %v", err)
+	}
+
+	// Update, including a stale version refreshing the cached subscription
+	price := 450
+	if _, err := next.Update(ctx, id, restored.Version, models.SubscriptionPatch{Price: &price}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Update(ctx, id, restored.Version, models.SubscriptionPatch{Price: &price}); err == nil {
+		t.Fatal("Update at a stale version succeeded")
+	}
+	current, err := repo.GetByID(ctx, id)
+	if err != nil || current.Version != restored.Version+1 {
+		t.Fatalf("GetByID after a version mismatch = version %d, %v; want the current version %d", current.Version, err, restored.Version+1)
+	}
+	price = 500
+	if _, err := repo.Update(ctx, id, current.Version, models.SubscriptionPatch{Price: &price}); err != nil {
+		t.Fatal(err)
+	}
+	if sub, err := repo.GetByID(ctx, id); err != nil || sub.Price != 500 {
+		t.Errorf("GetByID after Update = price %d, %v; want 500", sub.Price, err)
+	}
+}
+
+func TestPurgeDropsCachedCost(t *testing.T) {
+	repo, _, id := setup(t, Options{Size: 100, TTL: time.Minute})
+	ctx := context.Background()
+	from, to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	// Deleted subscriptions still count in costs until they are purged
+	if total, err := repo.GetCost(ctx, user, "Yandex Plus", from, to); err != nil || total != 400 {
+		t.Fatalf("GetCost after Delete = %d, %v; want 400", total, err)
+	}
+	if err := repo.Purge(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if total, err := repo.GetCost(ctx, user, "Yandex Plus", from, to); err != nil || total != 0 {
+		t.Errorf("GetCost after Purge = %d, %v; want 0", total, err)
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	repo, next, _ := setup(t, Options{Size: 100, TTL: time.Minute})
+	next.Gate = make(chan struct{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.GetByUserID(context.Background(), user); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let the callers pile up on the first load, then release it
+	for next.ByUser.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(next.Gate)
+	wg.Wait()
+
+	if calls := next.ByUser.Load(); calls != 1 {
+		t.Errorf("repository calls = %d, want concurrent misses collapsed into 1", calls)
+	}
+}
+
+func TestCanceledCallerStopsWaiting(t *testing.T) {
+	repo, next, _ := setup(t, Options{Size: 100, TTL: time.Minute})
+	next.Gate = make(chan struct{})
+	defer close(next.Gate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := repo.GetByUserID(ctx, user); err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want the caller's context error", err)
+	}
+}
+
+func TestInvalidationDuringLoadIsNotCached(t *testing.T) {
+	repo, next, _ := setup(t, Options{Size: 100, TTL: time.Minute})
+	next.Gate = make(chan struct{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := repo.GetByUserID(context.Background(), user); err != nil {
+			t.Error(err)
+		}
+	}()
+	for next.ByUser.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// A write lands while the (now stale) read is in flight
+	repo.cache.invalidateUser(user)
+	close(next.Gate)
+	<-done
+
+	if repo.Len() != 0 {
+		t.Errorf("cached %d entries, want the stale load dropped", repo.Len())
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.add("a", user, 1, c.gen())
+	c.add("b", user, 2, c.gen())
+	c.get("a") // a is now more recent than b
+	c.add("c", user, 3, c.gen())
+
+	if _, ok := c.get("b"); ok {
+		t.Error("the least recently used entry was not evicted")
+	}
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("get(a) = %v, %v", v, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get("a"); ok {
+		t.Error("expired entry returned")
+	}
+
+	c.invalidateUser(user)
+	if c.len() != 0 || len(c.byUser) != 0 {
+		t.Errorf("after invalidateUser: %d entries, %d users indexed", c.len(), len(c.byUser))
+	}
+}
@@ -0,0 +1,240 @@
+// Package config loads the typed application configuration.
+//
+// Sources, from lowest to highest precedence:
+//  1. defaults (the `default` struct tags below)
+//  2. an optional YAML (.yaml/.yml) or TOML (.toml) file given by --config or CONFIG_FILE
+//  3. environment variables, including ones from an optional .env file
+//     (variables already set in the environment win over .env)
+//  4. command-line flags
+//
+// Every problem (unparsable values, missing required settings, out of range values) is
+// collected and reported at once by Load.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/tracing"
+)
+
+// Config is the complete application configuration. Each leaf field declares its file key
+// (yaml/toml tags), environment variable (env), command-line flag (flag), default value and
+// whether it is a secret to be redacted when printed.
+type Config struct {
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	GRPC        GRPCConfig        `yaml:"grpc" toml:"grpc"`
+	Public      PublicConfig      `yaml:"public" toml:"public"`
+	API         APIConfig         `yaml:"api" toml:"api"`
+	GraphQL     GraphQLConfig     `yaml:"graphql" toml:"graphql"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	Cache       CacheConfig       `yaml:"cache" toml:"cache"`
+	Trash       TrashConfig       `yaml:"trash" toml:"trash"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	Admin       AdminConfig       `yaml:"admin" toml:"admin"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+	Health      HealthConfig      `yaml:"health" toml:"health"`
+
+	// File is the configuration file that was loaded, if any
+	File string `yaml:"-" toml:"-" env:"CONFIG_FILE" flag:"config" usage:"path to a YAML or TOML configuration file"`
+	// PrintConfig asks the binary to print the effective configuration (secrets redacted) and exit
+	PrintConfig bool `yaml:"-" toml:"-" flag:"print-config" usage:"print the effective configuration with secrets redacted and exit"`
+}
+
+type ServerConfig struct {
+	Port              int           `yaml:"port" toml:"port" env:"PORT" flag:"port" default:"8080" usage:"HTTP port to listen on"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"http-read-timeout" default:"10s" usage:"maximum duration for reading a whole request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"http-read-header-timeout" default:"5s" usage:"maximum duration for reading request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"http-write-timeout" default:"15s" usage:"maximum duration for writing a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" flag:"http-idle-timeout" default:"60s" usage:"keep-alive idle timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" default:"20s" usage:"deadline for draining requests and background jobs on shutdown"`
+}
+
+type GRPCConfig struct {
+	Port int `yaml:"port" toml:"port" env:"GRPC_PORT" flag:"grpc-port" default:"9090" usage:"gRPC port to listen on"`
+}
+
+type PublicConfig struct {
+	BaseURL string `yaml:"base_url" toml:"base_url" env:"PUBLIC_BASE_URL" flag:"public-base-url" default:"http://localhost:8080" usage:"public URL of the API (scheme, host and optional path prefix), used in the API docs"`
+}
+
+// URL returns the parsed public base URL. The configuration must have been validated.
+func (p PublicConfig) URL() *url.URL {
+	u, _ := url.Parse(p.BaseURL)
+	return u
+}
+
+// PathPrefix returns the path of the public base URL without trailing slash ("" when served at the root)
+func (p PublicConfig) PathPrefix() string {
+	return strings.TrimRight(p.URL().Path, "/")
+}
+
+type APIConfig struct {
+	LegacyDeprecatedAt time.Time `yaml:"legacy_deprecated_at" toml:"legacy_deprecated_at" env:"API_LEGACY_DEPRECATED_AT" flag:"api-legacy-deprecated-at" default:"2025-09-01" usage:"date (YYYY-MM-DD) the unversioned routes were deprecated, sent in the Deprecation header"`
+	LegacySunset       time.Time `yaml:"legacy_sunset" toml:"legacy_sunset" env:"API_LEGACY_SUNSET" flag:"api-legacy-sunset" default:"2026-12-31" usage:"date (YYYY-MM-DD) the unversioned routes will be removed, sent in the Sunset header"`
+	DefaultLanguage    string    `yaml:"default_language" toml:"default_language" env:"API_DEFAULT_LANGUAGE" flag:"api-default-language" default:"en" usage:"language of messages (en or ru) for requests without lang parameter or matching Accept-Language"`
+}
+
+// Language returns the default message language. The configuration must have been validated.
+func (a APIConfig) Language() i18n.Lang {
+	lang, _ := i18n.ParseLang(a.DefaultLanguage)
+	return lang
+}
+
+type GraphQLConfig struct {
+	MaxDepth      int `yaml:"max_depth" toml:"max_depth" env:"GRAPHQL_MAX_DEPTH" flag:"graphql-max-depth" default:"8" usage:"maximum depth of a GraphQL query"`
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity" env:"GRAPHQL_MAX_COMPLEXITY" flag:"graphql-max-complexity" default:"1000" usage:"maximum estimated complexity of a GraphQL query"`
+}
+
+type DatabaseConfig struct {
+	URL                  string        `yaml:"url" toml:"url" env:"DATABASE_URL" flag:"database-url" secret:"true" usage:"PostgreSQL connection string"`
+	ReplicaURLs          []string      `yaml:"replica_urls" toml:"replica_urls" env:"DATABASE_REPLICA_URLS" flag:"database-replica-urls" secret:"true" usage:"comma-separated connection strings of read replicas serving the query methods"`
+	ReadYourWritesWindow time.Duration `yaml:"read_your_writes_window" toml:"read_your_writes_window" env:"DATABASE_READ_YOUR_WRITES_WINDOW" flag:"database-read-your-writes-window" default:"5s" usage:"how long reads about a just written user or subscription go to the primary (only through the instance that wrote it)"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" toml:"replica_check_interval" env:"DATABASE_REPLICA_CHECK_INTERVAL" flag:"database-replica-check-interval" default:"10s" usage:"interval between replica health checks"`
+}
+
+type CacheConfig struct {
+	Enabled bool          `yaml:"enabled" toml:"enabled" env:"CACHE_ENABLED" flag:"cache-enabled" default:"false" usage:"cache subscription reads in memory (only safe with a single instance)"`
+	Size    int           `yaml:"size" toml:"size" env:"CACHE_SIZE" flag:"cache-size" default:"10000" usage:"maximum number of cached entries"`
+	TTL     time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL" flag:"cache-ttl" default:"1m" usage:"lifetime of a cached entry"`
+}
+
+type TrashConfig struct {
+	RetentionDays int           `yaml:"retention_days" toml:"retention_days" env:"TRASH_RETENTION_DAYS" flag:"trash-retention-days" default:"0" usage:"days soft-deleted subscriptions are kept before being purged (0 keeps them forever and disables the retention job)"`
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval" env:"TRASH_PURGE_INTERVAL" flag:"trash-purge-interval" default:"1h" usage:"interval between runs of the trash retention job"`
+}
+
+type IdempotencyConfig struct {
+	TTL             time.Duration `yaml:"ttl" toml:"ttl" env:"IDEMPOTENCY_TTL" flag:"idempotency-ttl" default:"24h" usage:"how long responses to requests with an Idempotency-Key are replayed to their retries"`
+	LockTimeout     time.Duration `yaml:"lock_timeout" toml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT" flag:"idempotency-lock-timeout" default:"1m" usage:"how long a request holds its Idempotency-Key before a retry may run it again"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" toml:"cleanup_interval" env:"IDEMPOTENCY_CLEANUP_INTERVAL" flag:"idempotency-cleanup-interval" default:"1h" usage:"interval between deletions of expired idempotency keys"`
+	MaxBodyBytes    int64         `yaml:"max_body_bytes" toml:"max_body_bytes" env:"IDEMPOTENCY_MAX_BODY_BYTES" flag:"idempotency-max-body-bytes" default:"1048576" usage:"largest request body read, and response stored, for a request with an Idempotency-Key"`
+}
+
+type AdminConfig struct {
+	SecretKey string `yaml:"secret_key" toml:"secret_key" env:"SECRET_KEY" flag:"secret-key" secret:"true" usage:"admin key expected in the secret-key header"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" default:"info" usage:"log level: debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format" default:"json" usage:"log format: json or text"`
+}
+
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" default:"none" usage:"span exporter: none, stdout or otlp"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME" flag:"tracing-service-name" default:"subscriptions-aggregator" usage:"service name reported in traces"`
+}
+
+type HealthConfig struct {
+	Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"HEALTH_TIMEOUT" flag:"health-timeout" default:"2s" usage:"timeout of each readiness check"`
+}
+
+// minSecretKeyLength is the minimum length accepted for the admin secret key
+const minSecretKeyLength = 16
+
+// validate checks the loaded values and returns every problem found
+func (c *Config) validate() []string {
+	var problems []string
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problemf("server.port: must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.GRPC.Port < 1 || c.GRPC.Port > 65535 {
+		problemf("grpc.port: must be between 1 and 65535, got %d", c.GRPC.Port)
+	} else if c.GRPC.Port == c.Server.Port {
+		problemf("grpc.port: must differ from server.port (%d)", c.Server.Port)
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"health.timeout", c.Health.Timeout},
+		{"database.replica_check_interval", c.Database.ReplicaCheckInterval},
+		{"idempotency.ttl", c.Idempotency.TTL},
+		{"idempotency.lock_timeout", c.Idempotency.LockTimeout},
+		{"idempotency.cleanup_interval", c.Idempotency.CleanupInterval},
+	} {
+		if d.value <= 0 {
+			problemf("%s: must be positive, got %s", d.name, d.value)
+		}
+	}
+
+	if u, err := url.Parse(c.Public.BaseURL); err != nil {
+		problemf("public.base_url: %v", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		problemf("public.base_url: must be an absolute http(s) URL without query or fragment, got %q", c.Public.BaseURL)
+	}
+
+	if c.API.LegacySunset.Before(c.API.LegacyDeprecatedAt) {
+		problemf("api.legacy_sunset: must not be before api.legacy_deprecated_at")
+	}
+
+	if c.GraphQL.MaxDepth < 1 {
+		problemf("graphql.max_depth: must be positive, got %d", c.GraphQL.MaxDepth)
+	}
+	if c.GraphQL.MaxComplexity < 1 {
+		problemf("graphql.max_complexity: must be positive, got %d", c.GraphQL.MaxComplexity)
+	}
+
+	if c.Database.URL == "" {
+		problemf("database.url: is required (DATABASE_URL)")
+	}
+	if c.Database.ReadYourWritesWindow < 0 {
+		problemf("database.read_your_writes_window: must not be negative, got %s", c.Database.ReadYourWritesWindow)
+	}
+	if c.Cache.Enabled {
+		if c.Cache.Size < 1 {
+			problemf("cache.size: must be positive, got %d", c.Cache.Size)
+		}
+		if c.Cache.TTL <= 0 {
+			problemf("cache.ttl: must be positive, got %s", c.Cache.TTL)
+		}
+	}
+	if c.Idempotency.MaxBodyBytes < 1 {
+		problemf("idempotency.max_body_bytes: must be positive, got %d", c.Idempotency.MaxBodyBytes)
+	}
+	if c.Trash.RetentionDays < 0 {
+		problemf("trash.retention_days: must not be negative, got %d", c.Trash.RetentionDays)
+	}
+	if c.Trash.RetentionDays > 0 && c.Trash.PurgeInterval <= 0 {
+		problemf("trash.purge_interval: must be positive, got %s", c.Trash.PurgeInterval)
+	}
+	if len(c.Admin.SecretKey) < minSecretKeyLength {
+		problemf("admin.secret_key: must be at least %d characters (SECRET_KEY)", minSecretKeyLength)
+	}
+
+	if _, err := i18n.ParseLang(c.API.DefaultLanguage); err != nil {
+		problemf("api.default_language: %v", err)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		problemf("log.level: %v", err)
+	}
+	if f := strings.ToLower(c.Log.Format); f != logging.FormatJSON && f != logging.FormatText {
+		problemf("log.format: must be %q or %q, got %q", logging.FormatJSON, logging.FormatText, c.Log.Format)
+	}
+
+	switch strings.ToLower(c.Tracing.Exporter) {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		problemf("tracing.exporter: must be one of none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.ServiceName == "" {
+		problemf("tracing.service_name: is required")
+	}
+
+	return problems
+}
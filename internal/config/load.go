@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "[REDACTED]"
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// ValidationError lists every configuration problem found by Load
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s:\n  - %s", ErrInvalidConfig, strings.Join(e.Problems, "\n  - "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// field is a leaf configuration setting discovered from the Config struct tags
+type field struct {
+	path  string // dotted file key, e.g. "server.port"
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+// Load builds the configuration from defaults, the optional config file, the environment
+// (after loading an optional .env file) and the command-line args (without the program name).
+//
+// Returns:
+//   - flag.ErrHelp if -h/--help was requested
+//   - *ValidationError (wrapping ErrInvalidConfig) listing every problem found; the partially
+//     loaded configuration is returned alongside so it can still be printed
+func Load(args []string) (*Config, error) {
+	cfg := &Config{}
+	fields := collectFields(reflect.ValueOf(cfg).Elem(), "")
+	var problems []string
+
+	// Parse the flags first: they decide which config file is read, and are applied last
+	fset := flag.NewFlagSet("subscriptions_aggregator", flag.ContinueOnError)
+	flagValues := make(map[string]*flagValue)
+	for _, f := range fields {
+		name := f.tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		fv := &flagValue{isBool: f.value.Kind() == reflect.Bool}
+		flagValues[name] = fv
+		fset.Var(fv, name, f.tag.Get("usage"))
+	}
+	if err := fset.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// 1. defaults
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := setValue(f.value, def); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid default %q: %v", f.path, def, err))
+			}
+		}
+	}
+
+	// Load the optional .env file; variables already set in the environment are not overridden
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf(".env: %v", err))
+	}
+
+	// 2. configuration file, located by flag or environment
+	file := os.Getenv("CONFIG_FILE")
+	if fv, ok := flagValues["config"]; ok && fv.set {
+		file = fv.raw
+	}
+	if file != "" {
+		if err := decodeFile(file, cfg); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+		}
+	}
+
+	// 3. environment variables
+	for _, f := range fields {
+		name := f.tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(name); ok {
+			if err := setValue(f.value, raw); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid value %q in %s: %v", f.path, raw, name, err))
+			}
+		}
+	}
+
+	// 4. command-line flags that were explicitly set
+	for _, f := range fields {
+		name := f.tag.Get("flag")
+		fv, ok := flagValues[name]
+		if !ok || !fv.set {
+			continue
+		}
+		if err := setValue(f.value, fv.raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid value %q in --%s: %v", f.path, fv.raw, name, err))
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// Print writes the effective configuration as YAML with every secret redacted
+func (c *Config) Print(w io.Writer) error {
+	out := make(map[string]any)
+	for _, f := range collectFields(reflect.ValueOf(c).Elem(), "") {
+		if f.tag.Get("yaml") == "-" {
+			continue
+		}
+
+		var value any = f.value.Interface()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case time.Time:
+			value = v.Format(time.DateOnly)
+		}
+		if f.tag.Get("secret") == "true" && !f.value.IsZero() {
+			value = redactedValue
+		}
+
+		// Nest the value under its section, following the dotted path
+		section := out
+		keys := strings.Split(f.path, ".")
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := section[key].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				section[key] = next
+			}
+			section = next
+		}
+		section[keys[len(keys)-1]] = value
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(out)
+}
+
+// collectFields walks the struct recursively and returns its leaf fields
+func collectFields(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			key = strings.ToLower(sf.Name)
+		}
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			fields = append(fields, collectFields(fv, path)...)
+			continue
+		}
+		fields = append(fields, field{path: path, tag: sf.Tag, value: fv})
+	}
+	return fields
+}
+
+// setValue parses raw into the field according to its type
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Type() == reflect.TypeOf(time.Time{}):
+		t, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// decodeFile reads a YAML or TOML file (chosen by extension) on top of cfg
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys %v", undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported configuration file extension %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	return nil
+}
+
+// flagValue records the raw value of a flag and whether it was set on the command line
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.raw }
+
+func (f *flagValue) Set(s string) error {
+	f.raw = s
+	f.set = true
+	return nil
+}
+
+// IsBoolFlag lets boolean flags be given without a value (e.g. --print-config)
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
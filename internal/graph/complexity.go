@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	// defaultListSize is the number of items assumed for list fields whose size is unknown
+	defaultListSize = 10
+)
+
+// fieldWeights are the extra costs of fields that hit the database on their own,
+// on top of the base cost of 1 per field
+var fieldWeights = map[string]int{
+	"Query.subscription": 5,
+	"User.cost":          10,
+}
+
+// complexity returns the estimated cost of executing the named operation of doc: every field
+// costs 1 plus its weight, and the cost of the selections below a list field is multiplied by
+// the expected number of items (the length of an ids argument, defaultListSize otherwise).
+func complexity(doc *ast.QueryDocument, operationName string, variables map[string]interface{}) int {
+	op := doc.Operations.ForName(operationName)
+	if op == nil {
+		return 0
+	}
+	return selectionSetComplexity(op.SelectionSet, variables)
+}
+
+func selectionSetComplexity(set ast.SelectionSet, variables map[string]interface{}) int {
+	total := 0
+	for _, sel := range set {
+		switch s := sel.(type) {
+		case *ast.Field:
+			total += fieldComplexity(s, variables)
+		case *ast.InlineFragment:
+			total += selectionSetComplexity(s.SelectionSet, variables)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				total += selectionSetComplexity(s.Definition.SelectionSet, variables)
+			}
+		}
+	}
+	return total
+}
+
+func fieldComplexity(f *ast.Field, variables map[string]interface{}) int {
+	cost := 1
+	if f.ObjectDefinition != nil {
+		cost += fieldWeights[f.ObjectDefinition.Name+"."+f.Name]
+	}
+
+	children := selectionSetComplexity(f.SelectionSet, variables)
+	if f.Definition != nil && f.Definition.Type.Elem != nil {
+		children *= listSize(f, variables)
+	}
+	return cost + children
+}
+
+// listSize returns the expected number of items returned by the list field f
+func listSize(f *ast.Field, variables map[string]interface{}) int {
+	if arg := f.Arguments.ForName("ids"); arg != nil {
+		if v, err := arg.Value.Value(variables); err == nil {
+			if ids, ok := v.([]interface{}); ok {
+				return len(ids)
+			}
+		}
+	}
+	return defaultListSize
+}
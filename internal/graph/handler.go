@@ -0,0 +1,140 @@
+// Package graph serves a GraphQL endpoint over subscriptions, users and cost aggregates.
+//
+// Key behaviors:
+//   - Resolvers use the existing SubscriptionRepository
+//   - Subscriptions of every user resolved in a request are batched into GetByUserIDs calls
+//     (dataloader-style), so listing N users does not run N queries
+//   - Queries deeper than MaxDepth or costlier than MaxComplexity are rejected before execution
+package graph
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// Options limits the queries accepted by the handler
+type Options struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+type Handler struct {
+	repo          repository.SubscriptionRepository
+	schema        *graphql.Schema
+	analysis      *ast.Schema // the same schema, used for the complexity analysis
+	maxComplexity int
+}
+
+func New(repo repository.SubscriptionRepository, opts Options) (*Handler, error) {
+	schema, err := graphql.ParseSchema(schemaSDL, &resolver{repo: repo},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(opts.MaxDepth),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing graphql schema: %w", err)
+	}
+	analysis, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: schemaSDL})
+	if err != nil {
+		return nil, fmt.Errorf("error loading graphql schema: %w", err)
+	}
+
+	return &Handler{repo: repo, schema: schema, analysis: analysis, maxComplexity: opts.MaxComplexity}, nil
+}
+
+// Request is a GraphQL request, sent as JSON body (POST) or query parameters (GET)
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// ServeHTTP godoc
+// @Summary GraphQL endpoint
+// @Description Executes a GraphQL query over users, subscriptions and cost aggregates. The schema is available through introspection. Queries exceeding the depth or complexity limits are rejected.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body graph.Request true "GraphQL request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /graphql [post]
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeRequest(r)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, &Error{Message: err.Error(), Code: "BAD_REQUEST"})
+		return
+	}
+
+	// Reject costly queries before executing them; invalid queries are reported by Exec
+	if doc, errs := gqlparser.LoadQuery(h.analysis, req.Query); len(errs) == 0 {
+		if c := complexity(doc, req.OperationName, req.Variables); c > h.maxComplexity {
+			writeErrors(w, http.StatusOK, &Error{
+				Message: fmt.Sprintf("query complexity %d exceeds the limit of %d", c, h.maxComplexity),
+				Code:    "COMPLEXITY_LIMIT_EXCEEDED",
+			})
+			return
+		}
+	}
+
+	ctx := withLoaders(r.Context(), h.repo)
+	resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// decodeRequest reads the GraphQL request from the query string (GET) or the JSON body
+func decodeRequest(r *http.Request) (Request, error) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return Request{}, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return Request{}, fmt.Errorf("invalid request body: %w", err)
+		}
+	default:
+		return Request{}, fmt.Errorf("method %s is not allowed, use GET or POST", r.Method)
+	}
+
+	if req.Query == "" {
+		return Request{}, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
+
+// writeErrors writes a GraphQL response holding only errors
+func writeErrors(w http.ResponseWriter, status int, errs ...*Error) {
+	type responseError struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	body := struct {
+		Errors []responseError `json:"errors"`
+	}{}
+	for _, e := range errs {
+		body.Errors = append(body.Errors, responseError{Message: e.Message, Extensions: e.Extensions()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
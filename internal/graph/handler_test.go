@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/memory"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/repotest"
+	"github.com/google/uuid"
+)
+
+// newTestRepo returns a repository counting its reads, holding one active subscription of each user
+func newTestRepo(t *testing.T, users ...uuid.UUID) *repotest.Counting {
+	t.Helper()
+	repo := memory.NewSubscriptionRepo()
+	for _, user := range users {
+		_, err := repo.Create(context.Background(), &models.SubscriptionRequest{
+			ServiceName: "Yandex Plus",
+			Price:       400,
+			UserID:      user,
+			StartDate:   month(-1),
+			EndDate:     month(1),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repotest.NewCounting(repo)
+}
+
+// month returns the "MM-YYYY" date of the month offset months from now
+func month(offset int) string {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month()+time.Month(offset), 1, 0, 0, 0, 0, time.UTC).Format("01-2006")
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func execute(t *testing.T, h *Handler, query string, variables map[string]interface{}) response {
+	t.Helper()
+
+	body, _ := json.Marshal(Request{Query: query, Variables: variables})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp
+}
+
+func TestUsersSubscriptionsAreBatched(t *testing.T) {
+	users := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	repo := newTestRepo(t, users...)
+	h, err := New(repo, Options{MaxDepth: 8, MaxComplexity: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := execute(t, h, `query($ids: [ID!]!) {
+		users(ids: $ids) { id monthlyTotal subscriptions { id serviceName price active user { id } } }
+	}`, map[string]interface{}{"ids": []string{users[0].String(), users[1].String(), users[2].String()}})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors: %+v", resp.Errors)
+	}
+
+	var got []struct {
+		ID            string
+		MonthlyTotal  int
+		Subscriptions []struct{ Active bool }
+	}
+	if err := json.Unmarshal(resp.Data["users"], &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].MonthlyTotal != 400 || len(got[2].Subscriptions) != 1 || !got[2].Subscriptions[0].Active {
+		t.Errorf("users = %+v", got)
+	}
+	if n := repo.ByUsers.Load(); n != 1 {
+		t.Errorf("GetByUserIDs called %d times, want 1", n)
+	}
+	if n := repo.ByUser.Load(); n != 0 {
+		t.Errorf("GetByUserID called %d times, want 0", n)
+	}
+}
+
+func TestCostBudgetStatus(t *testing.T) {
+	user := uuid.New()
+	h, err := New(newTestRepo(t, user), Options{MaxDepth: 8, MaxComplexity: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := execute(t, h, fmt.Sprintf(`{
+		user(id: %[1]q) {
+			withBudget: cost(serviceName: "Yandex Plus", from: %[2]q, to: %[3]q, budget: 300) { total budget { limit remaining exceeded } }
+			withoutBudget: cost(serviceName: "Yandex Plus", from: %[2]q, to: %[3]q) { total budget { limit } }
+		}
+	}`, user, month(-1), month(1)), nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors: %+v", resp.Errors)
+	}
+
+	want := `{"withBudget":{"total":400,"budget":{"limit":300,"remaining":-100,"exceeded":true}},"withoutBudget":{"total":400,"budget":null}}`
+	if got := string(resp.Data["user"]); got != want {
+		t.Errorf("user = %s, want %s", got, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	h, err := New(newTestRepo(t, uuid.New()), Options{MaxDepth: 8, MaxComplexity: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := execute(t, h, `{ subscription(id: "42") { id } }`, nil)
+	if len(resp.Errors) > 0 || string(resp.Data["subscription"]) != "null" {
+		t.Errorf("missing subscription: data %s, errors %+v", resp.Data["subscription"], resp.Errors)
+	}
+
+	resp = execute(t, h, `{ user(id: "not-a-uuid") { id } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "BAD_USER_INPUT" {
+		t.Errorf("invalid user id: errors %+v", resp.Errors)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	user := uuid.New()
+	h, err := New(newTestRepo(t, user), Options{MaxDepth: 4, MaxComplexity: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := execute(t, h, fmt.Sprintf(`{ user(id: %q) { subscriptions { user { subscriptions { user { id } } } } } }`, user), nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "depth") {
+		t.Errorf("deep query: errors %+v", resp.Errors)
+	}
+
+	h, err = New(newTestRepo(t, user), Options{MaxDepth: 4, MaxComplexity: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp = execute(t, h, fmt.Sprintf(`{ user(id: %q) { subscriptions { id serviceName price startDate endDate active } } }`, user), nil)
+	if len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != "COMPLEXITY_LIMIT_EXCEEDED" {
+		t.Errorf("complex query: errors %+v", resp.Errors)
+	}
+
+	resp = execute(t, h, fmt.Sprintf(`{ user(id: %q) { id monthlyTotal } }`, user), nil)
+	if len(resp.Errors) > 0 {
+		t.Errorf("simple query: errors %+v", resp.Errors)
+	}
+}
@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// loaderWait is how long a loader collects keys before querying the repository
+	loaderWait = 2 * time.Millisecond
+	// loaderMaxBatch dispatches a batch early once it holds that many keys
+	loaderMaxBatch = 100
+)
+
+// subscriptionLoader batches the subscription lookups of one GraphQL request: every user
+// resolved while a batch is open is fetched with a single GetByUserIDs call, and results are
+// cached for the rest of the request.
+type subscriptionLoader struct {
+	repo repository.SubscriptionRepository
+
+	mu      sync.Mutex
+	pending *subscriptionBatch
+	cache   map[uuid.UUID]*subscriptionBatch
+}
+
+type subscriptionBatch struct {
+	keys    []uuid.UUID
+	once    sync.Once
+	done    chan struct{}
+	results map[uuid.UUID][]models.SubscriptionResponse
+	err     error
+}
+
+func newSubscriptionLoader(repo repository.SubscriptionRepository) *subscriptionLoader {
+	return &subscriptionLoader{repo: repo, cache: make(map[uuid.UUID]*subscriptionBatch)}
+}
+
+// Load returns the non-deleted subscriptions of userID, waiting for the batch it joined
+func (l *subscriptionLoader) Load(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	l.mu.Lock()
+	b, ok := l.cache[userID]
+	if !ok {
+		b = l.pending
+		if b == nil {
+			b = &subscriptionBatch{done: make(chan struct{})}
+			l.pending = b
+			time.AfterFunc(loaderWait, func() { l.dispatch(ctx, b) })
+		}
+		b.keys = append(b.keys, userID)
+		l.cache[userID] = b
+		if len(b.keys) >= loaderMaxBatch {
+			l.pending = nil
+			go l.dispatch(ctx, b)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.results[userID], b.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dispatch closes the batch to new keys and fetches it, once
+func (l *subscriptionLoader) dispatch(ctx context.Context, b *subscriptionBatch) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.pending == b {
+			l.pending = nil
+		}
+		l.mu.Unlock()
+
+		b.results, b.err = l.repo.GetByUserIDs(ctx, b.keys)
+		close(b.done)
+	})
+}
+
+type loaderKey struct{}
+
+// withLoaders attaches fresh per-request loaders to ctx
+func withLoaders(ctx context.Context, repo repository.SubscriptionRepository) context.Context {
+	return context.WithValue(ctx, loaderKey{}, newSubscriptionLoader(repo))
+}
+
+// loaderFrom returns the loader attached by withLoaders
+func loaderFrom(ctx context.Context) *subscriptionLoader {
+	return ctx.Value(loaderKey{}).(*subscriptionLoader)
+}
@@ -0,0 +1,229 @@
+package graph
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
+	"github.com/google/uuid"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// maxUsers is the maximum number of IDs accepted by the users query
+const maxUsers = 100
+
+// resolver is the root Query resolver
+type resolver struct {
+	repo repository.SubscriptionRepository
+}
+
+func (r *resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	id, err := parseUserID(args.ID)
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	return &userResolver{repo: r.repo, id: id}, nil
+}
+
+func (r *resolver) Users(ctx context.Context, args struct{ IDs []graphql.ID }) ([]*userResolver, error) {
+	if len(args.IDs) > maxUsers {
+		return nil, toError(ctx, fmt.Errorf("%w: at most %d user ids are allowed", errors.ErrInvalidInput, maxUsers))
+	}
+
+	users := make([]*userResolver, 0, len(args.IDs))
+	for _, raw := range args.IDs {
+		id, err := parseUserID(raw)
+		if err != nil {
+			return nil, toError(ctx, err)
+		}
+		users = append(users, &userResolver{repo: r.repo, id: id})
+	}
+	return users, nil
+}
+
+func (r *resolver) Subscription(ctx context.Context, args struct{ ID graphql.ID }) (*subscriptionResolver, error) {
+	var v validation.Validator
+	id := v.ParseSubscriptionID("id", string(args.ID))
+	if err := v.Err(); err != nil {
+		return nil, toError(ctx, err)
+	}
+
+	sub, err := r.repo.GetByID(ctx, id)
+	if stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	return &subscriptionResolver{repo: r.repo, sub: sub}, nil
+}
+
+type userResolver struct {
+	repo repository.SubscriptionRepository
+	id   uuid.UUID
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return graphql.ID(u.id.String())
+}
+
+func (u *userResolver) Subscriptions(ctx context.Context) ([]*subscriptionResolver, error) {
+	subs, err := loaderFrom(ctx).Load(ctx, u.id)
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+
+	resolvers := make([]*subscriptionResolver, 0, len(subs))
+	for _, sub := range subs {
+		resolvers = append(resolvers, &subscriptionResolver{repo: u.repo, sub: sub})
+	}
+	return resolvers, nil
+}
+
+func (u *userResolver) MonthlyTotal(ctx context.Context) (int32, error) {
+	subs, err := loaderFrom(ctx).Load(ctx, u.id)
+	if err != nil {
+		return 0, toError(ctx, err)
+	}
+
+	total := 0
+	now := time.Now()
+	for _, sub := range subs {
+		if isActive(sub, now) {
+			total += sub.Price
+		}
+	}
+	return int32(total), nil
+}
+
+type costArgs struct {
+	ServiceName string
+	From        string
+	To          string
+	Budget      *int32
+}
+
+func (u *userResolver) Cost(ctx context.Context, args costArgs) (*costResolver, error) {
+	q, err := validation.ParseCostQuery(u.id.String(), args.ServiceName, args.From, args.To)
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+
+	total, err := u.repo.GetCost(ctx, q.UserID, q.ServiceName, q.From, q.To)
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	return &costResolver{args: args, total: int32(total)}, nil
+}
+
+type subscriptionResolver struct {
+	repo repository.SubscriptionRepository
+	sub  models.SubscriptionResponse
+}
+
+func (s *subscriptionResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(s.sub.ID, 10))
+}
+
+func (s *subscriptionResolver) ServiceName() string { return s.sub.ServiceName }
+
+func (s *subscriptionResolver) Price() int32 { return int32(s.sub.Price) }
+
+func (s *subscriptionResolver) StartDate() string { return s.sub.StartDate }
+
+func (s *subscriptionResolver) EndDate() string { return s.sub.EndDate }
+
+func (s *subscriptionResolver) Active() bool { return isActive(s.sub, time.Now()) }
+
+func (s *subscriptionResolver) User() *userResolver {
+	return &userResolver{repo: s.repo, id: s.sub.UserID}
+}
+
+type costResolver struct {
+	args  costArgs
+	total int32
+}
+
+func (c *costResolver) ServiceName() string { return c.args.ServiceName }
+
+func (c *costResolver) From() string { return c.args.From }
+
+func (c *costResolver) To() string { return c.args.To }
+
+func (c *costResolver) Total() int32 { return c.total }
+
+func (c *costResolver) Budget() *budgetResolver {
+	if c.args.Budget == nil {
+		return nil
+	}
+	return &budgetResolver{limit: *c.args.Budget, total: c.total}
+}
+
+type budgetResolver struct {
+	limit, total int32
+}
+
+func (b *budgetResolver) Limit() int32 { return b.limit }
+
+func (b *budgetResolver) Remaining() int32 { return b.limit - b.total }
+
+func (b *budgetResolver) Exceeded() bool { return b.total > b.limit }
+
+// isActive reports whether sub covers now
+func isActive(sub models.SubscriptionResponse, now time.Time) bool {
+	return !now.Before(sub.StartTime) && now.Before(sub.EndTime)
+}
+
+// parseUserID validates a user ID given as a UUID string
+func parseUserID(raw graphql.ID) (uuid.UUID, error) {
+	var v validation.Validator
+	id := v.ParseUserID("id", string(raw))
+	return id, v.Err()
+}
+
+// Error is a GraphQL error carrying a machine-readable code (and the field violations of
+// invalid input) in its extensions
+type Error struct {
+	Message    string
+	Code       string
+	Violations []validation.Violation
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if len(e.Violations) > 0 {
+		ext["violations"] = e.Violations
+	}
+	return ext
+}
+
+// toError maps an error from the repository or argument parsing to a GraphQL error. Like
+// utils.WriteError for HTTP, unknown errors are logged with their chain and hidden from clients.
+func toError(ctx context.Context, err error) error {
+	err = i18n.Localize(err, i18n.FromContext(ctx))
+	var validationErr *validation.Error
+	switch {
+	case stderrors.As(err, &validationErr):
+		return &Error{Message: err.Error(), Code: "BAD_USER_INPUT", Violations: validationErr.Violations}
+	case stderrors.Is(err, errors.ErrInvalidInput):
+		return &Error{Message: err.Error(), Code: "BAD_USER_INPUT"}
+	case stderrors.Is(err, errors.ErrSubscriptionNotFound):
+		return &Error{Message: "no subscription found", Code: "NOT_FOUND"}
+	case stderrors.Is(err, context.Canceled), stderrors.Is(err, context.DeadlineExceeded):
+		return &Error{Message: err.Error(), Code: "CANCELED"}
+	default:
+		slog.ErrorContext(ctx, "graphql resolver failed", slog.Any("error_chain", logging.ErrorChain(err)))
+		return &Error{Message: "internal server error", Code: "INTERNAL"}
+	}
+}
@@ -0,0 +1,79 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	er "github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps an error from the repository or the request parsing to a gRPC status error.
+// Like utils.WriteError for HTTP, details of client errors are returned and anything unknown
+// becomes a generic INTERNAL error (the full chain is logged by the interceptor).
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var validationErr *validation.Error
+	switch {
+	case errors.As(err, &validationErr):
+		return invalidArgument(validationErr)
+	case errors.Is(err, er.ErrInvalidInput), errors.Is(err, er.ErrDecodingJSON):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, er.ErrSubscriptionNotFound):
+		return status.Error(codes.NotFound, "no subscription found")
+	case errors.Is(err, er.ErrAlreadyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, er.ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, er.ErrNotDeleted), errors.Is(err, er.ErrPreconditionRequired):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, er.ErrVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return &internalError{err: err}
+	}
+}
+
+// invalidArgument returns an INVALID_ARGUMENT status with a BadRequest detail listing each violation
+func invalidArgument(err *validation.Error) error {
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Code + ": " + v.Message,
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, err.Error())
+	if detailed, detailsErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); detailsErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// internalError is the INTERNAL status returned to clients; it keeps the original error so
+// the interceptor can log its chain without exposing it
+type internalError struct {
+	err error
+}
+
+func (e *internalError) Error() string { return e.err.Error() }
+
+func (e *internalError) Unwrap() error { return e.err }
+
+func (e *internalError) GRPCStatus() *status.Status {
+	return status.New(codes.Internal, "internal server error")
+}
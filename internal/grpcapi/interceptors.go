@@ -0,0 +1,76 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadataKey is the metadata key carrying the request ID, the gRPC counterpart
+// of the X-Request-ID header
+const RequestIDMetadataKey = "x-request-id"
+
+// RequestIDInterceptor reads the request ID from the incoming metadata, generating one when
+// absent, stores it in the context and sends it back in the response header
+func RequestIDInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadataKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id))
+	return handler(logging.WithRequestID(ctx, id), req)
+}
+
+// LoggerInterceptor logs every call with its status code and duration. Calls failing with
+// INTERNAL are logged at error level with the full wrapped error chain.
+func LoggerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		code := status.Code(err)
+
+		attrs := []slog.Attr{
+			slog.String("method", info.FullMethod),
+			slog.String("code", code.String()),
+			slog.Duration("duration", time.Since(start)),
+		}
+		level := slog.LevelInfo
+		if code == codes.Internal || code == codes.Unknown {
+			level = slog.LevelError
+			attrs = append(attrs, slog.Any("error_chain", logging.ErrorChain(err)))
+		}
+		logger.LogAttrs(ctx, level, "grpc call", attrs...)
+		return resp, err
+	}
+}
+
+// RecoveryInterceptor turns a panic in a handler into an INTERNAL error
+func RecoveryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.ErrorContext(ctx, "grpc handler panicked",
+					slog.String("method", info.FullMethod),
+					slog.Any("panic", p),
+					slog.String("stack", string(debug.Stack())),
+				)
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,154 @@
+// Package grpcapi serves the subscriptions API over gRPC (api/subscriptions/v1), alongside REST.
+//
+// Key behaviors:
+//   - Implemented on top of repository.SubscriptionRepository, like the HTTP handlers
+//   - Maps the errors of internal/pkg/errors to gRPC status codes
+//   - Propagates the x-request-id metadata (generated when absent) and logs every call
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	subscriptionsv1 "github.com/Joshdike/subscriptions_aggregator/api/subscriptions/v1"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
+	"google.golang.org/grpc"
+)
+
+// Service implements subscriptionsv1.SubscriptionServiceServer
+type Service struct {
+	subscriptionsv1.UnimplementedSubscriptionServiceServer
+	repo repository.SubscriptionRepository
+}
+
+func NewService(repo repository.SubscriptionRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// NewServer returns a gRPC server with the subscription service registered and the
+// request ID, logging and recovery interceptors installed
+func NewServer(logger *slog.Logger, svc *Service, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		RequestIDInterceptor,
+		LoggerInterceptor(logger),
+		RecoveryInterceptor(logger),
+	))
+	srv := grpc.NewServer(opts...)
+	subscriptionsv1.RegisterSubscriptionServiceServer(srv, svc)
+	return srv
+}
+
+func (s *Service) CreateSubscription(ctx context.Context, req *subscriptionsv1.CreateSubscriptionRequest) (*subscriptionsv1.CreateSubscriptionResponse, error) {
+	var v validation.Validator
+	userID := v.ParseUserID("user_id", req.GetUserId())
+	if err := v.Err(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	sub := models.SubscriptionRequest{
+		ServiceName: req.GetServiceName(),
+		Price:       clampInt(req.GetPrice()),
+		UserID:      userID,
+		StartDate:   req.GetStartDate(),
+		EndDate:     req.GetEndDate(),
+	}
+	if err := validation.SubscriptionRequest(sub); err != nil {
+		return nil, toStatus(err)
+	}
+
+	id, err := s.repo.Create(ctx, &sub)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &subscriptionsv1.CreateSubscriptionResponse{Id: id}, nil
+}
+
+func (s *Service) GetSubscription(ctx context.Context, req *subscriptionsv1.GetSubscriptionRequest) (*subscriptionsv1.GetSubscriptionResponse, error) {
+	if req.GetId() == 0 {
+		return nil, toStatus(fmt.Errorf("%w: invalid subscription id", errors.ErrInvalidInput))
+	}
+
+	sub, err := s.repo.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &subscriptionsv1.GetSubscriptionResponse{Subscription: toProto(sub)}, nil
+}
+
+func (s *Service) ListUserSubscriptions(ctx context.Context, req *subscriptionsv1.ListUserSubscriptionsRequest) (*subscriptionsv1.ListUserSubscriptionsResponse, error) {
+	var v validation.Validator
+	userID := v.ParseUserID("user_id", req.GetUserId())
+	if err := v.Err(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	subs, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &subscriptionsv1.ListUserSubscriptionsResponse{Subscriptions: make([]*subscriptionsv1.Subscription, 0, len(subs))}
+	for _, sub := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, toProto(sub))
+	}
+	return resp, nil
+}
+
+func (s *Service) RenewSubscription(ctx context.Context, req *subscriptionsv1.RenewSubscriptionRequest) (*subscriptionsv1.RenewSubscriptionResponse, error) {
+	if req.GetId() == 0 {
+		return nil, toStatus(fmt.Errorf("%w: invalid subscription id", errors.ErrInvalidInput))
+	}
+
+	id, err := s.repo.RenewOrExtend(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &subscriptionsv1.RenewSubscriptionResponse{Id: id}, nil
+}
+
+func (s *Service) DeleteSubscription(ctx context.Context, req *subscriptionsv1.DeleteSubscriptionRequest) (*subscriptionsv1.DeleteSubscriptionResponse, error) {
+	if req.GetId() == 0 {
+		return nil, toStatus(fmt.Errorf("%w: invalid subscription id", errors.ErrInvalidInput))
+	}
+
+	deleted, err := s.repo.Delete(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &subscriptionsv1.DeleteSubscriptionResponse{AlreadyDeleted: !deleted}, nil
+}
+
+func (s *Service) GetCost(ctx context.Context, req *subscriptionsv1.GetCostRequest) (*subscriptionsv1.GetCostResponse, error) {
+	q, err := validation.ParseCostQuery(req.GetUserId(), req.GetServiceName(), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	total, err := s.repo.GetCost(ctx, q.UserID, q.ServiceName, q.From, q.To)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &subscriptionsv1.GetCostResponse{TotalCost: int64(total)}, nil
+}
+
+// clampInt converts a protobuf int64 to int, saturating so that out of range values still fail validation
+func clampInt(n int64) int {
+	return int(max(min(n, math.MaxInt32), math.MinInt32))
+}
+
+// toProto converts a repository response to the protobuf message, with "MM-YYYY" dates
+func toProto(sub models.SubscriptionResponse) *subscriptionsv1.Subscription {
+	return &subscriptionsv1.Subscription{
+		Id:          sub.ID,
+		ServiceName: sub.ServiceName,
+		Price:       int64(sub.Price),
+		UserId:      sub.UserID.String(),
+		StartDate:   sub.StartDate,
+		EndDate:     sub.EndDate,
+	}
+}
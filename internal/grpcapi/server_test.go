@@ -0,0 +1,206 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	subscriptionsv1 "github.com/Joshdike/subscriptions_aggregator/api/subscriptions/v1"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/memory"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// failingRepo fails every read of a subscription by ID with err
+type failingRepo struct {
+	repository.SubscriptionRepository
+	err error
+}
+
+func (f failingRepo) GetByID(context.Context, uint64) (models.SubscriptionResponse, error) {
+	return models.SubscriptionResponse{}, f.err
+}
+
+// newTestClient serves repo over an in-memory bufconn listener and returns a connected client
+func newTestClient(t *testing.T, repo repository.SubscriptionRepository) subscriptionsv1.SubscriptionServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), NewService(repo))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return subscriptionsv1.NewSubscriptionServiceClient(conn)
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, memory.NewSubscriptionRepo())
+	user := uuid.NewString()
+
+	created, err := client.CreateSubscription(ctx, &subscriptionsv1.CreateSubscriptionRequest{
+		ServiceName: "Yandex Plus", Price: 400, UserId: user, StartDate: "01-2025", EndDate: "03-2025",
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	got, err := client.GetSubscription(ctx, &subscriptionsv1.GetSubscriptionRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("GetSubscription: %v", err)
+	}
+	sub := got.GetSubscription()
+	if sub.GetServiceName() != "Yandex Plus" || sub.GetPrice() != 400 || sub.GetUserId() != user ||
+		sub.GetStartDate() != "01-2025" || sub.GetEndDate() != "03-2025" {
+		t.Errorf("GetSubscription = %v", sub)
+	}
+
+	list, err := client.ListUserSubscriptions(ctx, &subscriptionsv1.ListUserSubscriptionsRequest{UserId: user})
+	if err != nil {
+		t.Fatalf("ListUserSubscriptions: %v", err)
+	}
+	if len(list.GetSubscriptions()) != 1 {
+		t.Errorf("ListUserSubscriptions returned %d subscriptions, want 1", len(list.GetSubscriptions()))
+	}
+
+	cost, err := client.GetCost(ctx, &subscriptionsv1.GetCostRequest{UserId: user, ServiceName: "Yandex Plus", From: "01-2025", To: "12-2025"})
+	if err != nil {
+		t.Fatalf("GetCost: %v", err)
+	}
+	if cost.GetTotalCost() != 400 {
+		t.Errorf("GetCost = %d, want 400", cost.GetTotalCost())
+	}
+
+	renewed, err := client.RenewSubscription(ctx, &subscriptionsv1.RenewSubscriptionRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("RenewSubscription: %v", err)
+	}
+	if renewed.GetId() == created.GetId() {
+		t.Errorf("RenewSubscription returned the original id %d", renewed.GetId())
+	}
+
+	deleted, err := client.DeleteSubscription(ctx, &subscriptionsv1.DeleteSubscriptionRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+	if deleted.GetAlreadyDeleted() {
+		t.Error("DeleteSubscription reported the subscription as already deleted")
+	}
+	_, err = client.GetSubscription(ctx, &subscriptionsv1.GetSubscriptionRequest{Id: created.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetSubscription after delete: code %v, want NotFound", status.Code(err))
+	}
+
+	again, err := client.DeleteSubscription(ctx, &subscriptionsv1.DeleteSubscriptionRequest{Id: created.GetId()})
+	if err != nil || !again.GetAlreadyDeleted() {
+		t.Errorf("second DeleteSubscription = %v, %v; want already_deleted", again, err)
+	}
+	_, err = client.DeleteSubscription(ctx, &subscriptionsv1.DeleteSubscriptionRequest{Id: 999})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteSubscription(999): code %v, want NotFound", status.Code(err))
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.NewString()
+
+	client := newTestClient(t, memory.NewSubscriptionRepo())
+	if _, err := client.CreateSubscription(ctx, &subscriptionsv1.CreateSubscriptionRequest{
+		ServiceName: "Netflix", Price: 700, UserId: user, StartDate: "01-2025",
+	}); err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"invalid user id", func() error {
+			_, err := client.ListUserSubscriptions(ctx, &subscriptionsv1.ListUserSubscriptionsRequest{UserId: "not-a-uuid"})
+			return err
+		}, codes.InvalidArgument},
+		{"invalid start date", func() error {
+			_, err := client.CreateSubscription(ctx, &subscriptionsv1.CreateSubscriptionRequest{ServiceName: "Netflix", Price: 700, UserId: user, StartDate: "2025-01"})
+			return err
+		}, codes.InvalidArgument},
+		{"zero id", func() error {
+			_, err := client.GetSubscription(ctx, &subscriptionsv1.GetSubscriptionRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"missing service name", func() error {
+			_, err := client.GetCost(ctx, &subscriptionsv1.GetCostRequest{UserId: user, From: "01-2025", To: "02-2025"})
+			return err
+		}, codes.InvalidArgument},
+		{"not found", func() error {
+			_, err := client.RenewSubscription(ctx, &subscriptionsv1.RenewSubscriptionRequest{Id: 42})
+			return err
+		}, codes.NotFound},
+		{"overlap", func() error {
+			_, err := client.CreateSubscription(ctx, &subscriptionsv1.CreateSubscriptionRequest{ServiceName: "Netflix", Price: 700, UserId: user, StartDate: "01-2025"})
+			return err
+		}, codes.AlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call()); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInternalErrorIsNotExposed(t *testing.T) {
+	repo := failingRepo{memory.NewSubscriptionRepo(), fmt.Errorf("error getting subscription: %w", net.ErrClosed)}
+	client := newTestClient(t, repo)
+
+	_, err := client.GetSubscription(context.Background(), &subscriptionsv1.GetSubscriptionRequest{Id: 1})
+	st := status.Convert(err)
+	if st.Code() != codes.Internal {
+		t.Fatalf("code = %v, want Internal", st.Code())
+	}
+	if st.Message() != "internal server error" {
+		t.Errorf("message = %q, the internal error must not be exposed", st.Message())
+	}
+}
+
+func TestRequestIDMetadata(t *testing.T) {
+	client := newTestClient(t, memory.NewSubscriptionRepo())
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDMetadataKey, "req-123")
+	var header metadata.MD
+	if _, err := client.ListUserSubscriptions(ctx, &subscriptionsv1.ListUserSubscriptionsRequest{UserId: uuid.NewString()}, grpc.Header(&header)); err != nil {
+		t.Fatalf("ListUserSubscriptions: %v", err)
+	}
+	if got := header.Get(RequestIDMetadataKey); len(got) != 1 || got[0] != "req-123" {
+		t.Errorf("response %s = %v, want [req-123]", RequestIDMetadataKey, got)
+	}
+
+	header = nil
+	if _, err := client.ListUserSubscriptions(context.Background(), &subscriptionsv1.ListUserSubscriptionsRequest{UserId: uuid.NewString()}, grpc.Header(&header)); err != nil {
+		t.Fatalf("ListUserSubscriptions: %v", err)
+	}
+	if got := header.Get(RequestIDMetadataKey); len(got) != 1 || got[0] == "" {
+		t.Errorf("response %s = %v, want a generated request ID", RequestIDMetadataKey, got)
+	}
+}
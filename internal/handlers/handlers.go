@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
 	"github.com/Joshdike/subscriptions_aggregator/internal/models"
 	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
 	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
 	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
-	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
 )
 
 type SubscriptionHandler struct {
@@ -29,10 +28,13 @@ func New(repo repository.SubscriptionRepository) *SubscriptionHandler {
 // @Accept json
 // @Produce json
 // @Param request body models.SubscriptionRequest true "Subscription creation data"
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /subscriptions [post]
+// @Router /v1/subscriptions [post]
 func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var req models.SubscriptionRequest
@@ -41,22 +43,27 @@ func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		err = errors.ErrDecodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
+		return
+	}
+	err = validation.SubscriptionRequest(req)
+	if err != nil {
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	//Create the subscription
 	id, err := h.repo.Create(r.Context(), &req)
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": "subscription created successfully", "id": id})
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": i18n.T(r.Context(), i18n.SubscriptionCreated), "id": id})
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
@@ -67,26 +74,25 @@ func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.
 // @Description Retrieves complete list of all subscriptions. Requires admin privileges.
 // @Tags admin
 // @Produce json
-// @Security ApiKeyAuth
-// @Param X-Admin-Secret header string true "Admin secret key"
+// @Security AdminAuth
 // @Success 200 {array} models.AdminSubscriptionResponse
-// @Failure 401 {object} utils.ErrorResponse 
-// @Failure 500 {object} utils.ErrorResponse 
-// @Router /subscriptions [get]
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/subscriptions [get]
 func (h *SubscriptionHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	//Get all subscriptions by admin
 	subscriptions, err := h.repo.GetAll(r.Context())
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(subscriptions)
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
@@ -94,38 +100,39 @@ func (h *SubscriptionHandler) GetSubscriptions(w http.ResponseWriter, r *http.Re
 
 // GetSubscriptionByID godoc
 // @Summary Get a specific subscription by ID
-// @Description Retrieves a specific subscription by its numeric ID
+// @Description Retrieves a specific subscription by its numeric ID. The ETag header holds its version, for updates.
 // @Tags subscriptions
 // @Produce json
 // @Param id path string true "Subscription ID"
 // @Success 200 {object} models.SubscriptionResponse
+// @Header 200 {string} ETag "Version of the subscription"
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /subscriptions/{id} [get]
+// @Router /v1/subscriptions/{id} [get]
 func (h *SubscriptionHandler) GetSubscriptionByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get the subscription ID from the URL, convert to int and validate it
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	id, err := subscriptionID(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid subscription id", errors.ErrInvalidInput)
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	// Get the subscription
-	subscription, err := h.repo.GetByID(r.Context(), uint64(id))
+	subscription, err := h.repo.GetByID(r.Context(), id)
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(subscription.Version))
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(subscription)
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
@@ -140,28 +147,27 @@ func (h *SubscriptionHandler) GetSubscriptionByID(w http.ResponseWriter, r *http
 // @Success 200 {array} models.SubscriptionResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /subscriptions/user/{user_id} [get]
+// @Router /v1/subscriptions/user/{user_id} [get]
 func (h *SubscriptionHandler) GetSubscriptionByUserID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get the user ID from the URL and validate it
-	user_id, err := uuid.Parse(chi.URLParam(r, "user_id"))
+	user_id, err := userID(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid user id", errors.ErrInvalidInput)
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 	// Get the subscriptions
 	subscriptions, err := h.repo.GetByUserID(r.Context(), user_id)
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(subscriptions)
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 }
@@ -172,125 +178,398 @@ func (h *SubscriptionHandler) GetSubscriptionByUserID(w http.ResponseWriter, r *
 // @Tags subscriptions
 // @Produce json
 // @Param id path string true "Subscription ID"
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /subscriptions/{id} [post]
+// @Router /v1/subscriptions/{id} [post]
 func (h *SubscriptionHandler) RenewOrExtendSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	// Get the subscription id from the URL and validate it
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	id, err := subscriptionID(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid subscription id", errors.ErrInvalidInput)
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	// Renew or extend the subscription and get the new id
-	newId, err := h.repo.RenewOrExtend(r.Context(), uint64(id))
+	newId, err := h.repo.RenewOrExtend(r.Context(), id)
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": "subscription renewed successfully", "new_id": newId})
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": i18n.T(r.Context(), i18n.SubscriptionRenewed), "new_id": newId})
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 }
 
+// UpdateSubscription godoc
+// @Summary Update a subscription
+// @Description Applies a JSON Merge Patch (RFC 7396) to the price, service name and dates of a subscription.
+// @Description If-Match must hold the ETag of the current version (from GET or a previous update): 428 without it,
+// @Description 412 if the subscription changed since. A null end_date resets it to one month after the start.
+// @Description For existing clients, PATCH requests that are not merge patches soft-delete the subscription.
+// @Tags subscriptions
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Param If-Match header string true "ETag of the subscription"
+// @Param request body models.SubscriptionPatch true "Fields to change"
+// @Success 200 {object} models.SubscriptionResponse
+// @Header 200 {string} ETag "New version of the subscription"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 415 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/subscriptions/{id} [patch]
+func (h *SubscriptionHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.update(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(subscription)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// update applies the merge patch of the request and sets the ETag of the updated subscription,
+// or writes the error and returns false
+func (h *SubscriptionHandler) update(w http.ResponseWriter, r *http.Request) (models.SubscriptionResponse, bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !isMergePatch(r) {
+		w.Header().Set("Accept-Patch", mergePatchType)
+		err := fmt.Errorf("%w: send a JSON Merge Patch with Content-Type %s", errors.ErrUnsupportedMediaType, mergePatchType)
+		utils.WriteError(w, r, err)
+		return models.SubscriptionResponse{}, false
+	}
+
+	// get the id from the url and the expected version from If-Match, and validate them
+	id, err := subscriptionID(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return models.SubscriptionResponse{}, false
+	}
+	version, err := ifMatch(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return models.SubscriptionResponse{}, false
+	}
+
+	//Decode the patch and validate the fields it sets
+	var patch models.SubscriptionPatch
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		err = errors.ErrDecodingJSON
+		utils.WriteError(w, r, err)
+		return models.SubscriptionResponse{}, false
+	}
+	err = validation.SubscriptionPatch(patch)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return models.SubscriptionResponse{}, false
+	}
+
+	//Update the subscription if it is still at the expected version
+	subscription, err := h.repo.Update(r.Context(), id, version, patch)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return models.SubscriptionResponse{}, false
+	}
+	w.Header().Set("ETag", etag(subscription.Version))
+	return subscription, true
+}
+
+// PatchSubscription serves PATCH on a subscription: requests with neither a Content-Type nor a
+// body are the legacy verb of DELETE, the others are updates, answered with 415 unless they
+// carry a merge patch
+func (h *SubscriptionHandler) PatchSubscription(w http.ResponseWriter, r *http.Request) {
+	if isLegacyDelete(r) {
+		h.DeleteSubscription(w, r)
+		return
+	}
+	h.UpdateSubscription(w, r)
+}
+
 // DeleteSubscription godoc
 // @Summary Soft delete a subscription
-// @Description Marks a subscription as deleted by setting 'deleted' flag to true (does not permanently remove)
+// @Description Marks a subscription as deleted by setting 'deleted' flag to true (does not permanently remove).
+// @Description Deleting it again answers 200 with already_deleted set. PATCH without a merge patch body is kept for existing clients.
 // @Tags subscriptions
 // @Produce json
 // @Param id path int true "Subscription ID" minimum(1)
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /subscriptions/{id} [patch]
+// @Router /v1/subscriptions/{id} [delete]
 func (h *SubscriptionHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// get the id from the url and validate it
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	id, err := subscriptionID(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid subscription id", errors.ErrInvalidInput)
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
-	//soft delete the subscription
-	err = h.repo.Delete(r.Context(), uint64(id))
+	//soft delete the subscription; deleting it again is not an error
+	deleted, err := h.repo.Delete(r.Context(), id)
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
+	message := i18n.SubscriptionDeleted
+	if !deleted {
+		message = i18n.SubscriptionAlreadyDeleted
+	}
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": "subscription deleted successfully"})
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": i18n.T(r.Context(), message), "already_deleted": !deleted})
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 }
 
-// GetCostByDateRange godoc
-// @Summary Get the cost of a subscription for a specific date range
-// @Description Retrieves the cost of a subscription for a specific date range
+// GetDeletedSubscriptionsByUserID godoc
+// @Summary List the trash of a user
+// @Description Retrieves the soft-deleted subscriptions of a user, most recently deleted first.
+// @Description They can be restored until the retention job purges them.
 // @Tags subscriptions
 // @Produce json
 // @Param user_id path string true "User ID"
-// @Param service_name query string true "Service Name"
-// @Param from query string true "Start Date"
-// @Param to query string true "End Date"
-// @Success 200 {object} map[string]int
+// @Success 200 {array} models.DeletedSubscriptionResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /costs/{user_id} [get]
-func (h *SubscriptionHandler) GetCostByDateRange(w http.ResponseWriter, r *http.Request) {
+// @Router /v1/subscriptions/user/{user_id}/trash [get]
+func (h *SubscriptionHandler) GetDeletedSubscriptionsByUserID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// get the user id from the url and validate it
-	user_id, err := uuid.Parse(chi.URLParam(r, "user_id"))
+	// Get the user ID from the URL and validate it
+	user_id, err := userID(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid user id", errors.ErrInvalidInput)
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
-	
-	// get the service name from the query and validate it
-	service_name := r.URL.Query().Get("service_name")
-	if service_name == "" {
-		err = fmt.Errorf("%w: invalid service name", errors.ErrInvalidInput)
-		utils.WriteError(w, err)
+	// Get the deleted subscriptions
+	subscriptions, err := h.repo.GetDeletedByUserID(r.Context(), user_id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(subscriptions)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
 		return
 	}
+}
+
+// GetSubscriptionHistory godoc
+// @Summary Get the history of a subscription
+// @Description Lists the audit log of a subscription, oldest first: who created, renewed, updated, deleted,
+// @Description restored or purged it and when, with snapshots before and after each change.
+// @Description The history of a purged subscription is kept.
+// @Tags subscriptions
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/subscriptions/{id}/history [get]
+func (h *SubscriptionHandler) GetSubscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// get the start date, parse and validate it
-	startDate, err := utils.ParseMonthYear(r.URL.Query().Get("from"))
+	// get the id from the url, convert and validate it
+	id, err := subscriptionID(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid start date, %s", errors.ErrInvalidInput, err.Error())
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
+	// Get the audit events of the subscription
+	events, err := h.repo.GetHistory(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(events)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// RestoreSubscription godoc
+// @Summary Restore a soft-deleted subscription
+// @Description Un-deletes a subscription, unless it overlaps a current subscription of the same service.
+// @Description Restoring a subscription that is not deleted answers 200 with not_deleted set.
+// @Tags subscriptions
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/subscriptions/{id}/restore [post]
+func (h *SubscriptionHandler) RestoreSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get the id from the url and validate it
+	id, err := subscriptionID(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	//restore the subscription; restoring a current one is not an error
+	restored, err := h.repo.Restore(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	message := i18n.SubscriptionRestored
+	if !restored {
+		message = i18n.SubscriptionNotDeleted
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": i18n.T(r.Context(), message), "not_deleted": !restored})
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// SearchAuditLog godoc
+// @Summary Search the audit log (Admin Only)
+// @Description Lists the changes of every subscription, newest first, filtered by the given parameters.
+// @Description Requires admin privileges.
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param subscription_id query int false "Subscription ID" minimum(1)
+// @Param user_id query string false "User ID"
+// @Param actor query string false "Actor, e.g. user, api_key or system:retention"
+// @Param action query string false "Action" Enums(create, renew, update, delete, restore, purge)
+// @Param from query string false "Earliest change (RFC 3339)"
+// @Param to query string false "End of the period, excluded (RFC 3339)"
+// @Param limit query int false "Maximum number of events" minimum(1) maximum(1000) default(100)
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/audit [get]
+func (h *SubscriptionHandler) SearchAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Validate the filters
+	filter, err := validation.ParseAuditQuery(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	// Get the matching audit events
+	events, err := h.repo.SearchHistory(r.Context(), filter)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(events)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// PurgeSubscription godoc
+// @Summary Permanently delete a subscription (Admin Only)
+// @Description Removes a soft-deleted subscription for good. Subscriptions that are not deleted are refused with 409.
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param id path int true "Subscription ID" minimum(1)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/subscriptions/{id}/purge [delete]
+func (h *SubscriptionHandler) PurgeSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get the id from the url and validate it
+	id, err := subscriptionID(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	//permanently remove the subscription
+	err = h.repo.Purge(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"message": i18n.T(r.Context(), i18n.SubscriptionPurged)})
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// GetCostByDateRange godoc
+// @Summary Get the cost of a subscription for a specific date range
+// @Description Retrieves the cost of a subscription for a specific date range
+// @Tags subscriptions
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name query string true "Service Name"
+// @Param from query string true "Start Date"
+// @Param to query string true "End Date"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/costs/{user_id} [get]
+func (h *SubscriptionHandler) GetCostByDateRange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// get the end date, parse and validate it
-	endDate, err := utils.ParseMonthYear(r.URL.Query().Get("to"))
+	// get the user id, service name and date range and validate them
+	q, err := parseCostQuery(r)
 	if err != nil {
-		err = fmt.Errorf("%w: invalid end date, %s", errors.ErrInvalidInput, err.Error())
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	// get the cost
-	totalcost, err := h.repo.GetCost(r.Context(), user_id, service_name, startDate, endDate)
+	totalcost, err := h.repo.GetCost(r.Context(), q.UserID, q.ServiceName, q.From, q.To)
 	if err != nil {
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
@@ -298,7 +577,7 @@ func (h *SubscriptionHandler) GetCostByDateRange(w http.ResponseWriter, r *http.
 	err = json.NewEncoder(w).Encode(map[string]int{"total cost": totalcost})
 	if err != nil {
 		err = errors.ErrEncodingJSON
-		utils.WriteError(w, err)
+		utils.WriteError(w, r, err)
 		return
 	}
 }
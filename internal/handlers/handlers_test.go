@@ -0,0 +1,514 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
+	"github.com/google/uuid"
+)
+
+var (
+	errNotFound = fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	errOverlap  = fmt.Errorf("%w: wait till current subscription ends or extend it", errors.ErrAlreadyExists)
+)
+
+func TestCreateSubscription(t *testing.T) {
+	valid := `{"service_name":"Yandex Plus","price":400,"user_id":"` + userID.String() + `","start_date":"07-2025"}`
+	created := func(req *models.SubscriptionRequest) (uint64, error) {
+		if req.ServiceName != "Yandex Plus" || req.Price != 400 || req.UserID != userID || req.StartDate != "07-2025" {
+			return 0, fmt.Errorf("unexpected request %+v", req)
+		}
+		return 7, nil
+	}
+
+	run(t, []testCase{
+		{name: "created", method: http.MethodPost, path: "/v1/subscriptions", body: valid,
+			repo: fakeRepo{create: created}, status: http.StatusCreated},
+		{name: "created_ru", method: http.MethodPost, path: "/v1/subscriptions", body: valid,
+			headers: map[string]string{"Accept-Language": "ru-RU,ru;q=0.9"},
+			repo:    fakeRepo{create: created}, status: http.StatusCreated},
+		{name: "malformed_json", method: http.MethodPost, path: "/v1/subscriptions", body: `{"service_name":`,
+			status: http.StatusBadRequest},
+		{name: "wrong_json_type", method: http.MethodPost, path: "/v1/subscriptions", body: `{"price":"400"}`,
+			status: http.StatusBadRequest},
+		{name: "invalid_fields", method: http.MethodPost, path: "/v1/subscriptions",
+			body:   `{"service_name":"","price":0,"start_date":"13-2025","end_date":"01-1999"}`,
+			status: http.StatusBadRequest},
+		{name: "invalid_fields_ru", method: http.MethodPost, path: "/v1/subscriptions",
+			body:    `{"service_name":"","price":0,"start_date":"13-2025"}`,
+			headers: map[string]string{"Accept-Language": "ru"},
+			status:  http.StatusBadRequest},
+		{name: "end_before_start", method: http.MethodPost, path: "/v1/subscriptions",
+			body:   `{"service_name":"Yandex Plus","price":400,"user_id":"` + userID.String() + `","start_date":"07-2025","end_date":"06-2025"}`,
+			status: http.StatusBadRequest},
+		{name: "overlap", method: http.MethodPost, path: "/v1/subscriptions", body: valid,
+			repo:   fakeRepo{create: func(*models.SubscriptionRequest) (uint64, error) { return 0, errOverlap }},
+			status: http.StatusConflict},
+		{name: "overlap_legacy", method: http.MethodPost, path: "/v1/subscriptions", body: valid,
+			headers: map[string]string{"Accept": "application/json"},
+			repo:    fakeRepo{create: func(*models.SubscriptionRequest) (uint64, error) { return 0, errOverlap }},
+			status:  http.StatusConflict},
+		{name: "overlap_without_accept", method: http.MethodPost, path: "/v1/subscriptions", body: valid,
+			headers: map[string]string{"Accept": ""},
+			repo:    fakeRepo{create: func(*models.SubscriptionRequest) (uint64, error) { return 0, errOverlap }},
+			status:  http.StatusConflict},
+		{name: "repository_error", method: http.MethodPost, path: "/v1/subscriptions", body: valid,
+			repo:   fakeRepo{create: func(*models.SubscriptionRequest) (uint64, error) { return 0, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestGetSubscriptions(t *testing.T) {
+	all := func() ([]models.AdminSubscriptionResponse, error) {
+		sub := subscription(1, "Yandex Plus", 400, month(2025, time.July), 1)
+		deletedAt := time.Date(2025, time.July, 15, 10, 30, 0, 0, time.UTC)
+		return []models.AdminSubscriptionResponse{{
+			ID: sub.ID, ServiceName: sub.ServiceName, Price: sub.Price, UserID: sub.UserID,
+			StartDate: sub.StartDate, EndDate: sub.EndDate, Deleted: true, DeletedAt: &deletedAt, DeletedBy: "user",
+		}}, nil
+	}
+	admin := map[string]string{"secret-key": adminKey}
+
+	run(t, []testCase{
+		{name: "admin", method: http.MethodGet, path: "/v1/subscriptions", headers: admin,
+			repo: fakeRepo{getAll: all}, status: http.StatusOK},
+		{name: "missing_key", method: http.MethodGet, path: "/v1/subscriptions",
+			repo: fakeRepo{getAll: all}, status: http.StatusUnauthorized},
+		{name: "wrong_key", method: http.MethodGet, path: "/v1/subscriptions",
+			headers: map[string]string{"secret-key": "not-the-admin-key"},
+			repo:    fakeRepo{getAll: all}, status: http.StatusUnauthorized},
+		{name: "missing_key_legacy", method: http.MethodGet, path: "/v1/subscriptions",
+			headers: map[string]string{"Accept": "application/json"},
+			status:  http.StatusUnauthorized},
+		{name: "missing_key_without_accept", method: http.MethodGet, path: "/v1/subscriptions",
+			headers: map[string]string{"Accept": ""},
+			status:  http.StatusUnauthorized},
+		{name: "repository_error", method: http.MethodGet, path: "/v1/subscriptions", headers: admin,
+			repo:   fakeRepo{getAll: func() ([]models.AdminSubscriptionResponse, error) { return nil, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestGetSubscriptionByID(t *testing.T) {
+	found := func(id uint64) (models.SubscriptionResponse, error) {
+		if id != 3 {
+			return models.SubscriptionResponse{}, errNotFound
+		}
+		return subscription(3, "Kinopoisk", 299, month(2025, time.March), 2), nil
+	}
+
+	run(t, []testCase{
+		{name: "found", method: http.MethodGet, path: "/v1/subscriptions/3",
+			repo: fakeRepo{getByID: found}, status: http.StatusOK},
+		{name: "not_found", method: http.MethodGet, path: "/v1/subscriptions/4",
+			repo: fakeRepo{getByID: found}, status: http.StatusNotFound},
+		{name: "not_found_legacy", method: http.MethodGet, path: "/v1/subscriptions/4",
+			headers: map[string]string{"Accept": "application/json"},
+			repo:    fakeRepo{getByID: found}, status: http.StatusNotFound},
+		{name: "not_a_number", method: http.MethodGet, path: "/v1/subscriptions/abc",
+			status: http.StatusBadRequest},
+		{name: "zero", method: http.MethodGet, path: "/v1/subscriptions/0",
+			status: http.StatusBadRequest},
+		{name: "negative", method: http.MethodGet, path: "/v1/subscriptions/-1",
+			status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodGet, path: "/v1/subscriptions/3",
+			repo:   fakeRepo{getByID: func(uint64) (models.SubscriptionResponse, error) { return models.SubscriptionResponse{}, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestGetSubscriptionByUserID(t *testing.T) {
+	list := func(id uuid.UUID) ([]models.SubscriptionResponse, error) {
+		if id != userID {
+			return nil, nil
+		}
+		return []models.SubscriptionResponse{
+			subscription(1, "Yandex Plus", 400, month(2025, time.January), 12),
+			subscription(2, "Kinopoisk", 299, month(2025, time.March), 1),
+		}, nil
+	}
+
+	run(t, []testCase{
+		{name: "found", method: http.MethodGet, path: "/v1/subscriptions/user/" + userID.String(),
+			repo: fakeRepo{getByUserID: list}, status: http.StatusOK},
+		{name: "none", method: http.MethodGet, path: "/v1/subscriptions/user/" + uuid.NewSHA1(uuid.Nil, []byte("other")).String(),
+			repo: fakeRepo{getByUserID: list}, status: http.StatusOK},
+		{name: "invalid_uuid", method: http.MethodGet, path: "/v1/subscriptions/user/not-a-uuid",
+			status: http.StatusBadRequest},
+		{name: "nil_uuid", method: http.MethodGet, path: "/v1/subscriptions/user/" + uuid.Nil.String(),
+			status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodGet, path: "/v1/subscriptions/user/" + userID.String(),
+			repo:   fakeRepo{getByUserID: func(uuid.UUID) ([]models.SubscriptionResponse, error) { return nil, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestRenewOrExtendSubscription(t *testing.T) {
+	renew := func(id uint64) (uint64, error) {
+		if id != 3 {
+			return 0, errNotFound
+		}
+		return 8, nil
+	}
+
+	run(t, []testCase{
+		{name: "renewed", method: http.MethodPost, path: "/v1/subscriptions/3",
+			repo: fakeRepo{renewOrExtend: renew}, status: http.StatusCreated},
+		{name: "not_found", method: http.MethodPost, path: "/v1/subscriptions/4",
+			repo: fakeRepo{renewOrExtend: renew}, status: http.StatusNotFound},
+		{name: "overlap", method: http.MethodPost, path: "/v1/subscriptions/3",
+			repo:   fakeRepo{renewOrExtend: func(uint64) (uint64, error) { return 0, errOverlap }},
+			status: http.StatusConflict},
+		{name: "invalid_id", method: http.MethodPost, path: "/v1/subscriptions/abc",
+			status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodPost, path: "/v1/subscriptions/3",
+			repo:   fakeRepo{renewOrExtend: func(uint64) (uint64, error) { return 0, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestDeleteSubscription(t *testing.T) {
+	deleted := func(id uint64) (bool, error) {
+		if id != 3 {
+			return false, fmt.Errorf("unexpected id %d", id)
+		}
+		return true, nil
+	}
+	alreadyDeleted := func(uint64) (bool, error) { return false, nil }
+	notFound := func(uint64) (bool, error) {
+		return false, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+
+	run(t, []testCase{
+		{name: "deleted", method: http.MethodDelete, path: "/v1/subscriptions/3",
+			repo: fakeRepo{delete: deleted}, status: http.StatusOK},
+		{name: "deleted_patch", method: http.MethodPatch, path: "/v1/subscriptions/3",
+			repo: fakeRepo{delete: deleted}, status: http.StatusOK},
+		{name: "deleted_ru", method: http.MethodDelete, path: "/v1/subscriptions/3?lang=ru",
+			repo: fakeRepo{delete: deleted}, status: http.StatusOK},
+		{name: "already_deleted", method: http.MethodDelete, path: "/v1/subscriptions/3",
+			repo: fakeRepo{delete: alreadyDeleted}, status: http.StatusOK},
+		{name: "not_found", method: http.MethodDelete, path: "/v1/subscriptions/3",
+			repo: fakeRepo{delete: notFound}, status: http.StatusNotFound},
+		{name: "not_found_patch", method: http.MethodPatch, path: "/v1/subscriptions/3",
+			repo: fakeRepo{delete: notFound}, status: http.StatusNotFound},
+		{name: "invalid_id", method: http.MethodDelete, path: "/v1/subscriptions/abc",
+			status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodDelete, path: "/v1/subscriptions/3",
+			repo:   fakeRepo{delete: func(uint64) (bool, error) { return false, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestUpdateSubscription(t *testing.T) {
+	updated := func(id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+		if id != 3 || version != 2 || patch.Price == nil || *patch.Price != 349 || patch.ServiceName != nil {
+			return models.SubscriptionResponse{}, fmt.Errorf("unexpected update of %d at version %d: %+v", id, version, patch)
+		}
+		sub := subscription(3, "Kinopoisk", 349, month(2025, time.March), 2)
+		sub.Version = 3
+		return sub, nil
+	}
+	mergePatch := map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"2"`}
+	withHeader := func(k, v string) map[string]string {
+		h := map[string]string{"Content-Type": "application/merge-patch+json"}
+		if k != "" {
+			h[k] = v
+		}
+		return h
+	}
+
+	run(t, []testCase{
+		{name: "updated", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":349}`, headers: mergePatch,
+			repo: fakeRepo{update: updated}, status: http.StatusOK},
+		{name: "missing_if_match", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":349}`, headers: withHeader("", ""),
+			repo: fakeRepo{update: updated}, status: http.StatusPreconditionRequired},
+		{name: "weak_if_match", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":349}`, headers: withHeader("If-Match", `W/"2"`),
+			repo: fakeRepo{update: updated}, status: http.StatusPreconditionFailed},
+		{name: "version_mismatch", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":349}`, headers: withHeader("If-Match", `"1"`),
+			repo: fakeRepo{update: func(uint64, int, models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+				return models.SubscriptionResponse{}, fmt.Errorf("%w: fetch it again and retry", errors.ErrVersionMismatch)
+			}},
+			status: http.StatusPreconditionFailed},
+		{name: "invalid_fields", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":-1,"start_date":"13-2025"}`, headers: mergePatch,
+			status: http.StatusBadRequest},
+		{name: "unknown_field", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"user_id":"` + userID.String() + `"}`, headers: mergePatch,
+			status: http.StatusBadRequest},
+		{name: "overlap", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"start_date":"01-2025"}`, headers: mergePatch,
+			repo: fakeRepo{update: func(uint64, int, models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+				return models.SubscriptionResponse{}, errOverlap
+			}},
+			status: http.StatusConflict},
+		{name: "not_found", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":349}`, headers: mergePatch,
+			repo: fakeRepo{update: func(uint64, int, models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+				return models.SubscriptionResponse{}, errNotFound
+			}},
+			status: http.StatusNotFound},
+		{name: "v2", method: http.MethodPatch, path: "/v2/subscriptions/3", body: `{"price":349}`, headers: mergePatch,
+			repo: fakeRepo{update: updated}, status: http.StatusOK},
+		// bodies that are not merge patches neither update nor delete the subscription
+		{name: "json_body", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":500}`,
+			headers: map[string]string{"Content-Type": "application/json", "If-Match": `"2"`}, status: http.StatusUnsupportedMediaType},
+		{name: "body_without_content_type", method: http.MethodPatch, path: "/v1/subscriptions/3", body: `{"price":500}`,
+			status: http.StatusUnsupportedMediaType},
+		{name: "json_body_legacy_path", method: http.MethodPatch, path: "/subscriptions/3", body: `{"price":500}`,
+			headers: map[string]string{"Content-Type": "application/json"}, status: http.StatusUnsupportedMediaType},
+		{name: "v2_json_body", method: http.MethodPatch, path: "/v2/subscriptions/3", body: `{"price":500}`,
+			headers: map[string]string{"Content-Type": "application/json"}, status: http.StatusUnsupportedMediaType},
+		{name: "v2_without_body", method: http.MethodPatch, path: "/v2/subscriptions/3",
+			status: http.StatusUnsupportedMediaType},
+	})
+}
+
+func TestGetDeletedSubscriptionsByUserID(t *testing.T) {
+	trash := func(id uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+		if id != userID {
+			return nil, nil
+		}
+		return []models.DeletedSubscriptionResponse{{
+			SubscriptionResponse: subscription(2, "Kinopoisk", 299, month(2025, time.March), 1),
+			DeletedAt:            time.Date(2025, time.July, 15, 10, 30, 0, 0, time.UTC),
+		}}, nil
+	}
+
+	run(t, []testCase{
+		{name: "found", method: http.MethodGet, path: "/v1/subscriptions/user/" + userID.String() + "/trash",
+			repo: fakeRepo{getDeletedByUserID: trash}, status: http.StatusOK},
+		{name: "invalid_uuid", method: http.MethodGet, path: "/v1/subscriptions/user/not-a-uuid/trash",
+			status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodGet, path: "/v1/subscriptions/user/" + userID.String() + "/trash",
+			repo:   fakeRepo{getDeletedByUserID: func(uuid.UUID) ([]models.DeletedSubscriptionResponse, error) { return nil, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestRestoreSubscription(t *testing.T) {
+	restored := func(id uint64) (bool, error) {
+		if id != 3 {
+			return false, fmt.Errorf("unexpected id %d", id)
+		}
+		return true, nil
+	}
+
+	run(t, []testCase{
+		{name: "restored", method: http.MethodPost, path: "/v1/subscriptions/3/restore",
+			repo: fakeRepo{restore: restored}, status: http.StatusOK},
+		{name: "restored_ru", method: http.MethodPost, path: "/v1/subscriptions/3/restore?lang=ru",
+			repo: fakeRepo{restore: restored}, status: http.StatusOK},
+		{name: "not_deleted", method: http.MethodPost, path: "/v1/subscriptions/3/restore",
+			repo: fakeRepo{restore: func(uint64) (bool, error) { return false, nil }}, status: http.StatusOK},
+		{name: "overlap", method: http.MethodPost, path: "/v1/subscriptions/3/restore",
+			repo: fakeRepo{restore: func(uint64) (bool, error) { return false, errOverlap }}, status: http.StatusConflict},
+		{name: "not_found", method: http.MethodPost, path: "/v1/subscriptions/3/restore",
+			repo: fakeRepo{restore: func(uint64) (bool, error) { return false, errNotFound }}, status: http.StatusNotFound},
+		{name: "invalid_id", method: http.MethodPost, path: "/v1/subscriptions/abc/restore",
+			status: http.StatusBadRequest},
+	})
+}
+
+func TestGetSubscriptionHistory(t *testing.T) {
+	history := func(id uint64) ([]models.AuditEvent, error) {
+		if id != 3 {
+			return nil, errNotFound
+		}
+		created := models.Subscription{ID: 3, ServiceName: "Kinopoisk", Price: 299, UserID: userID,
+			StartDate: month(2025, time.March), EndDate: month(2025, time.May), Version: 1}
+		updated := created
+		updated.Price, updated.Version = 349, 2
+		at := time.Date(2025, time.July, 15, 10, 30, 0, 0, time.UTC)
+		return []models.AuditEvent{
+			{ID: 1, SubscriptionID: 3, UserID: userID, Action: models.AuditCreate, Actor: "user", RequestID: "req-1",
+				After: models.NewAuditSnapshot(&created), CreatedAt: at},
+			{ID: 4, SubscriptionID: 3, UserID: userID, Action: models.AuditUpdate, Actor: "api_key", RequestID: "req-2",
+				Before: models.NewAuditSnapshot(&created), After: models.NewAuditSnapshot(&updated), CreatedAt: at.Add(time.Hour)},
+		}, nil
+	}
+
+	run(t, []testCase{
+		{name: "found", method: http.MethodGet, path: "/v1/subscriptions/3/history",
+			repo: fakeRepo{getHistory: history}, status: http.StatusOK},
+		{name: "not_found", method: http.MethodGet, path: "/v1/subscriptions/4/history",
+			repo: fakeRepo{getHistory: history}, status: http.StatusNotFound},
+		{name: "invalid_id", method: http.MethodGet, path: "/v1/subscriptions/abc/history",
+			status: http.StatusBadRequest},
+		{name: "v2", method: http.MethodGet, path: "/v2/subscriptions/3/history",
+			repo: fakeRepo{getHistory: history}, status: http.StatusOK},
+	})
+}
+
+func TestSearchAuditLog(t *testing.T) {
+	search := func(filter models.AuditFilter) ([]models.AuditEvent, error) {
+		want := models.AuditFilter{UserID: userID, Action: models.AuditPurge, Actor: "system:retention",
+			From: time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC), Limit: 10}
+		if filter != want {
+			return nil, fmt.Errorf("unexpected filter %+v", filter)
+		}
+		deletedAt := time.Date(2025, time.June, 1, 9, 0, 0, 0, time.UTC)
+		purged := models.Subscription{ID: 2, ServiceName: "Kinopoisk", Price: 299, UserID: userID,
+			StartDate: month(2025, time.March), EndDate: month(2025, time.April), Deleted: true,
+			DeletedAt: &deletedAt, DeletedBy: "user", Version: 2}
+		event := models.NewAuditEvent(models.AuditPurge, "system:retention", "", &purged, nil)
+		event.ID, event.CreatedAt = 9, time.Date(2025, time.July, 1, 3, 0, 0, 0, time.UTC)
+		return []models.AuditEvent{event}, nil
+	}
+	admin := map[string]string{"secret-key": adminKey}
+	query := "?user_id=" + userID.String() + "&action=purge&actor=system:retention&from=2025-07-01T00:00:00Z&limit=10"
+
+	run(t, []testCase{
+		{name: "found", method: http.MethodGet, path: "/v1/audit" + query, headers: admin,
+			repo: fakeRepo{searchHistory: search}, status: http.StatusOK},
+		{name: "missing_key", method: http.MethodGet, path: "/v1/audit" + query,
+			repo: fakeRepo{searchHistory: search}, status: http.StatusUnauthorized},
+		{name: "invalid_parameters", method: http.MethodGet, path: "/v1/audit?action=edit&from=07-2025&limit=0", headers: admin,
+			status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodGet, path: "/v1/audit", headers: admin,
+			repo:   fakeRepo{searchHistory: func(models.AuditFilter) ([]models.AuditEvent, error) { return nil, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestPurgeSubscription(t *testing.T) {
+	purged := func(id uint64) error {
+		if id != 3 {
+			return fmt.Errorf("unexpected id %d", id)
+		}
+		return nil
+	}
+	admin := map[string]string{"secret-key": adminKey}
+
+	run(t, []testCase{
+		{name: "purged", method: http.MethodDelete, path: "/v1/subscriptions/3/purge", headers: admin,
+			repo: fakeRepo{purge: purged}, status: http.StatusOK},
+		{name: "missing_key", method: http.MethodDelete, path: "/v1/subscriptions/3/purge",
+			repo: fakeRepo{purge: purged}, status: http.StatusUnauthorized},
+		{name: "not_deleted", method: http.MethodDelete, path: "/v1/subscriptions/3/purge", headers: admin,
+			repo: fakeRepo{purge: func(uint64) error {
+				return fmt.Errorf("%w: delete the subscription before purging it", errors.ErrNotDeleted)
+			}},
+			status: http.StatusConflict},
+		{name: "not_found", method: http.MethodDelete, path: "/v1/subscriptions/3/purge", headers: admin,
+			repo: fakeRepo{purge: func(uint64) error { return errNotFound }}, status: http.StatusNotFound},
+	})
+}
+
+func TestGetCostByDateRange(t *testing.T) {
+	cost := func(id uuid.UUID, service string, start, end time.Time) (int, error) {
+		if id != userID || service != "Yandex Plus" || !start.Equal(month(2025, time.January)) || !end.Equal(month(2025, time.June)) {
+			return 0, fmt.Errorf("unexpected query %s %q %s %s", id, service, start, end)
+		}
+		return 2400, nil
+	}
+	path := "/v1/costs/" + userID.String()
+
+	run(t, []testCase{
+		{name: "total", method: http.MethodGet, path: path + "?service_name=Yandex+Plus&from=01-2025&to=06-2025",
+			repo: fakeRepo{getCost: cost}, status: http.StatusOK},
+		{name: "missing_parameters", method: http.MethodGet, path: path,
+			status: http.StatusBadRequest},
+		{name: "invalid_parameters", method: http.MethodGet, path: "/v1/costs/not-a-uuid?service_name=Yandex+Plus&from=2025-01&to=06-2101",
+			status: http.StatusBadRequest},
+		{name: "to_before_from", method: http.MethodGet, path: path + "?service_name=Yandex+Plus&from=06-2025&to=01-2025",
+			status: http.StatusBadRequest},
+		{name: "invalid_parameters_legacy", method: http.MethodGet, path: path + "?from=06-2025&to=01-2025",
+			headers: map[string]string{"Accept": "application/json"},
+			status:  http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodGet, path: path + "?service_name=Yandex+Plus&from=01-2025&to=06-2025",
+			repo:   fakeRepo{getCost: func(uuid.UUID, string, time.Time, time.Time) (int, error) { return 0, errDatabase }},
+			status: http.StatusInternalServerError},
+	})
+}
+
+func TestImportSubscriptions(t *testing.T) {
+	user := userID.String()
+	csvFile := "service_name,price,user_id,start_date,end_date\n" +
+		"Yandex Plus,400," + user + ",07-2025,\n" +
+		"Kinopoisk,299," + user + ",01-2025,03-2025\n"
+	jsonLines := `{"service_name":"Yandex Plus","price":400,"user_id":"` + user + `","start_date":"07-2025"}` + "\n\n" +
+		`{"service_name":"","price":0,"user_id":"` + user + `","start_date":"13-2025"}` + "\n" +
+		`{"service_name":"Kinopoisk","price":"299"}` + "\n" +
+		`{"service_name":"Kinopoisk","price":299,"user_id":"` + user + `","start_date":"01-2025"}` + "\n"
+
+	// imported creates the rows unless told to check them, failing the rows of Kinopoisk from January
+	imported := func(want models.ImportOptions) func([]models.ImportRow, models.ImportOptions) ([]models.ImportOutcome, error) {
+		return func(rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+			if opts != want {
+				return nil, fmt.Errorf("unexpected options %+v", opts)
+			}
+			outcomes := make([]models.ImportOutcome, len(rows))
+			for i, row := range rows {
+				if row.Request.ServiceName == "Kinopoisk" && row.Request.StartDate == "01-2025" && row.Request.EndDate == "" {
+					outcomes[i].Err = errOverlap
+				} else if !opts.DryRun {
+					outcomes[i].ID = uint64(10 + i)
+				}
+			}
+			return outcomes, nil
+		}
+	}
+	csvType := map[string]string{"Content-Type": "text/csv; charset=utf-8"}
+	ndjson := map[string]string{"Content-Type": "application/x-ndjson"}
+
+	run(t, []testCase{
+		{name: "csv_created", method: http.MethodPost, path: "/v1/subscriptions/import", body: csvFile, headers: csvType,
+			repo: fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportAllOrNothing})}, status: http.StatusOK},
+		{name: "csv_dry_run", method: http.MethodPost, path: "/v1/subscriptions/import?dry_run=true", body: csvFile, headers: csvType,
+			repo: fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportAllOrNothing, DryRun: true})}, status: http.StatusOK},
+		{name: "csv_invalid_rows", method: http.MethodPost, path: "/v1/subscriptions/import?mode=best_effort",
+			body: "user_id,service_name,price,start_date\n" + user + ",Yandex Plus,four hundred,07-2025\n" +
+				user + ",Kinopoisk,299\n" + user + ",Okko,199,02-2025\n",
+			headers: csvType,
+			repo:    fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportBestEffort})}, status: http.StatusOK},
+		{name: "csv_unknown_column", method: http.MethodPost, path: "/v1/subscriptions/import",
+			body: "service_name,price,user_id,start_date,currency\n", headers: csvType, status: http.StatusBadRequest},
+		{name: "csv_missing_column", method: http.MethodPost, path: "/v1/subscriptions/import",
+			body: "service_name,price,start_date\n", headers: csvType, status: http.StatusBadRequest},
+		{name: "ndjson_best_effort", method: http.MethodPost, path: "/v1/subscriptions/import?mode=best_effort", body: jsonLines, headers: ndjson,
+			repo: fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportBestEffort})}, status: http.StatusOK},
+		{name: "ndjson_all_or_nothing", method: http.MethodPost, path: "/v1/subscriptions/import", body: jsonLines, headers: ndjson,
+			repo: fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportAllOrNothing, DryRun: true})}, status: http.StatusOK},
+		{name: "ndjson_ru", method: http.MethodPost, path: "/v1/subscriptions/import?mode=best_effort", body: jsonLines,
+			headers: map[string]string{"Content-Type": "application/x-ndjson", "Accept-Language": "ru"},
+			repo:    fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportBestEffort})}, status: http.StatusOK},
+		{name: "admin_copy", method: http.MethodPost, path: "/v1/subscriptions/import",
+			body:    "service_name,price,user_id,start_date\n" + strings.Repeat("Yandex Plus,400,"+user+",07-2025\n", 1001),
+			headers: map[string]string{"Content-Type": "text/csv", "secret-key": adminKey},
+			// the repository fails once the options are checked, keeping 1001 rows out of the golden file
+			repo: fakeRepo{importRows: func(rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+				if len(rows) != 1001 || !opts.Copy {
+					return nil, fmt.Errorf("unexpected import of %d rows with %+v", len(rows), opts)
+				}
+				return nil, errOverlap
+			}},
+			status: http.StatusConflict},
+		{name: "admin_wrong_key", method: http.MethodPost, path: "/v1/subscriptions/import", body: csvFile,
+			headers: map[string]string{"Content-Type": "text/csv", "secret-key": "wrong"}, status: http.StatusUnauthorized},
+		{name: "too_many_rows", method: http.MethodPost, path: "/v1/subscriptions/import",
+			body:    "service_name,price,user_id,start_date\n" + strings.Repeat("Yandex Plus,400,"+user+",07-2025\n", 1001),
+			headers: csvType, status: http.StatusBadRequest},
+		{name: "csv_too_large", method: http.MethodPost, path: "/v1/subscriptions/import",
+			body:    "service_name,price,user_id,start_date\n\"" + strings.Repeat("Yandex Plus ", validation.MaxImportBytes/10) + "\",400," + user + ",07-2025\n",
+			headers: csvType, status: http.StatusRequestEntityTooLarge},
+		{name: "ndjson_too_large", method: http.MethodPost, path: "/v1/subscriptions/import",
+			body:    jsonLines + strings.Repeat("\n", validation.MaxImportBytes),
+			headers: ndjson, status: http.StatusRequestEntityTooLarge},
+		{name: "empty_file", method: http.MethodPost, path: "/v1/subscriptions/import", body: "\n", headers: ndjson,
+			status: http.StatusBadRequest},
+		{name: "unsupported_content_type", method: http.MethodPost, path: "/v1/subscriptions/import", body: jsonLines,
+			headers: map[string]string{"Content-Type": "application/json"}, status: http.StatusBadRequest},
+		{name: "invalid_parameters", method: http.MethodPost, path: "/v1/subscriptions/import?mode=some&dry_run=maybe", body: csvFile,
+			headers: csvType, status: http.StatusBadRequest},
+		{name: "repository_error", method: http.MethodPost, path: "/v1/subscriptions/import", body: csvFile, headers: csvType,
+			repo: fakeRepo{importRows: func([]models.ImportRow, models.ImportOptions) ([]models.ImportOutcome, error) {
+				return nil, errDatabase
+			}},
+			status: http.StatusInternalServerError},
+		{name: "v2", method: http.MethodPost, path: "/v2/subscriptions/import", body: csvFile, headers: csvType,
+			repo: fakeRepo{importRows: imported(models.ImportOptions{Mode: models.ImportAllOrNothing})}, status: http.StatusOK},
+	})
+}
@@ -0,0 +1,303 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/handlers"
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	mw "github.com/Joshdike/subscriptions_aggregator/internal/middleware"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+	"github.com/Joshdike/subscriptions_aggregator/internal/router"
+	"github.com/google/uuid"
+)
+
+// update rewrites the golden files with the current responses: go test ./internal/handlers -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+const (
+	adminKey  = "test-admin-key-0123456789"
+	requestID = "test-request-id"
+)
+
+var (
+	userID      = uuid.MustParse("6f1c8b2e-4a7d-4e21-9c33-2b5d8e9f0a11")
+	errDatabase = stderrors.New("pq: connection reset by peer")
+)
+
+// fakeRepo is a repository.SubscriptionRepository answering with the functions set by each
+// test case. Methods whose function is not set fail with errUnexpectedCall.
+type fakeRepo struct {
+	create        func(req *models.SubscriptionRequest) (uint64, error)
+	getAll        func() ([]models.AdminSubscriptionResponse, error)
+	getByUserID   func(userID uuid.UUID) ([]models.SubscriptionResponse, error)
+	getByID       func(id uint64) (models.SubscriptionResponse, error)
+	delete        func(id uint64) (bool, error)
+	renewOrExtend func(id uint64) (uint64, error)
+	getCost       func(userID uuid.UUID, serviceName string, start, end time.Time) (int, error)
+
+	getDeletedByUserID func(userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error)
+	restore            func(id uint64) (bool, error)
+	purge              func(id uint64) error
+	update             func(id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error)
+	getHistory         func(id uint64) ([]models.AuditEvent, error)
+	searchHistory      func(filter models.AuditFilter) ([]models.AuditEvent, error)
+	importRows         func(rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error)
+}
+
+var errUnexpectedCall = stderrors.New("unexpected repository call")
+
+func (f *fakeRepo) Create(_ context.Context, req *models.SubscriptionRequest) (uint64, error) {
+	if f.create == nil {
+		return 0, errUnexpectedCall
+	}
+	return f.create(req)
+}
+
+func (f *fakeRepo) GetAll(context.Context) ([]models.AdminSubscriptionResponse, error) {
+	if f.getAll == nil {
+		return nil, errUnexpectedCall
+	}
+	return f.getAll()
+}
+
+func (f *fakeRepo) GetByUserID(_ context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	if f.getByUserID == nil {
+		return nil, errUnexpectedCall
+	}
+	return f.getByUserID(userID)
+}
+
+func (f *fakeRepo) GetByUserIDs(context.Context, []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	return nil, errUnexpectedCall
+}
+
+func (f *fakeRepo) GetByID(_ context.Context, id uint64) (models.SubscriptionResponse, error) {
+	if f.getByID == nil {
+		return models.SubscriptionResponse{}, errUnexpectedCall
+	}
+	return f.getByID(id)
+}
+
+func (f *fakeRepo) Delete(_ context.Context, id uint64) (bool, error) {
+	if f.delete == nil {
+		return false, errUnexpectedCall
+	}
+	return f.delete(id)
+}
+
+func (f *fakeRepo) Update(_ context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+	if f.update == nil {
+		return models.SubscriptionResponse{}, errUnexpectedCall
+	}
+	return f.update(id, version, patch)
+}
+
+func (f *fakeRepo) GetDeletedByUserID(_ context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+	if f.getDeletedByUserID == nil {
+		return nil, errUnexpectedCall
+	}
+	return f.getDeletedByUserID(userID)
+}
+
+func (f *fakeRepo) Restore(_ context.Context, id uint64) (bool, error) {
+	if f.restore == nil {
+		return false, errUnexpectedCall
+	}
+	return f.restore(id)
+}
+
+func (f *fakeRepo) Purge(_ context.Context, id uint64) error {
+	if f.purge == nil {
+		return errUnexpectedCall
+	}
+	return f.purge(id)
+}
+
+func (f *fakeRepo) RenewOrExtend(_ context.Context, id uint64) (uint64, error) {
+	if f.renewOrExtend == nil {
+		return 0, errUnexpectedCall
+	}
+	return f.renewOrExtend(id)
+}
+
+func (f *fakeRepo) GetCost(_ context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
+	if f.getCost == nil {
+		return 0, errUnexpectedCall
+	}
+	return f.getCost(userID, serviceName, start, end)
+}
+
+func (f *fakeRepo) GetHistory(_ context.Context, id uint64) ([]models.AuditEvent, error) {
+	if f.getHistory == nil {
+		return nil, errUnexpectedCall
+	}
+	return f.getHistory(id)
+}
+
+func (f *fakeRepo) SearchHistory(_ context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	if f.searchHistory == nil {
+		return nil, errUnexpectedCall
+	}
+	return f.searchHistory(filter)
+}
+
+func (f *fakeRepo) Import(_ context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+	if f.importRows == nil {
+		return nil, errUnexpectedCall
+	}
+	return f.importRows(rows, opts)
+}
+
+func (f *fakeRepo) OverlapCheck(context.Context, models.Subscription) error {
+	return errUnexpectedCall
+}
+
+// newServer serves the real API router on top of repo, behind the request ID and language
+// middlewares installed by cmd/main
+func newServer(t *testing.T, repo *fakeRepo) *httptest.Server {
+	t.Helper()
+	r := router.New(router.Options{
+		Handler:            handlers.New(repo),
+		AdminSecret:        adminKey,
+		LegacyDeprecatedAt: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		LegacySunset:       time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+	})
+	srv := httptest.NewServer(mw.RequestIDMiddleware(i18n.Middleware(i18n.EN)(r)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testCase is a request to the API, the repository behavior it meets and the expected status.
+// Requests accept problem details, like the client, unless the case sets Accept ("" removes it).
+// The response is compared with testdata/<test name>/<case name>.golden.
+type testCase struct {
+	name    string
+	method  string
+	path    string
+	body    string
+	headers map[string]string
+	repo    fakeRepo
+	status  int
+}
+
+// run sends the request of each case to a fresh server and checks the status and golden response
+func run(t *testing.T, cases []testCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newServer(t, &tc.repo)
+
+			var body io.Reader
+			if tc.body != "" {
+				body = strings.NewReader(tc.body)
+			}
+			req, err := http.NewRequest(tc.method, srv.URL+tc.path, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(mw.RequestIDHeader, requestID)
+			req.Header.Set("Accept", problem.ContentType)
+			for k, v := range tc.headers {
+				if v == "" {
+					req.Header.Del(k)
+					continue
+				}
+				req.Header.Set(k, v)
+			}
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			got := dump(t, resp)
+			if resp.StatusCode != tc.status {
+				t.Errorf("status = %d, want %d\n%s", resp.StatusCode, tc.status, got)
+			}
+			golden(t, got)
+		})
+	}
+}
+
+// goldenHeaders are the response headers recorded in the golden files
+var goldenHeaders = []string{"Content-Type", "Content-Language", "Deprecation", "Sunset", "Link", "ETag", "Accept-Patch"}
+
+// dump renders the status, the golden headers and the indented JSON body of resp
+func dump(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	for _, h := range goldenHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			fmt.Fprintf(&b, "%s: %s\n", h, v)
+		}
+	}
+	b.WriteString("\n")
+	if err := json.Indent(&b, raw, "", "  "); err != nil {
+		b.Write(raw) // not JSON, recorded as is
+	}
+	return append(bytes.TrimRight(b.Bytes(), "\n"), '\n')
+}
+
+// golden compares got with the golden file of the running test, or rewrites it with -update
+func golden(t *testing.T, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", filepath.FromSlash(t.Name())+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response differs from %s (run with -update to accept it)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// subscription returns a stored subscription of userID from start for the given number of months
+func subscription(id uint64, service string, price int, start time.Time, months int) models.SubscriptionResponse {
+	end := start.AddDate(0, months, 0)
+	return models.SubscriptionResponse{
+		ID:          id,
+		ServiceName: service,
+		Price:       price,
+		UserID:      userID,
+		StartDate:   start.Format("01-2006"),
+		EndDate:     end.Format("01-2006"),
+		StartTime:   start,
+		EndTime:     end,
+		Version:     1,
+	}
+}
+
+// month returns the first day of the given month
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
+)
+
+// csvType is the media type of CSV files
+const csvType = "text/csv"
+
+// jsonLinesTypes are the media types accepted for JSON Lines (NDJSON) files
+var jsonLinesTypes = []string{"application/x-ndjson", "application/jsonl", "application/json-lines"}
+
+// csvColumns are the columns of an imported CSV file; every one but end_date is required
+var csvColumns = []string{"service_name", "price", "user_id", "start_date", "end_date"}
+
+// importLine is one row of an imported file: the request it holds, or why it cannot be created
+type importLine struct {
+	line    int
+	request models.SubscriptionRequest
+	id      uint64
+	err     error
+}
+
+// ImportSubscriptions godoc
+// @Summary Import subscriptions
+// @Description Creates the subscriptions of a CSV file (with a header row naming the columns service_name, price, user_id, start_date and the optional end_date)
+// @Description or a JSON Lines file (one subscription creation request per line). Every row is validated and checked for overlaps with the existing
+// @Description subscriptions and the rows before it. In all_or_nothing mode no row is created if one fails; in best_effort mode the rows that pass are created.
+// @Description Files hold at most 1000 rows and 1 MiB, or 100000 rows and 100 MiB with the admin secret key.
+// @Tags subscriptions
+// @Accept text/csv,application/x-ndjson
+// @Produce json
+// @Param file body string true "CSV or JSON Lines file"
+// @Param mode query string false "What to do when some rows fail" Enums(all_or_nothing, best_effort) default(all_or_nothing)
+// @Param dry_run query bool false "Check the rows without creating them"
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
+// @Success 200 {object} models.ImportReport
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 413 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v1/subscriptions/import [post]
+func (h *SubscriptionHandler) ImportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	opts, err := validation.ParseImportQuery(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	// Admins import larger files, written with COPY when they are large
+	admin := actor.FromContext(r.Context()) == actor.APIKey
+	maxRows, maxBytes := validation.MaxImportRows, int64(validation.MaxImportBytes)
+	if admin {
+		maxRows, maxBytes = validation.MaxAdminImportRows, validation.MaxAdminImportBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	lines, err := readImport(r, maxRows)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	//Import the valid rows; in all-or-nothing mode an invalid row only lets them be checked
+	var rows []models.ImportRow
+	var valid []int
+	for i, l := range lines {
+		if l.err == nil {
+			rows = append(rows, models.ImportRow{Line: l.line, Request: l.request})
+			valid = append(valid, i)
+		}
+	}
+	repoOpts := opts
+	repoOpts.DryRun = opts.DryRun || (len(rows) < len(lines) && opts.Mode == models.ImportAllOrNothing)
+	repoOpts.Copy = admin && len(rows) > validation.CopyImportRows
+	if len(rows) > 0 {
+		outcomes, err := h.repo.Import(r.Context(), rows, repoOpts)
+		if err != nil {
+			utils.WriteError(w, r, err)
+			return
+		}
+		for n, i := range valid {
+			lines[i].id, lines[i].err = outcomes[n].ID, outcomes[n].Err
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(importReport(i18n.FromContext(r.Context()), opts, lines))
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// readImport reads the rows of the imported file, in the format given by its Content-Type.
+// Rows that cannot be read are reported with their error; a file that cannot be read at all,
+// has no rows or more than maxRows is an error.
+func readImport(r *http.Request, maxRows int) ([]importLine, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	var lines []importLine
+	switch {
+	case mediaType == csvType:
+		lines, err = readCSV(r.Body, maxRows)
+	case slices.Contains(jsonLinesTypes, mediaType):
+		lines, err = readJSONLines(r.Body, maxRows)
+	default:
+		err = fmt.Errorf("%w: Content-Type must be %s or one of %s", errors.ErrInvalidInput, csvType, strings.Join(jsonLinesTypes, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: the file has no rows", errors.ErrInvalidInput)
+	}
+	return lines, nil
+}
+
+// readCSV reads a CSV file whose first row names its columns
+func readCSV(body io.Reader, maxRows int) ([]importLine, error) {
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, readError(err, "the file is not valid CSV")
+	}
+
+	// Map the columns, ignoring case and a byte order mark
+	column := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("%w: unknown CSV column %q, the columns are %s", errors.ErrInvalidInput, name, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := column[name]; ok {
+			return nil, fmt.Errorf("%w: CSV column %q appears twice", errors.ErrInvalidInput, name)
+		}
+		column[name] = i
+	}
+	for _, name := range csvColumns[:4] {
+		if _, ok := column[name]; !ok {
+			return nil, fmt.Errorf("%w: CSV column %q is missing", errors.ErrInvalidInput, name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := column[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	var lines []importLine
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if len(lines) == maxRows {
+			return nil, fmt.Errorf("%w: the file has more than %d rows", errors.ErrInvalidInput, maxRows)
+		}
+
+		var perr *csv.ParseError
+		if stderrors.As(err, &perr) && stderrors.Is(err, csv.ErrFieldCount) {
+			err = fmt.Errorf("%w: the row has %d fields, the header %d", errors.ErrInvalidInput, len(record), len(header))
+			lines = append(lines, importLine{line: perr.StartLine, err: err})
+			continue
+		}
+		if err != nil {
+			return nil, readError(err, "the file is not valid CSV")
+		}
+
+		line, _ := reader.FieldPos(0)
+		req, err := validation.SubscriptionRecord(field(record, "service_name"), field(record, "price"),
+			field(record, "user_id"), field(record, "start_date"), field(record, "end_date"))
+		lines = append(lines, importLine{line: line, request: req, err: err})
+	}
+}
+
+// readJSONLines reads a JSON Lines file, skipping blank lines
+func readJSONLines(body io.Reader, maxRows int) ([]importLine, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []importLine
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(lines) == maxRows {
+			return nil, fmt.Errorf("%w: the file has more than %d rows", errors.ErrInvalidInput, maxRows)
+		}
+
+		var req models.SubscriptionRequest
+		if err := json.Unmarshal([]byte(text), &req); err != nil {
+			err = fmt.Errorf("%w: the line is not a subscription creation request: %v", errors.ErrInvalidInput, err)
+			lines = append(lines, importLine{line: n, err: err})
+			continue
+		}
+		lines = append(lines, importLine{line: n, request: req, err: validation.SubscriptionRequest(req)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, readError(err, "reading the file")
+	}
+	return lines, nil
+}
+
+// readError reports an error reading the file after what went wrong, unless the file is too large
+func readError(err error, what string) error {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: the file is larger than %d bytes", errors.ErrPayloadTooLarge, tooLarge.Limit)
+	}
+	return fmt.Errorf("%w: %s: %v", errors.ErrInvalidInput, what, err)
+}
+
+// importReport reports every row of an import, its errors translated into lang
+func importReport(lang i18n.Lang, opts models.ImportOptions, lines []importLine) models.ImportReport {
+	report := models.ImportReport{Mode: opts.Mode, DryRun: opts.DryRun, Total: len(lines), Rows: make([]models.ImportRowResult, len(lines))}
+	for i, l := range lines {
+		row := models.ImportRowResult{Line: l.line, ID: l.id}
+		switch {
+		case l.id != 0:
+			row.Status = models.ImportCreated
+			report.Created++
+		case l.err != nil:
+			p := problem.New(l.err, "", lang)
+			row.Status, row.Code, row.Detail, row.Errors = models.ImportFailed, p.Code, p.Detail, p.Errors
+			report.Failed++
+		case opts.DryRun:
+			row.Status = models.ImportValid
+		default:
+			row.Status = models.ImportSkipped
+		}
+		report.Rows[i] = row
+	}
+	return report
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// subscriptionID gets the subscription ID from the URL, converts and validates it
+func subscriptionID(r *http.Request) (uint64, error) {
+	var v validation.Validator
+	id := v.ParseSubscriptionID("id", chi.URLParam(r, "id"))
+	return id, v.Err()
+}
+
+// userID gets the user ID from the URL and validates it
+func userID(r *http.Request) (uuid.UUID, error) {
+	var v validation.Validator
+	id := v.ParseUserID("user_id", chi.URLParam(r, "user_id"))
+	return id, v.Err()
+}
+
+// parseCostQuery gets the user ID from the URL and the service name and date range from the
+// query, reporting every invalid parameter at once
+func parseCostQuery(r *http.Request) (validation.CostQuery, error) {
+	q := r.URL.Query()
+	return validation.ParseCostQuery(chi.URLParam(r, "user_id"), q.Get("service_name"), q.Get("from"), q.Get("to"))
+}
+
+// mergePatchType is the media type of JSON Merge Patch (RFC 7396) documents
+const mergePatchType = "application/merge-patch+json"
+
+// isMergePatch reports whether the request body is a JSON Merge Patch
+func isMergePatch(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == mergePatchType
+}
+
+// isLegacyDelete reports whether a PATCH request is the legacy verb of DELETE: it has neither a
+// Content-Type nor a body. A body of unknown length is peeked at and left for the handler.
+func isLegacyDelete(r *http.Request) bool {
+	if r.Header.Get("Content-Type") != "" || r.ContentLength > 0 {
+		return false
+	}
+	if r.ContentLength == 0 || r.Body == nil {
+		return true
+	}
+	var first [1]byte
+	n, _ := io.ReadFull(r.Body, first[:])
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(first[:n]), r.Body), r.Body}
+	return n == 0
+}
+
+// etag returns the ETag of a subscription version
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatch gets the subscription version required by the If-Match header. The header must hold
+// one ETag sent by this API: ErrPreconditionRequired if it is missing (or "*"), ErrVersionMismatch
+// if it cannot match any version (e.g. a weak ETag).
+func ifMatch(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, fmt.Errorf("%w: send the ETag of the subscription in If-Match", errors.ErrPreconditionRequired)
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, `"`) {
+		return 0, fmt.Errorf("%w: If-Match %s is not a current ETag", errors.ErrVersionMismatch, value)
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil {
+		return 0, fmt.Errorf("%w: If-Match %s is not a current ETag", errors.ErrVersionMismatch, value)
+	}
+	return version, nil
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
+)
+
+// V2Handler serves the /v2 API. Requests are the same as in v1; responses use ISO 8601
+// dates ("YYYY-MM-DD") and snake_case keys. Endpoints whose shape did not change
+// (create, import, renew, delete, restore, purge, history, audit log) are served by the embedded v1 handler.
+type V2Handler struct {
+	*SubscriptionHandler
+}
+
+func NewV2(h *SubscriptionHandler) *V2Handler {
+	return &V2Handler{SubscriptionHandler: h}
+}
+
+// GetSubscriptions godoc
+// @Summary Get all subscriptions (Admin Only)
+// @Description Retrieves complete list of all subscriptions with ISO 8601 dates. Requires admin privileges.
+// @Tags v2
+// @Produce json
+// @Security AdminAuth
+// @Success 200 {array} models.AdminSubscriptionResponseV2
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions [get]
+func (h *V2Handler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	//Get all subscriptions by admin
+	subscriptions, err := h.repo.GetAll(r.Context())
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	resp := make([]models.AdminSubscriptionResponseV2, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		resp = append(resp, models.NewAdminSubscriptionResponseV2(sub))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// GetSubscriptionByID godoc
+// @Summary Get a specific subscription by ID
+// @Description Retrieves a specific subscription by its numeric ID, with ISO 8601 dates. The ETag header holds its version.
+// @Tags v2
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Success 200 {object} models.SubscriptionResponseV2
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id} [get]
+func (h *V2Handler) GetSubscriptionByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the subscription ID from the URL and validate it
+	id, err := subscriptionID(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	// Get the subscription
+	subscription, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(subscription.Version))
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(models.NewSubscriptionResponseV2(subscription))
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// GetSubscriptionByUserID godoc
+// @Summary Get all subscriptions for a user
+// @Description Retrieves all subscriptions for a specific user, with ISO 8601 dates
+// @Tags v2
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {array} models.SubscriptionResponseV2
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/user/{user_id} [get]
+func (h *V2Handler) GetSubscriptionByUserID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the user ID from the URL and validate it
+	user_id, err := userID(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	// Get the subscriptions
+	subscriptions, err := h.repo.GetByUserID(r.Context(), user_id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	resp := make([]models.SubscriptionResponseV2, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		resp = append(resp, models.NewSubscriptionResponseV2(sub))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// GetDeletedSubscriptionsByUserID godoc
+// @Summary List the trash of a user
+// @Description Retrieves the soft-deleted subscriptions of a user, most recently deleted first, with ISO 8601 dates
+// @Tags v2
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {array} models.DeletedSubscriptionResponseV2
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/user/{user_id}/trash [get]
+func (h *V2Handler) GetDeletedSubscriptionsByUserID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the user ID from the URL and validate it
+	user_id, err := userID(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	// Get the deleted subscriptions
+	subscriptions, err := h.repo.GetDeletedByUserID(r.Context(), user_id)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	resp := make([]models.DeletedSubscriptionResponseV2, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		resp = append(resp, models.NewDeletedSubscriptionResponseV2(sub))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// GetCostByDateRange godoc
+// @Summary Get the cost of a subscription for a specific date range
+// @Description Retrieves the cost of a subscription for a specific date range (dates in MM-YYYY format)
+// @Tags v2
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name query string true "Service Name"
+// @Param from query string true "Start Date (MM-YYYY)"
+// @Param to query string true "End Date (MM-YYYY)"
+// @Success 200 {object} models.CostResponseV2
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/costs/{user_id} [get]
+func (h *V2Handler) GetCostByDateRange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// get the user id, service name and date range and validate them
+	q, err := parseCostQuery(r)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	// get the cost
+	totalcost, err := h.repo.GetCost(r.Context(), q.UserID, q.ServiceName, q.From, q.To)
+	if err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(models.CostResponseV2{TotalCost: totalcost})
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// CreateSubscription godoc
+// @Summary Create a new subscription
+// @Description Creates a new subscription for a user (same as v1)
+// @Tags v2
+// @Accept json
+// @Produce json
+// @Param request body models.SubscriptionRequest true "Subscription creation data"
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions [post]
+func (h *V2Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.CreateSubscription(w, r)
+}
+
+// ImportSubscriptions godoc
+// @Summary Import subscriptions
+// @Description Creates the subscriptions of a CSV or JSON Lines file, reporting every row (same as v1)
+// @Tags v2
+// @Accept text/csv,application/x-ndjson
+// @Produce json
+// @Param file body string true "CSV or JSON Lines file"
+// @Param mode query string false "What to do when some rows fail" Enums(all_or_nothing, best_effort) default(all_or_nothing)
+// @Param dry_run query bool false "Check the rows without creating them"
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
+// @Success 200 {object} models.ImportReport
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/import [post]
+func (h *V2Handler) ImportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.ImportSubscriptions(w, r)
+}
+
+// RenewOrExtendSubscription godoc
+// @Summary Renew or extend a subscription
+// @Description Renews or extends an existing subscription (same as v1)
+// @Tags v2
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id} [post]
+func (h *V2Handler) RenewOrExtendSubscription(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.RenewOrExtendSubscription(w, r)
+}
+
+// UpdateSubscription godoc
+// @Summary Update a subscription
+// @Description Applies a JSON Merge Patch to a subscription guarded by If-Match (same as v1), answering with ISO 8601 dates
+// @Tags v2
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Param If-Match header string true "ETag of the subscription"
+// @Param request body models.SubscriptionPatch true "Fields to change"
+// @Success 200 {object} models.SubscriptionResponseV2
+// @Header 200 {string} ETag "New version of the subscription"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 412 {object} utils.ErrorResponse
+// @Failure 415 {object} utils.ErrorResponse
+// @Failure 428 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id} [patch]
+func (h *V2Handler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.update(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(models.NewSubscriptionResponseV2(subscription))
+	if err != nil {
+		err = errors.ErrEncodingJSON
+		utils.WriteError(w, r, err)
+		return
+	}
+}
+
+// DeleteSubscription godoc
+// @Summary Soft delete a subscription
+// @Description Marks a subscription as deleted (same as v1)
+// @Tags v2
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id} [delete]
+func (h *V2Handler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.DeleteSubscription(w, r)
+}
+
+// RestoreSubscription godoc
+// @Summary Restore a soft-deleted subscription
+// @Description Un-deletes a subscription unless it overlaps a current one (same as v1)
+// @Tags v2
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Param Idempotency-Key header string false "Key under which retries get the response of the first request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id}/restore [post]
+func (h *V2Handler) RestoreSubscription(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.RestoreSubscription(w, r)
+}
+
+// PurgeSubscription godoc
+// @Summary Permanently delete a subscription (Admin Only)
+// @Description Removes a soft-deleted subscription for good (same as v1)
+// @Tags v2
+// @Produce json
+// @Security AdminAuth
+// @Param id path int true "Subscription ID" minimum(1)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id}/purge [delete]
+func (h *V2Handler) PurgeSubscription(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.PurgeSubscription(w, r)
+}
+
+// GetSubscriptionHistory godoc
+// @Summary Get the history of a subscription
+// @Description Lists the audit log of a subscription, oldest first (same as v1)
+// @Tags v2
+// @Produce json
+// @Param id path int true "Subscription ID" minimum(1)
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/subscriptions/{id}/history [get]
+func (h *V2Handler) GetSubscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.GetSubscriptionHistory(w, r)
+}
+
+// SearchAuditLog godoc
+// @Summary Search the audit log (Admin Only)
+// @Description Lists the changes of every subscription, newest first (same as v1)
+// @Tags v2
+// @Produce json
+// @Security AdminAuth
+// @Param subscription_id query int false "Subscription ID" minimum(1)
+// @Param user_id query string false "User ID"
+// @Param actor query string false "Actor, e.g. user, api_key or system:retention"
+// @Param action query string false "Action" Enums(create, renew, update, delete, restore, purge)
+// @Param from query string false "Earliest change (RFC 3339)"
+// @Param to query string false "End of the period, excluded (RFC 3339)"
+// @Param limit query int false "Maximum number of events" minimum(1) maximum(1000) default(100)
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /v2/audit [get]
+func (h *V2Handler) SearchAuditLog(w http.ResponseWriter, r *http.Request) {
+	h.SubscriptionHandler.SearchAuditLog(w, r)
+}
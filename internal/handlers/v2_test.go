@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestV2(t *testing.T) {
+	byID := func(id uint64) (models.SubscriptionResponse, error) {
+		if id != 3 {
+			return models.SubscriptionResponse{}, errNotFound
+		}
+		return subscription(3, "Kinopoisk", 299, month(2025, time.March), 2), nil
+	}
+	byUser := func(uuid.UUID) ([]models.SubscriptionResponse, error) {
+		return []models.SubscriptionResponse{subscription(1, "Yandex Plus", 400, month(2025, time.January), 12)}, nil
+	}
+	all := func() ([]models.AdminSubscriptionResponse, error) {
+		sub := subscription(1, "Yandex Plus", 400, month(2025, time.July), 1)
+		return []models.AdminSubscriptionResponse{{
+			ID: sub.ID, ServiceName: sub.ServiceName, Price: sub.Price, UserID: sub.UserID,
+			StartDate: sub.StartDate, EndDate: sub.EndDate, StartTime: sub.StartTime, EndTime: sub.EndTime,
+		}}, nil
+	}
+	cost := func(uuid.UUID, string, time.Time, time.Time) (int, error) { return 2400, nil }
+	trash := func(uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+		return []models.DeletedSubscriptionResponse{{
+			SubscriptionResponse: subscription(2, "Kinopoisk", 299, month(2025, time.March), 1),
+			DeletedAt:            time.Date(2025, time.July, 15, 10, 30, 0, 0, time.UTC),
+		}}, nil
+	}
+
+	run(t, []testCase{
+		{name: "get_by_id", method: http.MethodGet, path: "/v2/subscriptions/3",
+			repo: fakeRepo{getByID: byID}, status: http.StatusOK},
+		{name: "get_by_id_not_found", method: http.MethodGet, path: "/v2/subscriptions/4",
+			repo: fakeRepo{getByID: byID}, status: http.StatusNotFound},
+		{name: "get_by_user", method: http.MethodGet, path: "/v2/subscriptions/user/" + userID.String(),
+			repo: fakeRepo{getByUserID: byUser}, status: http.StatusOK},
+		{name: "get_all", method: http.MethodGet, path: "/v2/subscriptions",
+			headers: map[string]string{"secret-key": adminKey},
+			repo:    fakeRepo{getAll: all}, status: http.StatusOK},
+		{name: "cost", method: http.MethodGet, path: "/v2/costs/" + userID.String() + "?service_name=Yandex+Plus&from=01-2025&to=06-2025",
+			repo: fakeRepo{getCost: cost}, status: http.StatusOK},
+		{name: "cost_invalid", method: http.MethodGet, path: "/v2/costs/" + userID.String(),
+			status: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, path: "/v2/subscriptions/3",
+			repo: fakeRepo{delete: func(uint64) (bool, error) { return true, nil }}, status: http.StatusOK},
+		{name: "trash", method: http.MethodGet, path: "/v2/subscriptions/user/" + userID.String() + "/trash",
+			repo: fakeRepo{getDeletedByUserID: trash}, status: http.StatusOK},
+		{name: "restore", method: http.MethodPost, path: "/v2/subscriptions/3/restore",
+			repo: fakeRepo{restore: func(uint64) (bool, error) { return true, nil }}, status: http.StatusOK},
+	})
+}
+
+// TestDeprecatedAliases checks that the unversioned routes answer like /v1 with deprecation headers
+func TestDeprecatedAliases(t *testing.T) {
+	run(t, []testCase{
+		{name: "get_by_id", method: http.MethodGet, path: "/subscriptions/3",
+			repo: fakeRepo{getByID: func(uint64) (models.SubscriptionResponse, error) {
+				return subscription(3, "Kinopoisk", 299, month(2025, time.March), 2), nil
+			}},
+			status: http.StatusOK},
+		{name: "invalid_id", method: http.MethodGet, path: "/subscriptions/abc",
+			status: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, path: "/subscriptions/3",
+			repo: fakeRepo{delete: func(uint64) (bool, error) { return true, nil }}, status: http.StatusOK},
+	})
+}
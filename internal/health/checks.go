@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrMigrationsPending = errors.New("database migrations are not at the expected version")
+	ErrWorkerStopped     = errors.New("background worker is not running")
+)
+
+// Worker is a background worker whose liveness is reported by the readiness endpoint
+type Worker interface {
+	Running() bool
+}
+
+// DatabaseCheck verifies the database is reachable by pinging it through the pool
+func DatabaseCheck(pool *pgxpool.Pool) CheckFunc {
+	return func(ctx context.Context) error {
+		if err := pool.Ping(ctx); err != nil {
+			return fmt.Errorf("error pinging database: %w", err)
+		}
+		return nil
+	}
+}
+
+// MigrationCheck verifies the latest applied goose migration matches the expected version
+func MigrationCheck(pool *pgxpool.Pool, expected int64) CheckFunc {
+	return func(ctx context.Context) error {
+		var current int64
+		err := pool.QueryRow(ctx, "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&current)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("error getting migration version: %w", err)
+		}
+		if current != expected {
+			return fmt.Errorf("%w: expected %d, got %d", ErrMigrationsPending, expected, current)
+		}
+		return nil
+	}
+}
+
+// WorkerCheck reports an error while the worker is not running
+func WorkerCheck(w Worker) CheckFunc {
+	return func(ctx context.Context) error {
+		if !w.Running() {
+			return ErrWorkerStopped
+		}
+		return nil
+	}
+}
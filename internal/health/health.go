@@ -0,0 +1,138 @@
+// Package health implements the liveness (/healthz) and readiness (/readyz) endpoints.
+//
+// Liveness only reports that the process is serving HTTP. Readiness runs every registered
+// check (database, migrations, background workers, ...) concurrently, each bounded by a timeout,
+// and answers 503 if any of them fails so that orchestrators stop routing traffic to the instance.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+
+	// DefaultTimeout bounds each readiness check when no timeout is configured
+	DefaultTimeout = 2 * time.Second
+)
+
+// CheckFunc reports whether a dependency is healthy; a non-nil error marks it as unavailable
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of a single readiness check
+// swagger:model CheckResult
+type CheckResult struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Response is the body returned by /healthz and /readyz
+// swagger:model HealthResponse
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker holds the readiness checks
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// New creates a Checker running each readiness check with the given timeout
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// AddCheck registers a named readiness check. It must be called before serving requests.
+func (c *Checker) AddCheck(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run executes every check concurrently and returns the aggregated result
+func (c *Checker) Run(ctx context.Context) Response {
+	resp := Response{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ch.fn(ctx)
+			result := CheckResult{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[ch.name] = result
+			if err != nil {
+				resp.Status = StatusUnavailable
+			}
+		}(ch)
+	}
+	wg.Wait()
+
+	return resp
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Reports that the process is alive and serving HTTP. Does not check dependencies.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Response
+// @Router /healthz [get]
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, Response{Status: StatusOK})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Runs every dependency check (database, migrations, background workers) and reports each result
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Response
+// @Failure 503 {object} health.Response
+// @Router /readyz [get]
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	resp := c.Run(r.Context())
+
+	status := http.StatusOK
+	if resp.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeResponse(w, status, resp)
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,113 @@
+package i18n
+
+// Key identifies a message of the catalog
+type Key string
+
+// Success messages
+const (
+	SubscriptionCreated Key = "subscription.created"
+	SubscriptionRenewed Key = "subscription.renewed"
+	SubscriptionDeleted Key = "subscription.deleted"
+
+	SubscriptionAlreadyDeleted Key = "subscription.already_deleted"
+	SubscriptionRestored       Key = "subscription.restored"
+	SubscriptionNotDeleted     Key = "subscription.not_deleted"
+	SubscriptionPurged         Key = "subscription.purged"
+)
+
+// Validation messages, one per kind of violation
+const (
+	ValidationRequired        Key = "validation.required"
+	ValidationTooLong         Key = "validation.too_long"    // max length
+	ValidationPriceRange      Key = "validation.price_range" // min, max price
+	ValidationUUID            Key = "validation.uuid"
+	ValidationPositiveInteger Key = "validation.positive_integer"
+	ValidationMonthFormat     Key = "validation.month_format"
+	ValidationYearRange       Key = "validation.year_range" // min, max year
+	ValidationBeforeStart     Key = "validation.before_start"
+	ValidationTimestamp       Key = "validation.timestamp"
+	ValidationOneOf           Key = "validation.one_of"    // allowed values
+	ValidationIntRange        Key = "validation.int_range" // min, max
+)
+
+// ProblemTitle returns the key of the title of the problem kind with the given code
+func ProblemTitle(code string) Key {
+	return Key("problem." + code)
+}
+
+var catalog = map[Lang]map[Key]string{
+	EN: {
+		SubscriptionCreated: "subscription created successfully",
+		SubscriptionRenewed: "subscription renewed successfully",
+		SubscriptionDeleted: "subscription deleted successfully",
+
+		SubscriptionAlreadyDeleted: "subscription was already deleted",
+		SubscriptionRestored:       "subscription restored successfully",
+		SubscriptionNotDeleted:     "subscription was not deleted",
+		SubscriptionPurged:         "subscription permanently deleted",
+
+		ProblemTitle("subscription_not_found"):      "No subscription found",
+		ProblemTitle("invalid_input"):               "Validation failed",
+		ProblemTitle("subscription_already_exists"): "Subscription already exists",
+		ProblemTitle("malformed_request"):           "Invalid request format",
+		ProblemTitle("response_encoding_failed"):    "Failed to process response",
+		ProblemTitle("unauthorized"):                "Unauthorized",
+		ProblemTitle("subscription_not_deleted"):    "Subscription is not deleted",
+		ProblemTitle("version_mismatch"):            "Subscription was modified",
+		ProblemTitle("precondition_required"):       "Precondition required",
+		ProblemTitle("idempotency_key_reused"):      "Idempotency key reused",
+		ProblemTitle("idempotency_key_in_use"):      "Request with this idempotency key in progress",
+		ProblemTitle("unsupported_media_type"):      "Unsupported media type",
+		ProblemTitle("payload_too_large"):           "Payload too large",
+		ProblemTitle("internal_error"):              "Internal server error",
+
+		ValidationRequired:        "is required",
+		ValidationTooLong:         "must be at most %d characters",
+		ValidationPriceRange:      "must be between %d and %d rubles",
+		ValidationUUID:            "must be a UUID",
+		ValidationPositiveInteger: "must be a positive integer",
+		ValidationMonthFormat:     "must be a month in MM-YYYY format",
+		ValidationYearRange:       "year must be between %d and %d",
+		ValidationBeforeStart:     "must not be before the start date",
+		ValidationTimestamp:       "must be an RFC 3339 timestamp",
+		ValidationOneOf:           "must be one of %s",
+		ValidationIntRange:        "must be between %d and %d",
+	},
+	RU: {
+		SubscriptionCreated: "подписка успешно создана",
+		SubscriptionRenewed: "подписка успешно продлена",
+		SubscriptionDeleted: "подписка успешно удалена",
+
+		SubscriptionAlreadyDeleted: "подписка уже была удалена",
+		SubscriptionRestored:       "подписка успешно восстановлена",
+		SubscriptionNotDeleted:     "подписка не была удалена",
+		SubscriptionPurged:         "подписка удалена навсегда",
+
+		ProblemTitle("subscription_not_found"):      "Подписка не найдена",
+		ProblemTitle("invalid_input"):               "Ошибка валидации",
+		ProblemTitle("subscription_already_exists"): "Подписка уже существует",
+		ProblemTitle("malformed_request"):           "Неверный формат запроса",
+		ProblemTitle("response_encoding_failed"):    "Не удалось сформировать ответ",
+		ProblemTitle("unauthorized"):                "Требуется авторизация",
+		ProblemTitle("subscription_not_deleted"):    "Подписка не удалена",
+		ProblemTitle("version_mismatch"):            "Подписка была изменена",
+		ProblemTitle("precondition_required"):       "Требуется предусловие",
+		ProblemTitle("idempotency_key_reused"):      "Ключ идемпотентности уже использован",
+		ProblemTitle("idempotency_key_in_use"):      "Запрос с этим ключом идемпотентности выполняется",
+		ProblemTitle("unsupported_media_type"):      "Неподдерживаемый тип содержимого",
+		ProblemTitle("payload_too_large"):           "Слишком большой запрос",
+		ProblemTitle("internal_error"):              "Внутренняя ошибка сервера",
+
+		ValidationRequired:        "обязательное поле",
+		ValidationTooLong:         "длина не должна превышать %d символов",
+		ValidationPriceRange:      "цена должна быть от %d до %d рублей",
+		ValidationUUID:            "значение должно быть UUID",
+		ValidationPositiveInteger: "значение должно быть положительным целым числом",
+		ValidationMonthFormat:     "значение должно быть месяцем в формате MM-YYYY",
+		ValidationYearRange:       "год должен быть от %d до %d",
+		ValidationBeforeStart:     "дата не может быть раньше даты начала",
+		ValidationTimestamp:       "значение должно быть временем в формате RFC 3339",
+		ValidationOneOf:           "значение должно быть одним из: %s",
+		ValidationIntRange:        "значение должно быть от %d до %d",
+	},
+}
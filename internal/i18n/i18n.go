@@ -0,0 +1,149 @@
+// Package i18n translates the texts returned by the API.
+//
+// Key behaviors:
+//   - The catalog holds every message in English (en) and Russian (ru), keyed by Key
+//   - Messages are fmt formats; arguments are passed to Translate
+//   - Missing translations fall back to English, then to the key itself
+//   - The language of a request is its "lang" query parameter (the user's explicit preference),
+//     else the best match of its Accept-Language header, else the configured default
+//   - Middleware stores the language in the request context; T translates for a context
+//   - Errors implementing Localizer (validation errors) are translated with Localize
+package i18n
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Lang is a supported language
+type Lang string
+
+// Supported languages
+const (
+	EN Lang = "en"
+	RU Lang = "ru"
+)
+
+// Languages lists the supported languages, the fallback (English) first
+var Languages = []Lang{EN, RU}
+
+// LangParam is the query parameter selecting the language of a request
+const LangParam = "lang"
+
+var matcher = language.NewMatcher([]language.Tag{language.English, language.Russian})
+
+// ParseLang returns the supported language named by s ("ru", "RU", "ru-RU", ...)
+func ParseLang(s string) (Lang, error) {
+	tag, err := language.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return "", fmt.Errorf("unknown language %q", s)
+	}
+	base, _ := tag.Base()
+	for _, lang := range Languages {
+		if base.String() == string(lang) {
+			return lang, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported language %q, must be one of en or ru", s)
+}
+
+// MatchAcceptLanguage returns the supported language best matching an Accept-Language
+// header, and false if none matches
+func MatchAcceptLanguage(header string) (Lang, bool) {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return "", false
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return "", false
+	}
+	return Languages[index], true
+}
+
+// Lookup returns the message of key in lang, falling back to English
+func Lookup(lang Lang, key Key) (string, bool) {
+	if msg, ok := catalog[lang][key]; ok {
+		return msg, true
+	}
+	msg, ok := catalog[EN][key]
+	return msg, ok
+}
+
+// Translate returns the message of key in lang formatted with args. Unknown keys are returned as is.
+func Translate(lang Lang, key Key, args ...any) string {
+	msg, ok := Lookup(lang, key)
+	if !ok {
+		return string(key)
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// T translates key into the language of ctx
+func T(ctx context.Context, key Key, args ...any) string {
+	return Translate(FromContext(ctx), key, args...)
+}
+
+type ctxKey struct{}
+
+// WithLang returns a copy of ctx carrying lang
+func WithLang(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, ctxKey{}, lang)
+}
+
+// FromContext returns the language stored in ctx, or English if there is none
+func FromContext(ctx context.Context) Lang {
+	if lang, ok := ctx.Value(ctxKey{}).(Lang); ok {
+		return lang
+	}
+	return EN
+}
+
+// Localizer is implemented by errors whose messages can be translated
+type Localizer interface {
+	Localize(lang Lang) error
+}
+
+// Localize returns the translation of err into lang if err (or an error in its chain)
+// implements Localizer, and err otherwise
+func Localize(err error, lang Lang) error {
+	var l Localizer
+	if errors.As(err, &l) {
+		return l.Localize(lang)
+	}
+	return err
+}
+
+// Middleware stores the language of each request in its context (see the package
+// documentation for how it is chosen) and announces it in the Content-Language header
+func Middleware(fallback Lang) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lang := RequestLang(r, fallback)
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Set("Content-Language", string(lang))
+			next.ServeHTTP(w, r.WithContext(WithLang(r.Context(), lang)))
+		})
+	}
+}
+
+// RequestLang returns the language of r, or fallback if it names no supported language
+func RequestLang(r *http.Request, fallback Lang) Lang {
+	if pref := r.URL.Query().Get(LangParam); pref != "" {
+		if lang, err := ParseLang(pref); err == nil {
+			return lang
+		}
+	}
+	if lang, ok := MatchAcceptLanguage(r.Header.Get("Accept-Language")); ok {
+		return lang
+	}
+	return fallback
+}
@@ -0,0 +1,72 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var verb = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// TestCatalogComplete checks that every key exists in every locale with the same format verbs
+func TestCatalogComplete(t *testing.T) {
+	keys := map[Key]bool{}
+	for _, messages := range catalog {
+		for key := range messages {
+			keys[key] = true
+		}
+	}
+	for _, lang := range Languages {
+		messages, ok := catalog[lang]
+		if !ok {
+			t.Errorf("no catalog for %s", lang)
+			continue
+		}
+		for key := range keys {
+			msg, ok := messages[key]
+			if !ok || msg == "" {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if got, want := verb.FindAllString(msg, -1), verb.FindAllString(catalog[EN][key], -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %q has verbs %q, want %q as in English", lang, key, got, want)
+			}
+		}
+	}
+}
+
+func TestRequestLang(t *testing.T) {
+	tests := []struct {
+		target, accept string
+		want           Lang
+	}{
+		{"/", "", EN},
+		{"/", "ru-RU,ru;q=0.9,en;q=0.8", RU},
+		{"/", "en-US,en;q=0.9", EN},
+		{"/", "de-DE", EN},
+		{"/", "de-DE,ru;q=0.5", RU},
+		{"/?lang=ru", "en", RU},
+		{"/?lang=en", "ru", EN},
+		{"/?lang=xx", "ru", RU},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept-Language", tt.accept)
+		}
+		if got := RequestLang(r, EN); got != tt.want {
+			t.Errorf("RequestLang(%s, Accept-Language %q) = %s, want %s", tt.target, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if got := Translate(RU, ValidationPriceRange, 1, 1000); got != "цена должна быть от 1 до 1000 рублей" {
+		t.Errorf("Translate(ru) = %q", got)
+	}
+	if got := Translate(RU, "unknown.key"); got != "unknown.key" {
+		t.Errorf("Translate(unknown) = %q", got)
+	}
+}
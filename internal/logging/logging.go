@@ -0,0 +1,147 @@
+// Package logging configures the application's structured logger (log/slog)
+// and carries request-scoped values such as the request ID through context.
+//
+// Key behaviors:
+//   - Level ("debug", "info", "warn", "error") and format ("json", "text") are configurable
+//   - Records logged with a context automatically get the request_id attribute
+//   - Sensitive attributes (secret-key, Authorization) are always redacted
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	// RequestIDKey is the attribute key used for the request ID in log records
+	RequestIDKey = "request_id"
+
+	redactedValue = "[REDACTED]"
+)
+
+// sensitiveKeys lists attribute keys (lower-cased) whose values must never be logged
+var sensitiveKeys = map[string]struct{}{
+	"secret-key":    {},
+	"authorization": {},
+}
+
+var (
+	ErrInvalidLevel  = errors.New("invalid log level")
+	ErrInvalidFormat = errors.New("invalid log format")
+)
+
+type ctxKey struct{}
+
+// New creates a logger writing to w with the given level and format.
+// Empty level and format default to "info" and "json".
+//
+// Returns:
+//   - ErrInvalidLevel / ErrInvalidFormat wrapped with the offending value
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel converts a level name into a slog.Level. Empty input means info.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLevel, level)
+	}
+}
+
+// WithRequestID returns a copy of ctx carrying the given request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or "" if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// ErrorChain unwraps err and returns the message of every error in the chain,
+// outermost first. Errors joined with errors.Join or multiple %w verbs are walked depth-first.
+func ErrorChain(err error) []string {
+	var chain []string
+	var walk func(error)
+	walk = func(e error) {
+		if e == nil {
+			return
+		}
+		chain = append(chain, e.Error())
+		switch u := e.(type) {
+		case interface{ Unwrap() error }:
+			walk(u.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, inner := range u.Unwrap() {
+				walk(inner)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
+
+// redact replaces the value of sensitive attributes, including ones nested in groups
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if _, ok := sensitiveKeys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, redactedValue)
+	}
+	return a
+}
+
+// contextHandler adds request-scoped attributes from the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsTimeout bounds the database query issued when business gauges are scraped
+const statsTimeout = 2 * time.Second
+
+// poolCollector exposes pgxpool statistics, read from pool.Stat() at scrape time
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired        *prometheus.Desc
+	idle            *prometheus.Desc
+	total           *prometheus.Desc
+	max             *prometheus.Desc
+	acquireCount    *prometheus.Desc
+	acquireDuration *prometheus.Desc
+	emptyAcquire    *prometheus.Desc
+	canceledAcquire *prometheus.Desc
+}
+
+// NewPoolCollector returns a collector for the connection statistics of pool
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:            pool,
+		acquired:        desc("acquired_connections", "Number of connections currently acquired from the pool."),
+		idle:            desc("idle_connections", "Number of idle connections in the pool."),
+		total:           desc("total_connections", "Total number of connections in the pool."),
+		max:             desc("max_connections", "Maximum size of the pool."),
+		acquireCount:    desc("acquires_total", "Number of successful connection acquires."),
+		acquireDuration: desc("acquire_wait_seconds_total", "Total time spent waiting to acquire a connection."),
+		emptyAcquire:    desc("empty_acquires_total", "Number of acquires that had to wait because the pool was empty."),
+		canceledAcquire: desc("canceled_acquires_total", "Number of acquires canceled by their context."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
+
+// StatsProvider is implemented by repositories able to report business statistics
+type StatsProvider interface {
+	Stats(ctx context.Context) (models.SubscriptionStats, error)
+}
+
+// businessCollector exposes business gauges computed by a StatsProvider at scrape time
+type businessCollector struct {
+	provider StatsProvider
+
+	active         *prometheus.Desc
+	activePriceSum *prometheus.Desc
+	deleted        *prometheus.Desc
+}
+
+// NewBusinessCollector returns a collector for business gauges such as the number of active subscriptions
+func NewBusinessCollector(provider StatsProvider) prometheus.Collector {
+	return &businessCollector{
+		provider:       provider,
+		active:         prometheus.NewDesc(namespace+"_active", "Number of active (not deleted, not expired) subscriptions.", nil, nil),
+		activePriceSum: prometheus.NewDesc(namespace+"_active_price_sum_rubles", "Sum of prices of active subscriptions in rubles.", nil, nil),
+		deleted:        prometheus.NewDesc(namespace+"_deleted", "Number of soft-deleted subscriptions.", nil, nil),
+	}
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.activePriceSum
+	ch <- c.deleted
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.provider.Stats(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.active, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(stats.Active))
+	ch <- prometheus.MustNewConstMetric(c.activePriceSum, prometheus.GaugeValue, float64(stats.ActivePriceSum))
+	ch <- prometheus.MustNewConstMetric(c.deleted, prometheus.GaugeValue, float64(stats.Deleted))
+}
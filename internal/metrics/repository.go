@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	er "github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Repository decorates a SubscriptionRepository, recording latency and error counts per method
+type Repository struct {
+	next    repository.SubscriptionRepository
+	metrics *Metrics
+}
+
+var _ repository.SubscriptionRepository = (*Repository)(nil)
+
+func NewRepository(next repository.SubscriptionRepository, m *Metrics) *Repository {
+	return &Repository{
+		next:    next,
+		metrics: m,
+	}
+}
+
+// observe records the duration of a repository call started at began and counts its error, if any
+func (r *Repository) observe(method string, began time.Time, err error) {
+	r.metrics.repoDuration.WithLabelValues(method).Observe(time.Since(began).Seconds())
+	if err != nil {
+		r.metrics.repoErrors.WithLabelValues(method, errorKind(err)).Inc()
+	}
+}
+
+// errorKind classifies err by the sentinel from internal/pkg/errors it wraps
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, er.ErrSubscriptionNotFound):
+		return "not_found"
+	case errors.Is(err, er.ErrInvalidInput):
+		return "invalid_input"
+	case errors.Is(err, er.ErrAlreadyExists):
+		return "already_exists"
+	case errors.Is(err, er.ErrNotDeleted):
+		return "not_deleted"
+	case errors.Is(err, er.ErrVersionMismatch):
+		return "version_mismatch"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	default:
+		return "internal"
+	}
+}
+
+func (r *Repository) Create(ctx context.Context, sub *models.SubscriptionRequest) (uint64, error) {
+	began := time.Now()
+	id, err := r.next.Create(ctx, sub)
+	r.observe("Create", began, err)
+	return id, err
+}
+
+func (r *Repository) Import(ctx context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+	began := time.Now()
+	outcomes, err := r.next.Import(ctx, rows, opts)
+	r.observe("Import", began, err)
+	return outcomes, err
+}
+
+func (r *Repository) GetAll(ctx context.Context) ([]models.AdminSubscriptionResponse, error) {
+	began := time.Now()
+	subs, err := r.next.GetAll(ctx)
+	r.observe("GetAll", began, err)
+	return subs, err
+}
+
+func (r *Repository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	began := time.Now()
+	subs, err := r.next.GetByUserID(ctx, userID)
+	r.observe("GetByUserID", began, err)
+	return subs, err
+}
+
+func (r *Repository) GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	began := time.Now()
+	subs, err := r.next.GetByUserIDs(ctx, userIDs)
+	r.observe("GetByUserIDs", began, err)
+	return subs, err
+}
+
+func (r *Repository) GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error) {
+	began := time.Now()
+	sub, err := r.next.GetByID(ctx, id)
+	r.observe("GetByID", began, err)
+	return sub, err
+}
+
+func (r *Repository) Delete(ctx context.Context, id uint64) (bool, error) {
+	began := time.Now()
+	deleted, err := r.next.Delete(ctx, id)
+	r.observe("Delete", began, err)
+	return deleted, err
+}
+
+func (r *Repository) GetDeletedByUserID(ctx context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+	began := time.Now()
+	subs, err := r.next.GetDeletedByUserID(ctx, userID)
+	r.observe("GetDeletedByUserID", began, err)
+	return subs, err
+}
+
+func (r *Repository) GetHistory(ctx context.Context, id uint64) ([]models.AuditEvent, error) {
+	began := time.Now()
+	events, err := r.next.GetHistory(ctx, id)
+	r.observe("GetHistory", began, err)
+	return events, err
+}
+
+func (r *Repository) SearchHistory(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	began := time.Now()
+	events, err := r.next.SearchHistory(ctx, filter)
+	r.observe("SearchHistory", began, err)
+	return events, err
+}
+
+func (r *Repository) Restore(ctx context.Context, id uint64) (bool, error) {
+	began := time.Now()
+	restored, err := r.next.Restore(ctx, id)
+	r.observe("Restore", began, err)
+	return restored, err
+}
+
+func (r *Repository) Purge(ctx context.Context, id uint64) error {
+	began := time.Now()
+	err := r.next.Purge(ctx, id)
+	r.observe("Purge", began, err)
+	return err
+}
+
+func (r *Repository) RenewOrExtend(ctx context.Context, id uint64) (uint64, error) {
+	began := time.Now()
+	newID, err := r.next.RenewOrExtend(ctx, id)
+	r.observe("RenewOrExtend", began, err)
+	return newID, err
+}
+
+func (r *Repository) Update(ctx context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+	began := time.Now()
+	sub, err := r.next.Update(ctx, id, version, patch)
+	r.observe("Update", began, err)
+	return sub, err
+}
+
+func (r *Repository) GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
+	began := time.Now()
+	total, err := r.next.GetCost(ctx, userID, serviceName, start, end)
+	r.observe("GetCost", began, err)
+	return total, err
+}
+
+func (r *Repository) OverlapCheck(ctx context.Context, sub models.Subscription) error {
+	began := time.Now()
+	err := r.next.OverlapCheck(ctx, sub)
+	r.observe("OverlapCheck", began, err)
+	return err
+}
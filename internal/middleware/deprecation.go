@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DeprecationMiddleware marks responses of deprecated routes with the Deprecation (RFC 9745) and
+// Sunset (RFC 8594) headers, and a Link header pointing at the successor version of the route,
+// obtained by inserting successorPrefix (e.g. "/v1") in front of the route path.
+func DeprecationMiddleware(deprecatedAt, sunset time.Time, successorPrefix string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// When the router is mounted under a prefix, keep that prefix in front of the version
+			base, path := "", r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+				base, path = strings.TrimSuffix(r.URL.Path, rctx.RoutePath), rctx.RoutePath
+			}
+
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			w.Header().Add("Link", fmt.Sprintf("<%s%s%s>; rel=\"successor-version\"", base, successorPrefix, path))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
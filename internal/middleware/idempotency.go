@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// IdempotencyKeyHeader carries the key under which a request and its response are stored
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks the responses replayed to a retry
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyOptions configures IdempotencyMiddleware
+type IdempotencyOptions struct {
+	// TTL is how long a response is replayed to the retries of its request
+	TTL time.Duration
+	// LockTimeout is how long a request holds its key before a retry may run it again, should
+	// the server stop before storing the response
+	LockTimeout time.Duration
+	// MaxBodyBytes caps the request bodies buffered to be hashed, larger ones answering 413, and the
+	// responses stored, larger ones being answered but not stored; 0 means no limit
+	MaxBodyBytes int64
+}
+
+// IdempotencyMiddleware makes requests carrying an Idempotency-Key header safe to retry. The first
+// request with a key runs and its response is stored in store for opts.TTL; retries with the same
+// key, method, path, query, Content-Type, Accept, Accept-Language and body get the stored response
+// back with an Idempotent-Replayed header. Keys are scoped to the actor, so that requests authenticated with the
+// admin secret key and public ones never replay each other's responses.
+// Reusing a key for another request answers 422, and a retry arriving while the first request is
+// still running answers 409. 5xx responses are not stored, so their requests can be retried.
+// Requests without the header are passed through.
+func IdempotencyMiddleware(store repository.IdempotencyRepository, opts IdempotencyOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				err := fmt.Errorf("%w: %s header must be at most %d characters", errors.ErrInvalidInput, IdempotencyKeyHeader, maxIdempotencyKeyLength)
+				utils.WriteError(w, r, err)
+				return
+			}
+
+			if opts.MaxBodyBytes > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes)
+			}
+			body, err := io.ReadAll(r.Body)
+			var tooLarge *http.MaxBytesError
+			if stderrors.As(err, &tooLarge) {
+				err = fmt.Errorf("%w: requests with an %s carry at most %d bytes", errors.ErrPayloadTooLarge, IdempotencyKeyHeader, tooLarge.Limit)
+				utils.WriteError(w, r, err)
+				return
+			}
+			if err != nil {
+				utils.WriteError(w, r, fmt.Errorf("%w: reading request body: %v", errors.ErrInvalidInput, err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			hash := requestHash(r, body)
+			key = actor.FromContext(r.Context()).String() + " " + key
+
+			record, reserved, err := store.Reserve(r.Context(), key, hash, time.Now().Add(opts.LockTimeout))
+			if err != nil {
+				utils.WriteError(w, r, err)
+				return
+			}
+			if !reserved {
+				switch {
+				case record.RequestHash != hash:
+					utils.WriteError(w, r, fmt.Errorf("%w: %s was sent with another request", errors.ErrIdempotencyKeyReused, IdempotencyKeyHeader))
+				case record.Status == 0:
+					w.Header().Set("Retry-After", "1")
+					utils.WriteError(w, r, fmt.Errorf("%w: the first request with this %s has not completed", errors.ErrIdempotencyKeyInUse, IdempotencyKeyHeader))
+				default:
+					replay(w, record)
+				}
+				return
+			}
+
+			// The key is released unless the response is stored, panics included, and the store is
+			// updated even if the client went away
+			ctx := context.WithoutCancel(r.Context())
+			stored := false
+			defer func() {
+				if stored {
+					return
+				}
+				if err := store.Release(ctx, key, hash); err != nil {
+					slog.ErrorContext(ctx, "releasing idempotency key failed", slog.Any("error", err))
+				}
+			}()
+
+			buf := &limitedBuffer{limit: opts.MaxBodyBytes}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(buf)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				return
+			}
+			if buf.overflow {
+				slog.WarnContext(ctx, "idempotent response too large to store", slog.Int64("max_body_bytes", opts.MaxBodyBytes))
+				return
+			}
+
+			header := ww.Header().Clone()
+			header.Del(RequestIDHeader)
+			err = store.Complete(ctx, models.IdempotencyRecord{
+				Key:         key,
+				RequestHash: hash,
+				Status:      status,
+				Header:      header,
+				Body:        buf.Bytes(),
+				ExpiresAt:   time.Now().Add(opts.TTL),
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "storing idempotent response failed", slog.Any("error", err))
+				return
+			}
+			stored = true
+		})
+	}
+}
+
+// requestHash identifies a request by its method, path, query, body and the headers choosing how it
+// is read (Content-Type) and answered (Accept, Accept-Language)
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	for _, name := range []string{"Content-Type", "Accept", "Accept-Language"} {
+		fmt.Fprintf(h, "%s: %s\n", name, strings.Join(r.Header.Values(name), ", "))
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// limitedBuffer keeps the bytes written to it up to limit (0 for no limit), dropping them all
+// once more are written
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.overflow || (b.limit > 0 && int64(b.Len()+len(p)) > b.limit) {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// replay writes the stored response of record, keeping the request ID of the retry
+func replay(w http.ResponseWriter, record models.IdempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
@@ -0,0 +1,236 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	mw "github.com/Joshdike/subscriptions_aggregator/internal/middleware"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/memory"
+)
+
+// countingHandler answers 201 with the number of times it ran, or the status returned by fail
+type countingHandler struct {
+	calls atomic.Int32
+	fail  func(call int32) int
+	block chan struct{} // if set, requests wait for it to be closed
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := h.calls.Add(1)
+	if h.block != nil {
+		<-h.block
+	}
+	status := http.StatusCreated
+	if h.fail != nil {
+		if s := h.fail(call); s != 0 {
+			status = s
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"call":%d}`, call)
+}
+
+func newIdempotent(h http.Handler) http.Handler {
+	return newIdempotentLimited(h, 0)
+}
+
+func newIdempotentLimited(h http.Handler, maxBodyBytes int64) http.Handler {
+	opts := mw.IdempotencyOptions{TTL: time.Hour, LockTimeout: time.Minute, MaxBodyBytes: maxBodyBytes}
+	return mw.RequestIDMiddleware(mw.IdempotencyMiddleware(memory.NewIdempotencyRepo(), opts)(h))
+}
+
+func post(t *testing.T, h http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return send(t, h, newPost(path, key, body))
+}
+
+func newPost(path, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Accept", problem.ContentType)
+	if key != "" {
+		req.Header.Set(mw.IdempotencyKeyHeader, key)
+	}
+	return req
+}
+
+func send(t *testing.T, h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func problemCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var p struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return p.Code
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	handler := &countingHandler{}
+	h := newIdempotent(handler)
+
+	first := post(t, h, "/v1/subscriptions", "key-1", `{"price":400}`)
+	retry := post(t, h, "/v1/subscriptions", "key-1", `{"price":400}`)
+
+	if got := handler.calls.Load(); got != 1 {
+		t.Fatalf("handler ran %d times, want 1", got)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %q, want the first response %d %q", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(mw.IdempotentReplayedHeader) != "true" || first.Header().Get(mw.IdempotentReplayedHeader) != "" {
+		t.Errorf("%s header: first %q, retry %q", mw.IdempotentReplayedHeader, first.Header().Get(mw.IdempotentReplayedHeader), retry.Header().Get(mw.IdempotentReplayedHeader))
+	}
+	if retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("retry Content-Type = %q", retry.Header().Get("Content-Type"))
+	}
+	if retry.Header().Get(mw.RequestIDHeader) == first.Header().Get(mw.RequestIDHeader) {
+		t.Error("retry replayed the request ID of the first request")
+	}
+}
+
+func TestIdempotencyWithoutKey(t *testing.T) {
+	handler := &countingHandler{}
+	h := newIdempotent(handler)
+
+	post(t, h, "/v1/subscriptions", "", `{}`)
+	post(t, h, "/v1/subscriptions", "", `{}`)
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("handler ran %d times, want 2", got)
+	}
+}
+
+func TestIdempotencyKeyReused(t *testing.T) {
+	handler := &countingHandler{}
+	h := newIdempotent(handler)
+
+	post(t, h, "/v1/subscriptions/import", "key-1", `{"price":400}`)
+	csv := newPost("/v1/subscriptions/import", "key-1", `{"price":400}`)
+	csv.Header.Set("Content-Type", "text/csv")
+	accept := newPost("/v1/subscriptions/import", "key-1", `{"price":400}`)
+	accept.Header.Set("Accept", problem.ContentType+", application/json")
+	russian := newPost("/v1/subscriptions/import", "key-1", `{"price":400}`)
+	russian.Header.Set("Accept-Language", "ru")
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"body":         post(t, h, "/v1/subscriptions/import", "key-1", `{"price":450}`),
+		"path":         post(t, h, "/v1/subscriptions/1", "key-1", `{"price":400}`),
+		"query":        post(t, h, "/v1/subscriptions/import?dry_run=true", "key-1", `{"price":400}`),
+		"content type": send(t, h, csv),
+		"accept":       send(t, h, accept),
+		"language":     send(t, h, russian),
+	} {
+		if rec.Code != http.StatusUnprocessableEntity || problemCode(t, rec) != "idempotency_key_reused" {
+			t.Errorf("other %s = %d %s, want 422 idempotency_key_reused", name, rec.Code, rec.Body)
+		}
+	}
+	if got := handler.calls.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
+
+func TestIdempotencyScopedToActor(t *testing.T) {
+	handler := &countingHandler{}
+	h := newIdempotent(handler)
+
+	admin := newPost("/v1/subscriptions/import", "key-1", `{}`)
+	admin = admin.WithContext(actor.With(admin.Context(), actor.APIKey))
+	first := send(t, h, admin)
+	public := post(t, h, "/v1/subscriptions/import", "key-1", `{}`)
+
+	if public.Header().Get(mw.IdempotentReplayedHeader) != "" || public.Body.String() == first.Body.String() {
+		t.Errorf("public request got the admin response %d %s", public.Code, public.Body)
+	}
+	if got := handler.calls.Load(); got != 2 {
+		t.Errorf("handler ran %d times, want 2", got)
+	}
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	handler := &countingHandler{block: make(chan struct{})}
+	h := newIdempotent(handler)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(t, h, "/v1/subscriptions", "key-1", `{}`) }()
+	for handler.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	duplicate := post(t, h, "/v1/subscriptions", "key-1", `{}`)
+	if duplicate.Code != http.StatusConflict || problemCode(t, duplicate) != "idempotency_key_in_use" {
+		t.Errorf("duplicate in flight = %d %s, want 409 idempotency_key_in_use", duplicate.Code, duplicate.Body)
+	}
+	if duplicate.Header().Get("Retry-After") == "" {
+		t.Error("duplicate in flight has no Retry-After header")
+	}
+
+	close(handler.block)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("first request = %d %s", first.Code, first.Body)
+	}
+	if retry := post(t, h, "/v1/subscriptions", "key-1", `{}`); retry.Header().Get(mw.IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry after completion = %d %s, want a replay", retry.Code, retry.Body)
+	}
+	if got := handler.calls.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
+
+func TestIdempotencyServerError(t *testing.T) {
+	handler := &countingHandler{fail: func(call int32) int {
+		if call == 1 {
+			return http.StatusInternalServerError
+		}
+		return 0
+	}}
+	h := newIdempotent(handler)
+
+	if rec := post(t, h, "/v1/subscriptions", "key-1", `{}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first request = %d", rec.Code)
+	}
+	retry := post(t, h, "/v1/subscriptions", "key-1", `{}`)
+	if retry.Code != http.StatusCreated || retry.Header().Get(mw.IdempotentReplayedHeader) != "" {
+		t.Errorf("retry after 500 = %d %s, want the request to run again", retry.Code, retry.Body)
+	}
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	handler := &countingHandler{}
+	h := newIdempotentLimited(handler, 5)
+
+	rec := post(t, h, "/v1/subscriptions", "key-1", `{"price":400}`)
+	if rec.Code != http.StatusRequestEntityTooLarge || problemCode(t, rec) != "payload_too_large" || handler.calls.Load() != 0 {
+		t.Errorf("large request = %d %s after %d calls, want 413 without calling the handler", rec.Code, rec.Body, handler.calls.Load())
+	}
+
+	// The response {"call":1} is larger than the limit, so it is answered but not stored
+	post(t, h, "/v1/subscriptions", "key-2", `{}`)
+	retry := post(t, h, "/v1/subscriptions", "key-2", `{}`)
+	if retry.Code != http.StatusCreated || retry.Header().Get(mw.IdempotentReplayedHeader) != "" || handler.calls.Load() != 2 {
+		t.Errorf("retry of a large response = %d %s after %d calls, want the request to run again", retry.Code, retry.Body, handler.calls.Load())
+	}
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	handler := &countingHandler{}
+	h := newIdempotent(handler)
+
+	rec := post(t, h, "/v1/subscriptions", strings.Repeat("k", 256), `{}`)
+	if rec.Code != http.StatusBadRequest || handler.calls.Load() != 0 {
+		t.Errorf("long key = %d %s after %d calls, want 400 without calling the handler", rec.Code, rec.Body, handler.calls.Load())
+	}
+}
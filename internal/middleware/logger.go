@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header used to receive and return the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware stores a request ID in the request context so that handlers and
+// repository calls can log it. An incoming X-Request-ID header is reused, otherwise a new UUID is generated.
+// The ID is echoed back in the X-Request-ID response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := logging.WithRequestID(r.Context(), id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoggerMiddleware logs one structured record per request with method, path, status, size and duration.
+// Request headers are logged at debug level; sensitive ones (secret-key, Authorization) are redacted by the logger.
+func LoggerMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			}
+			if logger.Enabled(r.Context(), slog.LevelDebug) {
+				attrs = append(attrs, headerAttrs(r.Header))
+			}
+
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(r.Context(), level, "request completed", attrs...)
+		})
+	}
+}
+
+// headerAttrs converts request headers into a "headers" log group
+func headerAttrs(h http.Header) slog.Attr {
+	attrs := make([]any, 0, len(h))
+	for name, values := range h {
+		if len(values) == 1 {
+			attrs = append(attrs, slog.String(name, values[0]))
+			continue
+		}
+		attrs = append(attrs, slog.Any(name, values))
+	}
+	return slog.Group("headers", attrs...)
+}
@@ -1,15 +1,19 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
 	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
 	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
 )
 
 // AdminSecretMiddleware is a middleware that checks if the incoming request has a valid secret-key header set to the value provided when creating the middleware.
 // If the header is missing or invalid, it will return a 401 Unauthorized response.
+// An empty secret never matches, so a misconfigured server rejects every admin request.
+// Authenticated requests act as actor.APIKey.
 func AdminSecretMiddleware(secret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -17,14 +21,31 @@ func AdminSecretMiddleware(secret string) func(http.Handler) http.Handler {
 			authHeader := r.Header.Get("secret-key")
 
 			// If the header is not set or is invalid, return a 401 Unauthorized response
-			if authHeader != secret {
+			if secret == "" || subtle.ConstantTimeCompare([]byte(authHeader), []byte(secret)) != 1 {
 				err := fmt.Errorf("%w: secret-key header is missing or invalid", errors.ErrUnauthorized)
-				utils.WriteError(w, err)
+				utils.WriteError(w, r, err)
 				return
 			}
 
 			// If the header is valid, call the next handler in the chain
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(actor.With(r.Context(), actor.APIKey)))
+		})
+	}
+}
+
+// OptionalAdminSecretMiddleware lets requests without a secret-key header through as regular
+// users, and checks the header like AdminSecretMiddleware when it is set, for routes that admins
+// may use with higher limits.
+func OptionalAdminSecretMiddleware(secret string) func(http.Handler) http.Handler {
+	admin := AdminSecretMiddleware(secret)
+	return func(next http.Handler) http.Handler {
+		checked := admin(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("secret-key") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			checked.ServeHTTP(w, r)
 		})
 	}
 }
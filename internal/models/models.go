@@ -6,6 +6,9 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,14 +22,62 @@ type SubscriptionRequest struct {
 	EndDate     string    `json:"end_date,omitempty"`	// optional end date in "MM-YYYY" format
 }
 
+// SubscriptionPatch is a JSON Merge Patch (RFC 7396) of a subscription: nil fields are left
+// unchanged. An EndDate of "" resets the end date to one month after the start.
+type SubscriptionPatch struct {
+	ServiceName *string `json:"service_name,omitempty"`
+	Price       *int    `json:"price,omitempty"`
+	StartDate   *string `json:"start_date,omitempty"` // "MM-YYYY"
+	EndDate     *string `json:"end_date,omitempty"`   // "MM-YYYY"
+}
+
+// UnmarshalJSON decodes a merge patch document. A member set to null clears the field: the
+// end date is reset, the other fields get their zero value (rejected by validation). Members
+// that cannot be patched, like user_id, are refused.
+func (p *SubscriptionPatch) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	*p = SubscriptionPatch{}
+	for name, raw := range members {
+		var field any
+		switch name {
+		case "service_name":
+			p.ServiceName = new(string)
+			field = p.ServiceName
+		case "price":
+			p.Price = new(int)
+			field = p.Price
+		case "start_date":
+			p.StartDate = new(string)
+			field = p.StartDate
+		case "end_date":
+			p.EndDate = new(string)
+			field = p.EndDate
+		default:
+			return fmt.Errorf("field %q cannot be patched", name)
+		}
+		// null leaves the zero value
+		if err := json.Unmarshal(raw, field); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
 type Subscription struct {
-	ID          uint64    `json:"id"`
-	ServiceName string    `json:"service_name"`
-	Price       int       `json:"price"`
-	UserID      uuid.UUID `json:"user_id"`
-	StartDate   time.Time `json:"start_date"`
-	EndDate     time.Time `json:"end_date"`
-	Deleted     bool      `json:"deleted"` // Soft-delete flag (hidden from normal users)
+	ID          uint64     `json:"id"`
+	ServiceName string     `json:"service_name"`
+	Price       int        `json:"price"`
+	UserID      uuid.UUID  `json:"user_id"`
+	StartDate   time.Time  `json:"start_date"`
+	EndDate     time.Time  `json:"end_date"`
+	Deleted     bool       `json:"deleted"`              // Soft-delete flag (hidden from normal users)
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // when it was soft-deleted, nil if not deleted
+	DeletedBy   string     `json:"deleted_by,omitempty"` // actor that soft-deleted it (see package actor)
+	Version     int        `json:"version"`              // incremented on every change, sent as the ETag
 }
 
 type SubscriptionResponse struct {
@@ -36,16 +87,190 @@ type SubscriptionResponse struct {
 	UserID      uuid.UUID `json:"user_id"`
 	StartDate   string    `json:"start_date"`
 	EndDate     string    `json:"end_date"`
+
+	StartTime time.Time `json:"-"` // unformatted start date, for other response versions
+	EndTime   time.Time `json:"-"` // unformatted end date, for other response versions
+	Version   int       `json:"-"` // sent in the ETag header
 }
 
 type AdminSubscriptionResponse struct {
+	ID          uint64     `json:"id"`
+	ServiceName string     `json:"service_name"`
+	Price       int        `json:"price"`
+	UserID      uuid.UUID  `json:"user_id"`
+	StartDate   string     `json:"start_date"`
+	EndDate     string     `json:"end_date"`
+	Deleted     bool       `json:"deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy   string     `json:"deleted_by,omitempty"`
+
+	StartTime time.Time `json:"-"` // unformatted start date, for other response versions
+	EndTime   time.Time `json:"-"` // unformatted end date, for other response versions
+}
+
+// DeletedSubscriptionResponse is a soft-deleted subscription, as listed in its user's trash
+type DeletedSubscriptionResponse struct {
+	SubscriptionResponse
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SubscriptionResponseV2 is the /v2 API response, with ISO 8601 dates ("YYYY-MM-DD")
+type SubscriptionResponseV2 struct {
 	ID          uint64    `json:"id"`
 	ServiceName string    `json:"service_name"`
 	Price       int       `json:"price"`
 	UserID      uuid.UUID `json:"user_id"`
-	StartDate   string    `json:"start_date"`
-	EndDate     string    `json:"end_date"`
-	Deleted     bool      `json:"deleted"`
+	StartDate   string    `json:"start_date" example:"2025-01-01"`
+	EndDate     string    `json:"end_date" example:"2025-02-01"`
+}
+
+// AdminSubscriptionResponseV2 is the /v2 admin API response, with ISO 8601 dates ("YYYY-MM-DD")
+type AdminSubscriptionResponseV2 struct {
+	SubscriptionResponseV2
+	Deleted   bool       `json:"deleted"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+// DeletedSubscriptionResponseV2 is the /v2 trash listing response, with ISO 8601 dates ("YYYY-MM-DD")
+type DeletedSubscriptionResponseV2 struct {
+	SubscriptionResponseV2
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// CostResponseV2 is the /v2 cost response
+type CostResponseV2 struct {
+	TotalCost int `json:"total_cost"` // in rubles
+}
+
+// SubscriptionStats holds aggregate business figures exposed as metrics
+type SubscriptionStats struct {
+	Active         int // not deleted and not yet ended
+	ActivePriceSum int // sum of prices of active subscriptions in rubles
+	Deleted        int // soft-deleted subscriptions
+}
+
+// AuditAction is the kind of change recorded in the audit log
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditRenew   AuditAction = "renew"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// AuditActions lists every action, in lifecycle order
+var AuditActions = []AuditAction{AuditCreate, AuditRenew, AuditUpdate, AuditDelete, AuditRestore, AuditPurge}
+
+// AuditSnapshot is the state of a subscription before or after a change, with ISO 8601 dates
+type AuditSnapshot struct {
+	ID          uint64     `json:"id"`
+	ServiceName string     `json:"service_name"`
+	Price       int        `json:"price"`
+	UserID      uuid.UUID  `json:"user_id"`
+	StartDate   string     `json:"start_date"`
+	EndDate     string     `json:"end_date"`
+	Deleted     bool       `json:"deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy   string     `json:"deleted_by,omitempty"`
+	Version     int        `json:"version"`
+}
+
+// AuditEvent is one change of a subscription, as recorded in the audit log
+type AuditEvent struct {
+	ID             uint64      `json:"id"`
+	SubscriptionID uint64      `json:"subscription_id"`
+	UserID         uuid.UUID   `json:"user_id"`
+	Action         AuditAction `json:"action"`
+	Actor          string      `json:"actor"` // actor.Actor of the change, e.g. "user" or "system:retention"
+	RequestID      string      `json:"request_id,omitempty"`
+	// Before is null for creations; for renewals it is the subscription that was renewed
+	Before *AuditSnapshot `json:"before"`
+	// After is null for purges
+	After     *AuditSnapshot `json:"after"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AuditFilter selects audit events. Zero fields match every event.
+type AuditFilter struct {
+	SubscriptionID uint64
+	UserID         uuid.UUID
+	Actor          string
+	Action         AuditAction
+	From, To       time.Time // created at or after From, and before To
+	Limit          int       // maximum number of events, newest first
+}
+
+// ImportMode chooses what an import does when some of its rows fail
+type ImportMode string
+
+const (
+	ImportAllOrNothing ImportMode = "all_or_nothing" // no row is created if one fails
+	ImportBestEffort   ImportMode = "best_effort"    // the rows that pass are created
+)
+
+// ImportRow is one subscription of an imported file
+type ImportRow struct {
+	Line    int // line of the row in the file, from 1
+	Request SubscriptionRequest
+}
+
+// ImportOptions configures an import
+type ImportOptions struct {
+	Mode   ImportMode
+	DryRun bool // check the rows without creating them
+	Copy   bool // insert the rows with COPY, for large imports
+}
+
+// ImportOutcome is the result of one row of an import: the ID of the created subscription, or
+// why the row cannot be created
+type ImportOutcome struct {
+	ID  uint64
+	Err error
+}
+
+// ImportRowStatus is the state of one row after an import
+type ImportRowStatus string
+
+const (
+	ImportCreated ImportRowStatus = "created" // the subscription was created
+	ImportFailed  ImportRowStatus = "failed"  // the row is invalid or overlaps a subscription
+	ImportValid   ImportRowStatus = "valid"   // the row passed a dry run
+	ImportSkipped ImportRowStatus = "skipped" // the row passed but the all-or-nothing import failed
+)
+
+// ImportRowResult reports one row of an imported file
+type ImportRowResult struct {
+	Line   int             `json:"line"`
+	Status ImportRowStatus `json:"status"`
+	ID     uint64          `json:"id,omitempty"`     // the created subscription
+	Code   string          `json:"code,omitempty"`   // problem code of a failed row, e.g. "invalid_input"
+	Detail string          `json:"detail,omitempty"` // why the row failed
+	Errors any             `json:"errors,omitempty"` // field violations ({field, code, message}) of an invalid row
+}
+
+// ImportReport is the result of an import, row by row
+type ImportReport struct {
+	Mode    ImportMode        `json:"mode"`
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// IdempotencyRecord is a request sent with an Idempotency-Key header and, once it completed,
+// the response replayed to its retries
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string      // hash of the method, path and body of the request
+	Status      int         // 0 while the request is in flight
+	Header      http.Header // response headers
+	Body        []byte
+	ExpiresAt   time.Time
 }
 
 // NewSubscriptionResponse converts Subscription(DB model) to API Response
@@ -58,6 +283,9 @@ func NewSubscriptionResponse(sub Subscription) SubscriptionResponse {
 		UserID:      sub.UserID,
 		StartDate:   sub.StartDate.Format("01-2006"),
 		EndDate:     sub.EndDate.Format("01-2006"),
+		StartTime:   sub.StartDate,
+		EndTime:     sub.EndDate,
+		Version:     sub.Version,
 	}
 }
 
@@ -70,6 +298,55 @@ func NewAdminSubscriptionResponse(sub Subscription) AdminSubscriptionResponse {
 		StartDate:   sub.StartDate.Format("01-2006"),
 		EndDate:     sub.EndDate.Format("01-2006"),
 		Deleted:     sub.Deleted,
+		DeletedAt:   sub.DeletedAt,
+		DeletedBy:   sub.DeletedBy,
+		StartTime:   sub.StartDate,
+		EndTime:     sub.EndDate,
+	}
+}
+
+// NewDeletedSubscriptionResponse converts a soft-deleted Subscription(DB model) to the trash listing response
+func NewDeletedSubscriptionResponse(sub Subscription) DeletedSubscriptionResponse {
+	resp := DeletedSubscriptionResponse{SubscriptionResponse: NewSubscriptionResponse(sub)}
+	if sub.DeletedAt != nil {
+		resp.DeletedAt = *sub.DeletedAt
+	}
+	return resp
+}
+
+// NewSubscriptionResponseV2 converts a v1 response to the /v2 shape
+//Formats dates to ISO 8601 "YYYY-MM-DD"
+func NewSubscriptionResponseV2(sub SubscriptionResponse) SubscriptionResponseV2 {
+	return SubscriptionResponseV2{
+		ID:          sub.ID,
+		ServiceName: sub.ServiceName,
+		Price:       sub.Price,
+		UserID:      sub.UserID,
+		StartDate:   sub.StartTime.Format(time.DateOnly),
+		EndDate:     sub.EndTime.Format(time.DateOnly),
+	}
+}
+
+func NewAdminSubscriptionResponseV2(sub AdminSubscriptionResponse) AdminSubscriptionResponseV2 {
+	return AdminSubscriptionResponseV2{
+		SubscriptionResponseV2: SubscriptionResponseV2{
+			ID:          sub.ID,
+			ServiceName: sub.ServiceName,
+			Price:       sub.Price,
+			UserID:      sub.UserID,
+			StartDate:   sub.StartTime.Format(time.DateOnly),
+			EndDate:     sub.EndTime.Format(time.DateOnly),
+		},
+		Deleted:   sub.Deleted,
+		DeletedAt: sub.DeletedAt,
+		DeletedBy: sub.DeletedBy,
+	}
+}
+
+func NewDeletedSubscriptionResponseV2(sub DeletedSubscriptionResponse) DeletedSubscriptionResponseV2 {
+	return DeletedSubscriptionResponseV2{
+		SubscriptionResponseV2: NewSubscriptionResponseV2(sub.SubscriptionResponse),
+		DeletedAt:              sub.DeletedAt,
 	}
 }
 
@@ -84,3 +361,48 @@ func RequestToSubscription(sub SubscriptionRequest, start, end time.Time) Subscr
 		EndDate:     end,
 	}
 }
+
+// Overlaps reports whether s and other are current subscriptions of the same user and service
+// whose periods overlap
+func (s Subscription) Overlaps(other Subscription) bool {
+	return !s.Deleted && !other.Deleted && s.UserID == other.UserID && s.ServiceName == other.ServiceName &&
+		s.StartDate.Before(other.EndDate) && other.StartDate.Before(s.EndDate)
+}
+
+// NewAuditSnapshot converts Subscription(DB model) to its audit log snapshot, or nil
+func NewAuditSnapshot(sub *Subscription) *AuditSnapshot {
+	if sub == nil {
+		return nil
+	}
+	return &AuditSnapshot{
+		ID:          sub.ID,
+		ServiceName: sub.ServiceName,
+		Price:       sub.Price,
+		UserID:      sub.UserID,
+		StartDate:   sub.StartDate.Format(time.DateOnly),
+		EndDate:     sub.EndDate.Format(time.DateOnly),
+		Deleted:     sub.Deleted,
+		DeletedAt:   sub.DeletedAt,
+		DeletedBy:   sub.DeletedBy,
+		Version:     sub.Version,
+	}
+}
+
+// NewAuditEvent describes a change of a subscription from before to after (either may be nil),
+// made by actor while serving the request requestID. ID and CreatedAt are left to the log.
+func NewAuditEvent(action AuditAction, actor, requestID string, before, after *Subscription) AuditEvent {
+	event := AuditEvent{
+		Action:    action,
+		Actor:     actor,
+		RequestID: requestID,
+		Before:    NewAuditSnapshot(before),
+		After:     NewAuditSnapshot(after),
+	}
+	// The event belongs to the subscription as changed (renewals create a new one)
+	if after != nil {
+		event.SubscriptionID, event.UserID = after.ID, after.UserID
+	} else if before != nil {
+		event.SubscriptionID, event.UserID = before.ID, before.UserID
+	}
+	return event
+}
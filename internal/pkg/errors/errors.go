@@ -12,4 +12,11 @@ var (
 	ErrDecodingJSON         = errors.New("error decoding json")
 	ErrEncodingJSON         = errors.New("error encoding json")
 	ErrUnauthorized         = errors.New("unauthorized")
+	ErrNotDeleted           = errors.New("subscription is not deleted") //the operation needs a soft-deleted subscription
+	ErrVersionMismatch      = errors.New("subscription was modified")   //the If-Match version is not the current one
+	ErrPreconditionRequired = errors.New("precondition required")       //the request must carry an If-Match header
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused")      //the Idempotency-Key was sent with another request
+	ErrIdempotencyKeyInUse  = errors.New("idempotency key in use")      //the request holding the Idempotency-Key is in flight
+	ErrUnsupportedMediaType = errors.New("unsupported media type")      //the request body is not of a type the endpoint accepts
+	ErrPayloadTooLarge      = errors.New("payload too large")           //the request body is larger than the endpoint accepts
 )
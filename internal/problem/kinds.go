@@ -0,0 +1,40 @@
+package problem
+
+import (
+	"net/http"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+)
+
+// Kinds of the sentinels in internal/pkg/errors. Their codes are part of the API and must not change.
+var (
+	SubscriptionNotFound = Kind{Status: http.StatusNotFound, Code: "subscription_not_found", Title: "No subscription found"}
+	InvalidInput         = Kind{Status: http.StatusBadRequest, Code: "invalid_input", Title: "Validation failed", Expose: true}
+	AlreadyExists        = Kind{Status: http.StatusConflict, Code: "subscription_already_exists", Title: "Subscription already exists", Expose: true}
+	MalformedRequest     = Kind{Status: http.StatusBadRequest, Code: "malformed_request", Title: "Invalid request format"}
+	EncodingFailed       = Kind{Status: http.StatusInternalServerError, Code: "response_encoding_failed", Title: "Failed to process response"}
+	Unauthorized         = Kind{Status: http.StatusUnauthorized, Code: "unauthorized", Title: "Unauthorized", Expose: true}
+	NotDeleted           = Kind{Status: http.StatusConflict, Code: "subscription_not_deleted", Title: "Subscription is not deleted", Expose: true}
+	VersionMismatch      = Kind{Status: http.StatusPreconditionFailed, Code: "version_mismatch", Title: "Subscription was modified", Expose: true}
+	PreconditionRequired = Kind{Status: http.StatusPreconditionRequired, Code: "precondition_required", Title: "Precondition required", Expose: true}
+	IdempotencyKeyReused = Kind{Status: http.StatusUnprocessableEntity, Code: "idempotency_key_reused", Title: "Idempotency key reused", Expose: true}
+	IdempotencyKeyInUse  = Kind{Status: http.StatusConflict, Code: "idempotency_key_in_use", Title: "Request with this idempotency key in progress", Expose: true}
+	UnsupportedMediaType = Kind{Status: http.StatusUnsupportedMediaType, Code: "unsupported_media_type", Title: "Unsupported media type", Expose: true}
+	PayloadTooLarge      = Kind{Status: http.StatusRequestEntityTooLarge, Code: "payload_too_large", Title: "Payload too large", Expose: true}
+)
+
+func init() {
+	Register(errors.ErrSubscriptionNotFound, SubscriptionNotFound)
+	Register(errors.ErrInvalidInput, InvalidInput)
+	Register(errors.ErrAlreadyExists, AlreadyExists)
+	Register(errors.ErrDecodingJSON, MalformedRequest)
+	Register(errors.ErrEncodingJSON, EncodingFailed)
+	Register(errors.ErrUnauthorized, Unauthorized)
+	Register(errors.ErrNotDeleted, NotDeleted)
+	Register(errors.ErrVersionMismatch, VersionMismatch)
+	Register(errors.ErrPreconditionRequired, PreconditionRequired)
+	Register(errors.ErrIdempotencyKeyReused, IdempotencyKeyReused)
+	Register(errors.ErrIdempotencyKeyInUse, IdempotencyKeyInUse)
+	Register(errors.ErrUnsupportedMediaType, UnsupportedMediaType)
+	Register(errors.ErrPayloadTooLarge, PayloadTooLarge)
+}
@@ -0,0 +1,185 @@
+// Package problem describes API errors as RFC 9457 problem details (application/problem+json).
+//
+// Key behaviors:
+//   - Every kind of error is a Kind: HTTP status, stable machine-readable code and title
+//   - Kinds are registered against a sentinel error with Register, so packages introducing new
+//     errors register their own mapping; Lookup returns the kind of the first registered
+//     sentinel matched by errors.Is
+//   - Errors matching no registered sentinel map to the internal_error kind (500)
+//   - The detail of a problem is the error message only for kinds with Expose set, so internal
+//     errors never leak to clients
+//   - Titles are translated with the i18n catalog (key "problem.<code>"), falling back to Kind.Title
+//   - The type of a problem is its code resolved against the type base; Describe serves the
+//     kind behind each type URI
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/go-chi/chi/v5"
+)
+
+// ContentType is the media type of problem details responses
+const ContentType = "application/problem+json"
+
+// Kind describes how one kind of error is reported
+type Kind struct {
+	Status int    // HTTP status code
+	Code   string // stable machine-readable code, e.g. "subscription_not_found"
+	Title  string // short human-readable summary, the same for every occurrence
+	Expose bool   // whether the error message is sent as the detail
+}
+
+// Internal is the kind of errors matching no registered sentinel
+var Internal = Kind{
+	Status: http.StatusInternalServerError,
+	Code:   "internal_error",
+	Title:  "Internal server error",
+}
+
+// Problem is an RFC 9457 problem details object
+// swagger:model Problem
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"` // the request ID
+	Code     string `json:"code"`
+	Errors   any    `json:"errors,omitempty"` // the field violations ({field, code, message}) of invalid input
+}
+
+type entry struct {
+	sentinel error
+	kind     Kind
+}
+
+var (
+	mu       sync.RWMutex
+	entries  []entry
+	byCode   = map[string]Kind{Internal.Code: Internal}
+	typeBase = "/problems/"
+)
+
+// Register maps errors matching sentinel (errors.Is) to kind. It panics if sentinel is nil,
+// the kind has no code or status, or the code is already registered.
+func Register(sentinel error, kind Kind) {
+	if sentinel == nil {
+		panic("problem: Register with nil sentinel")
+	}
+	if kind.Code == "" || kind.Status == 0 {
+		panic(fmt.Sprintf("problem: Register %q without code or status", sentinel))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := byCode[kind.Code]; ok {
+		panic(fmt.Sprintf("problem: code %q registered twice", kind.Code))
+	}
+	entries = append(entries, entry{sentinel: sentinel, kind: kind})
+	byCode[kind.Code] = kind
+}
+
+// Lookup returns the kind of err: the kind of the first registered sentinel it matches,
+// or Internal
+func Lookup(err error) Kind {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, e := range entries {
+		if errors.Is(err, e.sentinel) {
+			return e.kind
+		}
+	}
+	return Internal
+}
+
+// Kinds returns every registered kind, Internal included, in registration order
+func Kinds() []Kind {
+	mu.RLock()
+	defer mu.RUnlock()
+	kinds := make([]Kind, 0, len(entries)+1)
+	for _, e := range entries {
+		kinds = append(kinds, e.kind)
+	}
+	return append(kinds, Internal)
+}
+
+// SetTypeBase sets the URI the codes are resolved against to build the type of a problem,
+// normally the public URL of the Describe route. The default is "/problems/".
+func SetTypeBase(base string) {
+	mu.Lock()
+	defer mu.Unlock()
+	typeBase = strings.TrimRight(base, "/") + "/"
+}
+
+// TypeURI returns the type URI of the kind with the given code
+func TypeURI(code string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return typeBase + code
+}
+
+// title returns the title of kind translated into lang
+func title(kind Kind, lang i18n.Lang) string {
+	if msg, ok := i18n.Lookup(lang, i18n.ProblemTitle(kind.Code)); ok {
+		return msg
+	}
+	return kind.Title
+}
+
+// New returns the problem describing err in lang. requestID becomes the instance.
+func New(err error, requestID string, lang i18n.Lang) Problem {
+	kind := Lookup(err)
+	p := Problem{
+		Type:     TypeURI(kind.Code),
+		Title:    title(kind, lang),
+		Status:   kind.Status,
+		Instance: requestID,
+		Code:     kind.Code,
+	}
+	if kind.Expose && err != nil {
+		err = i18n.Localize(err, lang)
+		p.Detail = err.Error()
+		// Errors listing field violations (validation.Error) provide them as details
+		var detailed interface{ Details() any }
+		if errors.As(err, &detailed) {
+			p.Errors = detailed.Details()
+		}
+	}
+	return p
+}
+
+// Describe godoc
+// @Summary Describe an error type
+// @Description Returns the status and title of the problem type with the given code, the target of the "type" member of error responses
+// @Tags meta
+// @Produce json
+// @Param code path string true "Problem code"
+// @Success 200 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /problems/{code} [get]
+func Describe(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	mu.RLock()
+	kind, ok := byCode[code]
+	mu.RUnlock()
+
+	status := http.StatusOK
+	if !ok {
+		kind = Kind{Status: http.StatusNotFound, Code: code, Title: "Unknown problem type"}
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(Problem{
+		Type:   TypeURI(kind.Code),
+		Title:  title(kind, i18n.FromContext(r.Context())),
+		Status: kind.Status,
+		Code:   kind.Code,
+	})
+}
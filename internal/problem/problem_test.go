@@ -0,0 +1,81 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	apperrors "github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Kind
+	}{
+		{apperrors.ErrSubscriptionNotFound, SubscriptionNotFound},
+		{fmt.Errorf("%w: subscription not found", apperrors.ErrSubscriptionNotFound), SubscriptionNotFound},
+		{fmt.Errorf("%w: overlap", apperrors.ErrAlreadyExists), AlreadyExists},
+		{apperrors.ErrDecodingJSON, MalformedRequest},
+		{apperrors.ErrEncodingJSON, EncodingFailed},
+		{apperrors.ErrUnauthorized, Unauthorized},
+		{apperrors.ErrInvalidInput, InvalidInput},
+		{errors.New("connection refused"), Internal},
+		{nil, Internal},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.err); got != tt.want {
+			t.Errorf("Lookup(%v) = %+v, want %+v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	errTeapot := errors.New("teapot")
+	teapot := Kind{Status: http.StatusTeapot, Code: "test_teapot", Title: "I'm a teapot", Expose: true}
+	Register(errTeapot, teapot)
+
+	p := New(fmt.Errorf("%w: short and stout", errTeapot), "req-1", i18n.RU)
+	want := Problem{
+		Type:     TypeURI("test_teapot"),
+		Title:    "I'm a teapot",
+		Status:   http.StatusTeapot,
+		Detail:   "teapot: short and stout",
+		Instance: "req-1",
+		Code:     "test_teapot",
+	}
+	if p != want {
+		t.Errorf("New = %+v, want %+v", p, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a code twice did not panic")
+		}
+	}()
+	Register(errors.New("other"), teapot)
+}
+
+func TestNewHidesInternalErrors(t *testing.T) {
+	p := New(errors.New("pq: password authentication failed"), "", i18n.EN)
+	if p.Detail != "" || p.Status != http.StatusInternalServerError || p.Code != Internal.Code {
+		t.Errorf("New = %+v, want an internal_error problem without detail", p)
+	}
+}
+
+// TestTitlesTranslated checks that the kinds of internal/pkg/errors have a title in every locale
+func TestTitlesTranslated(t *testing.T) {
+	kinds := []Kind{SubscriptionNotFound, InvalidInput, AlreadyExists, MalformedRequest, EncodingFailed, Unauthorized, Internal}
+	for _, lang := range i18n.Languages {
+		for _, kind := range kinds {
+			if _, ok := i18n.Lookup(lang, i18n.ProblemTitle(kind.Code)); !ok {
+				t.Errorf("%s: no title for %q", lang, kind.Code)
+			}
+		}
+	}
+	if got := New(apperrors.ErrSubscriptionNotFound, "", i18n.RU).Title; got != "Подписка не найдена" {
+		t.Errorf("ru title = %q", got)
+	}
+}
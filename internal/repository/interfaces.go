@@ -12,9 +12,46 @@ type SubscriptionRepository interface {
 	Create(ctx context.Context, sub *models.SubscriptionRequest) (uint64, error)
 	GetAll(ctx context.Context) ([]models.AdminSubscriptionResponse, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error)
+	GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error)
 	GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error)
-	Delete(ctx context.Context, id uint64) error
+	// Delete soft-deletes a subscription, returning false if it was already deleted
+	// and ErrSubscriptionNotFound if it does not exist
+	Delete(ctx context.Context, id uint64) (bool, error)
+	// GetDeletedByUserID returns the user's soft-deleted subscriptions, most recently deleted first
+	GetDeletedByUserID(ctx context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error)
+	// Restore un-deletes a subscription unless it overlaps a current one (ErrAlreadyExists),
+	// returning false if it was not deleted and ErrSubscriptionNotFound if it does not exist
+	Restore(ctx context.Context, id uint64) (bool, error)
+	// Purge permanently removes a soft-deleted subscription; ErrNotDeleted if it is not deleted
+	Purge(ctx context.Context, id uint64) error
 	RenewOrExtend(ctx context.Context, id uint64) (uint64, error)
+	// Update applies a merge patch to a current subscription still at the given version and returns
+	// it with its new version: ErrVersionMismatch if it changed since, ErrAlreadyExists on overlaps
+	Update(ctx context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error)
 	GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error)
+	// GetHistory returns the audit log of a subscription, oldest first; ErrSubscriptionNotFound if
+	// it has none and does not exist
+	GetHistory(ctx context.Context, id uint64) ([]models.AuditEvent, error)
+	// SearchHistory returns the audit events matching filter, newest first
+	SearchHistory(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	// Import creates the subscriptions of rows in one transaction, checking each like Create against
+	// the current subscriptions and the rows before it. The outcomes are in the order of rows; nothing
+	// is created by a dry run, nor by an ImportAllOrNothing import with a failed row.
+	Import(ctx context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error)
 	OverlapCheck(ctx context.Context, sub models.Subscription) (error)
 }
+
+// IdempotencyRepository stores the requests sent with an Idempotency-Key header and their responses
+type IdempotencyRepository interface {
+	// Reserve claims key for a request until expiresAt and returns true. If an unexpired record
+	// holds the key, it returns that record instead, with Status 0 while its request is in flight.
+	Reserve(ctx context.Context, key, requestHash string, expiresAt time.Time) (models.IdempotencyRecord, bool, error)
+	// Complete stores the response of the in-flight request holding record.Key and record.RequestHash,
+	// kept until record.ExpiresAt
+	Complete(ctx context.Context, record models.IdempotencyRecord) error
+	// Release drops the reservation of an in-flight request whose response is not kept, so that
+	// the key can be retried
+	Release(ctx context.Context, key, requestHash string) error
+	// DeleteExpired removes the records expired before now and returns how many were removed
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+)
+
+// IdempotencyRepo keeps the idempotency records in memory, expiring them like pg
+type IdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+var _ repository.IdempotencyRepository = (*IdempotencyRepo)(nil)
+
+func NewIdempotencyRepo() *IdempotencyRepo {
+	return &IdempotencyRepo{records: make(map[string]models.IdempotencyRecord)}
+}
+
+// Reserve claims key unless an unexpired record holds it
+func (s *IdempotencyRepo) Reserve(ctx context.Context, key, requestHash string, expiresAt time.Time) (models.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok && record.ExpiresAt.After(time.Now()) {
+		return record, false, nil
+	}
+	record := models.IdempotencyRecord{Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}
+	s.records[key] = record
+	return record, true, nil
+}
+
+// Complete stores the response of the in-flight request holding the key
+func (s *IdempotencyRepo) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inFlight(record.Key, record.RequestHash) {
+		s.records[record.Key] = record
+	}
+	return nil
+}
+
+// Release drops the reservation of the in-flight request holding key
+func (s *IdempotencyRepo) Release(ctx context.Context, key, requestHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inFlight(key, requestHash) {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// DeleteExpired removes the records expired before now
+func (s *IdempotencyRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for key, record := range s.records {
+		if !record.ExpiresAt.After(now) {
+			delete(s.records, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// inFlight reports whether key is reserved by a request with requestHash that has no response
+// yet. The caller must hold the lock.
+func (s *IdempotencyRepo) inFlight(key, requestHash string) bool {
+	record, ok := s.records[key]
+	return ok && record.Status == 0 && record.RequestHash == requestHash
+}
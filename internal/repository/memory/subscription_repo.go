@@ -0,0 +1,463 @@
+// Package memory implements the SubscriptionRepository and IdempotencyRepository in memory, for
+// tests and local tools.
+//
+// Key behaviors:
+//   - Mirrors the PostgreSQL implementation (pg): soft deletes, "MM-YYYY" date validation,
+//     overlap checks, renewal date math, cost sums and the audit log behave the same way
+//   - Safe for concurrent use
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/utils"
+	"github.com/google/uuid"
+)
+
+type SubscriptionRepo struct {
+	mu     sync.RWMutex
+	nextID uint64
+	subs   map[uint64]models.Subscription
+	events []models.AuditEvent // the audit log, oldest first
+}
+
+var _ repository.SubscriptionRepository = (*SubscriptionRepo)(nil)
+
+func NewSubscriptionRepo() *SubscriptionRepo {
+	return &SubscriptionRepo{
+		nextID: 1,
+		subs:   make(map[uint64]models.Subscription),
+	}
+}
+
+// Create inserts a new subscription after validating the dates and checking for overlaps, like pg
+func (s *SubscriptionRepo) Create(ctx context.Context, sub *models.SubscriptionRequest) (uint64, error) {
+	subscription, err := parseRequest(sub)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.overlapCheck(subscription); err != nil {
+		return 0, err
+	}
+	id := s.insert(subscription)
+	created := s.subs[id]
+	s.record(ctx, models.AuditCreate, nil, &created)
+	return id, nil
+}
+
+// Import creates the rows that pass the checks of Create, like pg
+func (s *SubscriptionRepo) Import(ctx context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcomes := make([]models.ImportOutcome, len(rows))
+	accepted := make([]models.Subscription, len(rows))
+	failed := false
+	for i, row := range rows {
+		sub, err := parseRequest(&row.Request)
+		if err == nil {
+			err = s.overlapCheck(sub)
+		}
+		for j := range i {
+			if err == nil && outcomes[j].Err == nil && sub.Overlaps(accepted[j]) {
+				err = fmt.Errorf("%w: overlaps the subscription on line %d", errors.ErrAlreadyExists, rows[j].Line)
+			}
+		}
+		outcomes[i].Err = err
+		accepted[i] = sub
+		failed = failed || err != nil
+	}
+	if opts.DryRun || (failed && opts.Mode == models.ImportAllOrNothing) {
+		return outcomes, nil
+	}
+
+	for i := range outcomes {
+		if outcomes[i].Err != nil {
+			continue
+		}
+		outcomes[i].ID = s.insert(accepted[i])
+		created := s.subs[outcomes[i].ID]
+		s.record(ctx, models.AuditCreate, nil, &created)
+	}
+	return outcomes, nil
+}
+
+func (s *SubscriptionRepo) GetAll(ctx context.Context) ([]models.AdminSubscriptionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subscriptions []models.AdminSubscriptionResponse
+	for _, sub := range s.sorted() {
+		subscriptions = append(subscriptions, models.NewAdminSubscriptionResponse(sub))
+	}
+	return subscriptions, nil
+}
+
+func (s *SubscriptionRepo) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subscriptions []models.SubscriptionResponse
+	for _, sub := range s.sorted() {
+		if sub.UserID == userID && !sub.Deleted {
+			subscriptions = append(subscriptions, models.NewSubscriptionResponse(sub))
+		}
+	}
+	return subscriptions, nil
+}
+
+func (s *SubscriptionRepo) GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	wanted := make(map[uuid.UUID]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subscriptions := make(map[uuid.UUID][]models.SubscriptionResponse, len(userIDs))
+	for _, sub := range s.sorted() {
+		if wanted[sub.UserID] && !sub.Deleted {
+			subscriptions[sub.UserID] = append(subscriptions[sub.UserID], models.NewSubscriptionResponse(sub))
+		}
+	}
+	return subscriptions, nil
+}
+
+func (s *SubscriptionRepo) GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.Deleted {
+		return models.SubscriptionResponse{}, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+	return models.NewSubscriptionResponse(sub), nil
+}
+
+// RenewOrExtend creates a new subscription with the duration of the existing one, starting at its
+// end date if it is still active or now otherwise, like pg
+func (s *SubscriptionRepo) RenewOrExtend(ctx context.Context, id uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok {
+		return 0, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+
+	newStartDate := time.Now()
+	if sub.EndDate.After(newStartDate) {
+		newStartDate = sub.EndDate
+	}
+	newID := s.insert(models.Subscription{
+		ServiceName: sub.ServiceName,
+		Price:       sub.Price,
+		UserID:      sub.UserID,
+		StartDate:   newStartDate,
+		EndDate:     newStartDate.Add(sub.EndDate.Sub(sub.StartDate)),
+	})
+	renewed := s.subs[newID]
+	s.record(ctx, models.AuditRenew, &sub, &renewed)
+	return newID, nil
+}
+
+// GetCost sums the prices of the user's subscriptions to the service within [start, end], like pg
+func (s *SubscriptionRepo) GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := 0
+	for _, sub := range s.subs {
+		if sub.UserID == userID && sub.ServiceName == serviceName && !sub.StartDate.Before(start) && !sub.EndDate.After(end) {
+			total += sub.Price
+		}
+	}
+	return total, nil
+}
+
+// Delete marks a subscription as deleted by the actor of ctx, like pg
+func (s *SubscriptionRepo) Delete(ctx context.Context, id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok {
+		return false, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+	if sub.Deleted {
+		return false, nil
+	}
+	before := sub
+	now := time.Now()
+	sub.Deleted = true
+	sub.DeletedAt = &now
+	sub.DeletedBy = actor.FromContext(ctx).String()
+	sub.Version++
+	s.subs[id] = sub
+	s.record(ctx, models.AuditDelete, &before, &sub)
+	return true, nil
+}
+
+// Update applies a merge patch to a current subscription still at version, like pg
+func (s *SubscriptionRepo) Update(ctx context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.Deleted {
+		return models.SubscriptionResponse{}, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+	if sub.Version != version {
+		return models.SubscriptionResponse{}, fmt.Errorf("%w: current version is %d", errors.ErrVersionMismatch, sub.Version)
+	}
+	before := sub
+
+	var err error
+	if patch.ServiceName != nil {
+		sub.ServiceName = *patch.ServiceName
+	}
+	if patch.Price != nil {
+		sub.Price = *patch.Price
+	}
+	if patch.StartDate != nil {
+		if sub.StartDate, err = utils.ParseMonthYear(*patch.StartDate); err != nil {
+			return models.SubscriptionResponse{}, fmt.Errorf("%w: invalid start date", errors.ErrInvalidInput)
+		}
+	}
+	if patch.EndDate != nil {
+		if *patch.EndDate == "" {
+			sub.EndDate = sub.StartDate.AddDate(0, 1, 0)
+		} else if sub.EndDate, err = utils.ParseMonthYear(*patch.EndDate); err != nil {
+			return models.SubscriptionResponse{}, fmt.Errorf("%w: invalid end date", errors.ErrInvalidInput)
+		}
+	}
+	if sub.EndDate.Before(sub.StartDate) {
+		return models.SubscriptionResponse{}, fmt.Errorf("%w: end date must be after start date", errors.ErrInvalidInput)
+	}
+	if err := s.overlapCheck(sub); err != nil {
+		return models.SubscriptionResponse{}, err
+	}
+
+	sub.Version++
+	s.subs[id] = sub
+	s.record(ctx, models.AuditUpdate, &before, &sub)
+	return models.NewSubscriptionResponse(sub), nil
+}
+
+// GetDeletedByUserID returns the user's soft-deleted subscriptions, most recently deleted first, like pg
+func (s *SubscriptionRepo) GetDeletedByUserID(ctx context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var deleted []models.Subscription
+	for _, sub := range s.sorted() {
+		if sub.UserID == userID && sub.Deleted {
+			deleted = append(deleted, sub)
+		}
+	}
+	sort.SliceStable(deleted, func(i, j int) bool {
+		if !deleted[i].DeletedAt.Equal(*deleted[j].DeletedAt) {
+			return deleted[i].DeletedAt.After(*deleted[j].DeletedAt)
+		}
+		return deleted[i].ID > deleted[j].ID
+	})
+
+	var subscriptions []models.DeletedSubscriptionResponse
+	for _, sub := range deleted {
+		subscriptions = append(subscriptions, models.NewDeletedSubscriptionResponse(sub))
+	}
+	return subscriptions, nil
+}
+
+// Restore un-deletes a subscription after checking for overlaps, like pg
+func (s *SubscriptionRepo) Restore(ctx context.Context, id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok {
+		return false, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+	if !sub.Deleted {
+		return false, nil
+	}
+	if err := s.overlapCheck(sub); err != nil {
+		return false, err
+	}
+	before := sub
+	sub.Deleted, sub.DeletedAt, sub.DeletedBy = false, nil, ""
+	sub.Version++
+	s.subs[id] = sub
+	s.record(ctx, models.AuditRestore, &before, &sub)
+	return true, nil
+}
+
+// Purge permanently removes a soft-deleted subscription, like pg
+func (s *SubscriptionRepo) Purge(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok {
+		return fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+	if !sub.Deleted {
+		return fmt.Errorf("%w: delete the subscription before purging it", errors.ErrNotDeleted)
+	}
+	delete(s.subs, id)
+	s.record(ctx, models.AuditPurge, &sub, nil)
+	return nil
+}
+
+// PurgeDeleted permanently removes the subscriptions soft-deleted before the given time, like pg
+func (s *SubscriptionRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for _, sub := range s.sorted() {
+		if sub.Deleted && sub.DeletedAt != nil && sub.DeletedAt.Before(before) {
+			delete(s.subs, sub.ID)
+			s.record(ctx, models.AuditPurge, &sub, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// GetHistory returns the audit log of a subscription, oldest first, like pg
+func (s *SubscriptionRepo) GetHistory(ctx context.Context, id uint64) ([]models.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for _, event := range s.events {
+		if event.SubscriptionID == id {
+			events = append(events, event)
+		}
+	}
+	if _, ok := s.subs[id]; !ok && len(events) == 0 {
+		return nil, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+	}
+	return events, nil
+}
+
+// SearchHistory returns the audit events matching filter, newest first, like pg
+func (s *SubscriptionRepo) SearchHistory(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for i := len(s.events) - 1; i >= 0 && (filter.Limit <= 0 || len(events) < filter.Limit); i-- {
+		event := s.events[i]
+		if (filter.SubscriptionID == 0 || event.SubscriptionID == filter.SubscriptionID) &&
+			(filter.UserID == uuid.Nil || event.UserID == filter.UserID) &&
+			(filter.Actor == "" || event.Actor == filter.Actor) &&
+			(filter.Action == "" || event.Action == filter.Action) &&
+			(filter.From.IsZero() || !event.CreatedAt.Before(filter.From)) &&
+			(filter.To.IsZero() || event.CreatedAt.Before(filter.To)) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *SubscriptionRepo) OverlapCheck(ctx context.Context, sub models.Subscription) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.overlapCheck(sub)
+}
+
+// Stats returns aggregate figures over all subscriptions, like pg
+func (s *SubscriptionRepo) Stats(ctx context.Context) (models.SubscriptionStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats models.SubscriptionStats
+	now := time.Now()
+	for _, sub := range s.subs {
+		switch {
+		case sub.Deleted:
+			stats.Deleted++
+		case sub.EndDate.After(now):
+			stats.Active++
+			stats.ActivePriceSum += sub.Price
+		}
+	}
+	return stats, nil
+}
+
+// overlapCheck rejects sub if another current (not deleted) subscription of the same user and service overlaps it.
+// The caller must hold the lock.
+func (s *SubscriptionRepo) overlapCheck(sub models.Subscription) error {
+	for _, existing := range s.subs {
+		if existing.ID != sub.ID && !existing.Deleted && existing.UserID == sub.UserID && existing.ServiceName == sub.ServiceName &&
+			existing.EndDate.After(sub.StartDate) && existing.StartDate.Before(sub.EndDate) {
+			return fmt.Errorf("%w: wait till current subscription ends or extend it", errors.ErrAlreadyExists)
+		}
+	}
+	return nil
+}
+
+// parseRequest converts a creation request to a subscription, parsing and checking its dates; the
+// end date defaults to one month after the start
+func parseRequest(sub *models.SubscriptionRequest) (models.Subscription, error) {
+	startDate, err := utils.ParseMonthYear(sub.StartDate)
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: invalid start date", errors.ErrInvalidInput)
+	}
+	endDate := startDate.AddDate(0, 1, 0)
+
+	if sub.EndDate != "" {
+		endDate, err = utils.ParseMonthYear(sub.EndDate)
+		if err != nil {
+			return models.Subscription{}, fmt.Errorf("%w: invalid end date", errors.ErrInvalidInput)
+		}
+		if endDate.Before(startDate) {
+			return models.Subscription{}, fmt.Errorf("%w: end date must be after start date", errors.ErrInvalidInput)
+		}
+	}
+	return models.RequestToSubscription(*sub, startDate, endDate), nil
+}
+
+// record appends the change of a subscription from before to after to the audit log, with the
+// actor and request ID of ctx. The caller must hold the write lock.
+func (s *SubscriptionRepo) record(ctx context.Context, action models.AuditAction, before, after *models.Subscription) {
+	event := models.NewAuditEvent(action, actor.FromContext(ctx).String(), logging.RequestIDFromContext(ctx), before, after)
+	event.ID = uint64(len(s.events)) + 1
+	event.CreatedAt = time.Now().UTC()
+	s.events = append(s.events, event)
+}
+
+// insert stores sub under a new ID and returns it. The caller must hold the write lock.
+func (s *SubscriptionRepo) insert(sub models.Subscription) uint64 {
+	sub.ID = s.nextID
+	sub.Version = 1
+	s.nextID++
+	s.subs[sub.ID] = sub
+	return sub.ID
+}
+
+// sorted returns the subscriptions ordered by ID. The caller must hold the lock.
+func (s *SubscriptionRepo) sorted() []models.Subscription {
+	subs := make([]models.Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
@@ -0,0 +1,21 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/memory"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository/repotest"
+)
+
+func TestContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.SubscriptionRepository {
+		return memory.NewSubscriptionRepo()
+	})
+}
+
+func TestIdempotencyContract(t *testing.T) {
+	repotest.RunIdempotency(t, func(t *testing.T) repository.IdempotencyRepository {
+		return memory.NewIdempotencyRepo()
+	})
+}
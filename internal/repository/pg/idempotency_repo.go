@@ -0,0 +1,118 @@
+package pg
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// IdempotencyRepo stores the idempotency records in the idempotency_keys table of the primary.
+// Concurrent reservations of a key are serialized by its primary key: only one inserts the row.
+type IdempotencyRepo struct {
+	pool *pgxpool.Pool
+}
+
+var _ repository.IdempotencyRepository = (*IdempotencyRepo)(nil)
+
+func NewIdempotencyRepo(pool *pgxpool.Pool) *IdempotencyRepo {
+	return &IdempotencyRepo{pool: pool}
+}
+
+// Reserve inserts the row of key, or takes over an expired one. When an unexpired row holds the
+// key, it is read and returned instead; if that row expires and is deleted in between, the
+// reservation is tried again.
+func (s *IdempotencyRepo) Reserve(ctx context.Context, key, requestHash string, expiresAt time.Time) (models.IdempotencyRecord, bool, error) {
+	reserve, reserveParams, err := sq.Insert("idempotency_keys").
+		Columns("key", "request_hash", "expires_at").
+		Values(key, requestHash, expiresAt).
+		Suffix(`ON CONFLICT (key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash, status = NULL, header = NULL, body = NULL,
+				created_at = NOW(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= NOW()
+			RETURNING key`).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("error creating query: %w", err)
+	}
+	get, getParams, err := sq.Select("key", "request_hash", "COALESCE(status, 0)", "header", "body", "expires_at").
+		From("idempotency_keys").Where("key = ?", key).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("error creating query: %w", err)
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		var reserved string
+		err := s.pool.QueryRow(ctx, reserve, reserveParams...).Scan(&reserved)
+		if err == nil {
+			return models.IdempotencyRecord{Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}, true, nil
+		}
+		if !stderrors.Is(err, pgx.ErrNoRows) {
+			return models.IdempotencyRecord{}, false, fmt.Errorf("error reserving idempotency key: %w", err)
+		}
+
+		var record models.IdempotencyRecord
+		err = s.pool.QueryRow(ctx, get, getParams...).Scan(&record.Key, &record.RequestHash, &record.Status, &record.Header, &record.Body, &record.ExpiresAt)
+		if err == nil {
+			return record, false, nil
+		}
+		if !stderrors.Is(err, pgx.ErrNoRows) {
+			return models.IdempotencyRecord{}, false, fmt.Errorf("error getting idempotency key: %w", err)
+		}
+	}
+	return models.IdempotencyRecord{}, false, fmt.Errorf("error reserving idempotency key: %q keeps changing", key)
+}
+
+// Complete stores the response in the row of the in-flight request
+func (s *IdempotencyRepo) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	query, params, err := sq.Update("idempotency_keys").
+		Set("status", record.Status).
+		Set("header", record.Header).
+		Set("body", record.Body).
+		Set("expires_at", record.ExpiresAt).
+		Where("key = ?", record.Key).Where("request_hash = ?", record.RequestHash).Where("status IS NULL").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("error creating query: %w", err)
+	}
+	if _, err := s.pool.Exec(ctx, query, params...); err != nil {
+		return fmt.Errorf("error storing idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release deletes the row of the in-flight request
+func (s *IdempotencyRepo) Release(ctx context.Context, key, requestHash string) error {
+	query, params, err := sq.Delete("idempotency_keys").
+		Where("key = ?", key).Where("request_hash = ?", requestHash).Where("status IS NULL").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("error creating query: %w", err)
+	}
+	if _, err := s.pool.Exec(ctx, query, params...); err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the rows expired before now
+func (s *IdempotencyRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query, params, err := sq.Delete("idempotency_keys").Where("expires_at <= ?", now).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("error creating query: %w", err)
+	}
+	tag, err := s.pool.Exec(ctx, query, params...)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
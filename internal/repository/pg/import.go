@@ -0,0 +1,195 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Import creates the rows that pass the checks of Create in one transaction on the primary.
+// The current subscriptions of the users of the rows are read once and every row is checked
+// against them and against the rows before it. With opts.Copy the subscriptions and their audit
+// events are written with COPY, their IDs being taken from the sequence beforehand; otherwise
+// each row is inserted like Create.
+//
+// Returns:
+//   - the outcome of each row, in order: the ID of the created subscription, or ErrInvalidInput
+//     or ErrAlreadyExists for rows that cannot be created
+func (s *SubscriptionRepo) Import(ctx context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+	outcomes := make([]models.ImportOutcome, len(rows))
+	subs := make([]models.Subscription, len(rows))
+	var users []string
+	seen := make(map[uuid.UUID]bool)
+	for i := range rows {
+		subs[i], outcomes[i].Err = parseRequest(&rows[i].Request)
+		if outcomes[i].Err == nil && !seen[subs[i].UserID] {
+			seen[subs[i].UserID] = true
+			users = append(users, subs[i].UserID.String())
+		}
+	}
+
+	var created []int // indexes of the created rows
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		current, err := currentSubscriptions(ctx, tx, users)
+		if err != nil {
+			return err
+		}
+
+		failed := false
+		for i := range rows {
+			if outcomes[i].Err == nil {
+				outcomes[i].Err = importOverlap(rows, subs, outcomes, current[subs[i].UserID], i)
+			}
+			failed = failed || outcomes[i].Err != nil
+		}
+		if opts.DryRun || (failed && opts.Mode == models.ImportAllOrNothing) {
+			return nil
+		}
+
+		for i := range outcomes {
+			if outcomes[i].Err == nil {
+				created = append(created, i)
+			}
+		}
+		if opts.Copy {
+			return copySubscriptions(ctx, tx, subs, outcomes, created)
+		}
+		return insertSubscriptions(ctx, tx, subs, outcomes, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, 2*len(created))
+	for _, i := range created {
+		keys = append(keys, userKey(subs[i].UserID), idKey(outcomes[i].ID))
+	}
+	s.db.wrote(keys...)
+	return outcomes, nil
+}
+
+// currentSubscriptions returns the subscriptions of users that are not deleted, by user
+func currentSubscriptions(ctx context.Context, tx pgx.Tx, users []string) (map[uuid.UUID][]models.Subscription, error) {
+	current := make(map[uuid.UUID][]models.Subscription)
+	if len(users) == 0 {
+		return current, nil
+	}
+
+	query, params, err := sq.Select(columns...).From("subscriptions").Where("user_id = ANY(?::uuid[])", users).Where("deleted = false").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error creating query: %w", err)
+	}
+	rows, err := tx.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting subscriptions: %w", err)
+	}
+	subs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Subscription, error) {
+		var sub models.Subscription
+		err := scanSubscription(row, &sub)
+		return sub, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting subscriptions: %w", err)
+	}
+	for _, sub := range subs {
+		current[sub.UserID] = append(current[sub.UserID], sub)
+	}
+	return current, nil
+}
+
+// importOverlap returns ErrAlreadyExists if row i overlaps a current subscription of its user,
+// or an earlier row that can be created
+func importOverlap(rows []models.ImportRow, subs []models.Subscription, outcomes []models.ImportOutcome, current []models.Subscription, i int) error {
+	for _, existing := range current {
+		if subs[i].Overlaps(existing) {
+			return fmt.Errorf("%w: wait till current subscription ends or extend it", errors.ErrAlreadyExists)
+		}
+	}
+	for j := range i {
+		if outcomes[j].Err == nil && subs[i].Overlaps(subs[j]) {
+			return fmt.Errorf("%w: overlaps the subscription on line %d", errors.ErrAlreadyExists, rows[j].Line)
+		}
+	}
+	return nil
+}
+
+// insertSubscriptions inserts the subscriptions of the created rows one by one, like Create
+func insertSubscriptions(ctx context.Context, tx pgx.Tx, subs []models.Subscription, outcomes []models.ImportOutcome, created []int) error {
+	for _, i := range created {
+		query, params, err := sq.Insert("subscriptions").
+			Columns("service_name", "price", "user_id", "start_date", "end_date").
+			Values(subs[i].ServiceName, subs[i].Price, subs[i].UserID, subs[i].StartDate, subs[i].EndDate).
+			Suffix("RETURNING " + strings.Join(columns, ", ")).PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return fmt.Errorf("error creating query: %w", err)
+		}
+
+		var sub models.Subscription
+		if err := scanSubscription(tx.QueryRow(ctx, query, params...), &sub); err != nil {
+			return fmt.Errorf("error creating subscription: %w", err)
+		}
+		if err := audit(ctx, tx, models.AuditCreate, nil, &sub); err != nil {
+			return err
+		}
+		outcomes[i].ID = sub.ID
+	}
+	return nil
+}
+
+// copySubscriptions writes the subscriptions of the created rows and their audit events with
+// COPY, which cannot return the generated IDs: they are taken from the sequence first
+func copySubscriptions(ctx context.Context, tx pgx.Tx, subs []models.Subscription, outcomes []models.ImportOutcome, created []int) error {
+	if len(created) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, "SELECT nextval(pg_get_serial_sequence('subscriptions', 'id')) FROM generate_series(1, $1)", len(created))
+	if err != nil {
+		return fmt.Errorf("error allocating subscription ids: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return fmt.Errorf("error allocating subscription ids: %w", err)
+	}
+	for n, i := range created {
+		subs[i].ID = uint64(ids[n])
+		subs[i].Version = 1
+		outcomes[i].ID = subs[i].ID
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"subscriptions"},
+		[]string{"id", "service_name", "price", "user_id", "start_date", "end_date"},
+		pgx.CopyFromSlice(len(created), func(n int) ([]any, error) {
+			sub := subs[created[n]]
+			return []any{int64(sub.ID), sub.ServiceName, sub.Price, sub.UserID, sub.StartDate, sub.EndDate}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("error copying subscriptions: %w", err)
+	}
+
+	who, requestID := actor.FromContext(ctx).String(), logging.RequestIDFromContext(ctx)
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"subscription_audit"},
+		[]string{"subscription_id", "user_id", "action", "actor", "request_id", "after"},
+		pgx.CopyFromSlice(len(created), func(n int) ([]any, error) {
+			sub := subs[created[n]]
+			event := models.NewAuditEvent(models.AuditCreate, who, requestID, nil, &sub)
+			after, err := snapshotJSON(event.After)
+			if err != nil {
+				return nil, err
+			}
+			return []any{int64(event.SubscriptionID), event.UserID, string(event.Action), event.Actor, event.RequestID, after}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("error copying audit events: %w", err)
+	}
+	return nil
+}
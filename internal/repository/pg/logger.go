@@ -0,0 +1,36 @@
+package pg
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+// NewQueryLogger returns a pgx tracer that logs every SQL statement through logger.
+// Statements are logged at debug level and failures at error level; because pgx passes
+// the query context along, records carry the request ID of the HTTP request that issued them.
+func NewQueryLogger(logger *slog.Logger) *tracelog.TraceLog {
+	return &tracelog.TraceLog{
+		Logger: tracelog.LoggerFunc(func(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+			attrs := make([]slog.Attr, 0, len(data))
+			for k, v := range data {
+				attrs = append(attrs, slog.Any(k, v))
+			}
+			logger.LogAttrs(ctx, slogLevel(level), msg, attrs...)
+		}),
+		LogLevel: tracelog.LogLevelTrace,
+	}
+}
+
+// slogLevel maps pgx log levels to slog levels (pgx info and below become debug)
+func slogLevel(level tracelog.LogLevel) slog.Level {
+	switch level {
+	case tracelog.LogLevelError:
+		return slog.LevelError
+	case tracelog.LogLevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelDebug
+	}
+}
@@ -0,0 +1,162 @@
+package pg
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Options configures the read replicas of the repository
+type Options struct {
+	// Replicas receive the query methods; without replicas every statement goes to the primary
+	Replicas []*pgxpool.Pool
+	// ReadYourWrites is how long reads about a user or subscription that was just written are
+	// sent to the primary, so they do not miss the write because of replication lag. The window is
+	// kept in memory, so only reads through the same process are covered.
+	ReadYourWrites time.Duration
+}
+
+// replica is a read replica, marked unhealthy when a query fails to reach it
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// router sends reads to healthy replicas in turn, or to the primary during the read-your-writes
+// window of what they read or when no replica is healthy
+type router struct {
+	primary  *pgxpool.Pool
+	replicas []*replica
+	turn     atomic.Uint64
+	window   time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	recent map[string]time.Time // written user or subscription key -> end of its window
+	pruned time.Time
+}
+
+func newRouter(primary *pgxpool.Pool, opts Options) *router {
+	r := &router{
+		primary: primary,
+		window:  opts.ReadYourWrites,
+		now:     time.Now,
+		recent:  make(map[string]time.Time),
+	}
+	for _, pool := range opts.Replicas {
+		rep := &replica{pool: pool}
+		rep.healthy.Store(true)
+		r.replicas = append(r.replicas, rep)
+	}
+	return r
+}
+
+func userKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+func idKey(id uint64) string {
+	return "id:" + strconv.FormatUint(id, 10)
+}
+
+// wrote starts the read-your-writes window of keys
+func (r *router) wrote(keys ...string) {
+	if len(r.replicas) == 0 || r.window <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	// Drop expired windows at most once per window length
+	if now.Sub(r.pruned) > r.window {
+		for key, until := range r.recent {
+			if now.After(until) {
+				delete(r.recent, key)
+			}
+		}
+		r.pruned = now
+	}
+	for _, key := range keys {
+		r.recent[key] = now.Add(r.window)
+	}
+}
+
+// sticky reports whether any of keys is in its read-your-writes window
+func (r *router) sticky(keys ...string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for _, key := range keys {
+		if until, ok := r.recent[key]; ok && !now.After(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the next healthy replica, or nil if there is none
+func (r *router) pick() *replica {
+	n := uint64(len(r.replicas))
+	start := r.turn.Add(1)
+	for i := range n {
+		if rep := r.replicas[(start+i)%n]; rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+// read runs fn on a replica, or on the primary if one of keys was just written or no replica is
+// healthy. A replica that cannot be reached is marked unhealthy and fn is retried on the primary.
+func (r *router) read(ctx context.Context, keys []string, fn func(pool *pgxpool.Pool) error) error {
+	if len(r.replicas) == 0 || r.sticky(keys...) {
+		return fn(r.primary)
+	}
+	rep := r.pick()
+	if rep == nil {
+		return fn(r.primary)
+	}
+
+	err := fn(rep.pool)
+	if err != nil && unreachable(ctx, err) {
+		rep.healthy.Store(false)
+		return fn(r.primary)
+	}
+	return err
+}
+
+// unreachable reports whether err means the database could not run the query at all, as opposed
+// to an answer (no rows, an SQL error) or the caller giving up
+func unreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || stderrors.Is(err, pgx.ErrNoRows) || stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	return !stderrors.As(err, &pgErr)
+}
+
+// CheckReplicas pings every replica, marking it healthy or unhealthy. It is meant to run
+// periodically so replicas marked unhealthy after a failed query are used again once they recover.
+func (s *SubscriptionRepo) CheckReplicas(ctx context.Context) error {
+	var errs []error
+	for i, rep := range s.db.replicas {
+		err := rep.pool.Ping(ctx)
+		rep.healthy.Store(err == nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+		}
+	}
+	return stderrors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+package pg
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newPool returns a pool that never connects: the router tests only compare pools
+func newPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// target runs a read and returns the pool it was sent to
+func target(t *testing.T, r *router, keys ...string) *pgxpool.Pool {
+	t.Helper()
+	var used *pgxpool.Pool
+	if err := r.read(context.Background(), keys, func(pool *pgxpool.Pool) error {
+		used = pool
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return used
+}
+
+func TestRouterWithoutReplicas(t *testing.T) {
+	primary := newPool(t)
+	r := newRouter(primary, Options{ReadYourWrites: time.Second})
+
+	r.wrote(idKey(1))
+	if got := target(t, r, idKey(2)); got != primary {
+		t.Error("read not sent to the primary")
+	}
+	if len(r.recent) != 0 {
+		t.Errorf("recorded %d writes without replicas", len(r.recent))
+	}
+}
+
+func TestRouterRoundRobin(t *testing.T) {
+	primary, a, b := newPool(t), newPool(t), newPool(t)
+	r := newRouter(primary, Options{Replicas: []*pgxpool.Pool{a, b}})
+
+	counts := map[*pgxpool.Pool]int{}
+	for range 10 {
+		counts[target(t, r)]++
+	}
+	if counts[a] != 5 || counts[b] != 5 || counts[primary] != 0 {
+		t.Errorf("reads per pool: primary %d, replicas %d and %d; want 0, 5 and 5", counts[primary], counts[a], counts[b])
+	}
+}
+
+func TestRouterReadYourWrites(t *testing.T) {
+	primary, replica := newPool(t), newPool(t)
+	r := newRouter(primary, Options{Replicas: []*pgxpool.Pool{replica}, ReadYourWrites: 5 * time.Second})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	user := uuid.New()
+	r.wrote(userKey(user), idKey(7))
+
+	for _, tc := range []struct {
+		name string
+		keys []string
+		want *pgxpool.Pool
+	}{
+		{"written user", []string{userKey(user)}, primary},
+		{"written subscription", []string{idKey(7)}, primary},
+		{"several users, one written", []string{userKey(uuid.New()), userKey(user)}, primary},
+		{"other user", []string{userKey(uuid.New())}, replica},
+		{"no key", nil, replica},
+	} {
+		if got := target(t, r, tc.keys...); got != tc.want {
+			t.Errorf("%s: read sent to the wrong pool", tc.name)
+		}
+	}
+
+	now = now.Add(6 * time.Second)
+	if got := target(t, r, userKey(user)); got != replica {
+		t.Error("read sent to the primary after the window")
+	}
+	r.wrote(userKey(uuid.New()))
+	if len(r.recent) != 1 {
+		t.Errorf("%d windows kept, want the expired ones pruned", len(r.recent))
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	primary, replica := newPool(t), newPool(t)
+	r := newRouter(primary, Options{Replicas: []*pgxpool.Pool{replica}})
+	ctx := context.Background()
+
+	// Answers from the replica are returned as they are
+	for _, answer := range []error{pgx.ErrNoRows, &pgconn.PgError{Code: "42P01"}} {
+		err := r.read(ctx, nil, func(pool *pgxpool.Pool) error {
+			if pool != replica {
+				t.Error("answer retried on the primary")
+			}
+			return answer
+		})
+		if !stderrors.Is(err, answer) {
+			t.Errorf("error = %v, want %v", err, answer)
+		}
+	}
+
+	// A replica that cannot be reached is skipped until it is healthy again
+	var calls []*pgxpool.Pool
+	err := r.read(ctx, nil, func(pool *pgxpool.Pool) error {
+		calls = append(calls, pool)
+		if pool == replica {
+			return stderrors.New("dial tcp: connection refused")
+		}
+		return nil
+	})
+	if err != nil || len(calls) != 2 || calls[1] != primary {
+		t.Fatalf("error %v after %d calls, want the read retried on the primary", err, len(calls))
+	}
+	if got := target(t, r); got != primary {
+		t.Error("read sent to the unhealthy replica")
+	}
+
+	r.replicas[0].healthy.Store(true)
+	if got := target(t, r); got != replica {
+		t.Error("read not sent to the recovered replica")
+	}
+}
+
+func TestRouterCanceledReadIsNotRetried(t *testing.T) {
+	primary, replica := newPool(t), newPool(t)
+	r := newRouter(primary, Options{Replicas: []*pgxpool.Pool{replica}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := r.read(ctx, nil, func(pool *pgxpool.Pool) error {
+		calls++
+		return ctx.Err()
+	})
+	if !stderrors.Is(err, context.Canceled) || calls != 1 || !r.replicas[0].healthy.Load() {
+		t.Errorf("error %v after %d calls, healthy %v; want the cancellation returned as is", err, calls, r.replicas[0].healthy.Load())
+	}
+}
@@ -1,16 +1,30 @@
-// Package pg implements the SubscriptionRepository using PostgreSQL.
+// Package pg implements the SubscriptionRepository and IdempotencyRepository using PostgreSQL.
 //
 // Key behaviors:
-//   - Uses soft deletes (sets `deleted = true` instead of hard deletions)
+//   - Uses soft deletes (sets `deleted = true` instead of hard deletions); soft-deleted
+//     subscriptions can be restored, or purged (removed for good)
 //   - Validates subscription date ranges and overlaps
+//   - Guards updates with the `version` column, incremented on every change (optimistic concurrency)
+//   - Records every change in the append-only subscription_audit table, in the transaction making
+//     it, with the actor and request ID of the context and snapshots of the row before and after
 //   - Converts dates to/from "MM-YYYY" format where needed
+//   - Imports rows in one transaction, optionally with COPY for large imports
+//   - Sends GetAll, GetByUserID, GetByUserIDs, GetByID, GetDeletedByUserID, GetCost, GetHistory and
+//     SearchHistory to the read replicas, if any; writes and the reads done by Create, Import, RenewOrExtend, Update and Restore go
+//     to the primary
+//   - Reads about a user or subscription written less than Options.ReadYourWrites ago go to the primary
+//   - Falls back to the primary when no replica is healthy; CheckReplicas refreshes their health
 package pg
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
 	"github.com/Joshdike/subscriptions_aggregator/internal/models"
 	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
 	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
@@ -22,15 +36,27 @@ import (
 	sq "github.com/Masterminds/squirrel"
 )
 
+// columns are the subscription columns, in the order read by scanSubscription
+var columns = []string{"id", "service_name", "price", "user_id", "start_date", "end_date", "deleted", "deleted_at", "COALESCE(deleted_by, '')", "version"}
+
+// scanSubscription reads the columns of one subscription from row into sub
+func scanSubscription(row pgx.Row, sub *models.Subscription) error {
+	return row.Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.Deleted, &sub.DeletedAt, &sub.DeletedBy, &sub.Version)
+}
+
 type SubscriptionRepo struct {
-	pool *pgxpool.Pool
+	pool *pgxpool.Pool // primary
+	db   *router
 }
 
 var _ repository.SubscriptionRepository = (*SubscriptionRepo)(nil)
 
-func NewSubscriptionRepo(pool *pgxpool.Pool) *SubscriptionRepo {
+// NewSubscriptionRepo returns a repository writing to the primary pool and reading from the
+// replicas of opts (the zero Options reads from the primary too)
+func NewSubscriptionRepo(primary *pgxpool.Pool, opts Options) *SubscriptionRepo {
 	return &SubscriptionRepo{
-		pool: pool,
+		pool: primary,
+		db:   newRouter(primary, opts),
 	}
 }
 
@@ -44,25 +70,7 @@ func NewSubscriptionRepo(pool *pgxpool.Pool) *SubscriptionRepo {
 //   - ErrInvalidInput if dates are invalid or out of order
 //   - ErrAlreadyExists if an overlapping subscription exists
 func (s *SubscriptionRepo) Create(ctx context.Context, sub *models.SubscriptionRequest) (uint64, error) {
-	startDate, err := utils.ParseMonthYear(sub.StartDate)
-	if err != nil {
-		return 0, fmt.Errorf("%w: invalid start date", errors.ErrInvalidInput)
-	}
-	endDate := startDate.AddDate(0, 1, 0)
-
-	if sub.EndDate != "" {
-		endDate, err = utils.ParseMonthYear(sub.EndDate)
-		if err != nil {
-			return 0, fmt.Errorf("%w: invalid end date", errors.ErrInvalidInput)
-		}
-		if endDate.Before(startDate) {
-			return 0, fmt.Errorf("%w: end date must be after start date", errors.ErrInvalidInput)
-		}
-	}
-
-	subscription := models.RequestToSubscription(*sub, startDate, endDate)
-
-	err = s.OverlapCheck(ctx, subscription)
+	subscription, err := parseRequest(sub)
 	if err != nil {
 		return 0, err
 	}
@@ -70,78 +78,150 @@ func (s *SubscriptionRepo) Create(ctx context.Context, sub *models.SubscriptionR
 	query, params, err := sq.Insert("subscriptions").
 		Columns("service_name", "price", "user_id", "start_date", "end_date").
 		Values(subscription.ServiceName, subscription.Price, subscription.UserID, subscription.StartDate, subscription.EndDate).
-		Suffix("RETURNING id").PlaceholderFormat(sq.Dollar).ToSql()
+		Suffix("RETURNING " + strings.Join(columns, ", ")).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return 0, fmt.Errorf("error creating query: %w", err)
 	}
 
-	var id uint64
-	err = s.pool.QueryRow(ctx, query, params...).Scan(&id)
+	var created models.Subscription
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if err := overlapCheck(ctx, tx, subscription); err != nil {
+			return err
+		}
+		if err := scanSubscription(tx.QueryRow(ctx, query, params...), &created); err != nil {
+			return fmt.Errorf("error creating subscription: %w", err)
+		}
+		return audit(ctx, tx, models.AuditCreate, nil, &created)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("error creating subscription: %w", err)
+		return 0, err
 	}
+	s.db.wrote(userKey(created.UserID), idKey(created.ID))
 
-	return id, nil
+	return created.ID, nil
 }
 
 func (s *SubscriptionRepo) GetAll(ctx context.Context) ([]models.AdminSubscriptionResponse, error) {
-	query, params, err := sq.Select("*").From("subscriptions").PlaceholderFormat(sq.Dollar).ToSql()
+	query, params, err := sq.Select(columns...).From("subscriptions").PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("error creating query: %w", err)
 	}
 
-	rows, err := s.pool.Query(ctx, query, params...)
-	if err != nil {
-		return nil, fmt.Errorf("error getting subscriptions: %w", err)
-	}
-	defer rows.Close()
-
 	var subscriptions []models.AdminSubscriptionResponse
-	for rows.Next() {
-		var sub models.Subscription
-		err = rows.Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.Deleted)
+	err = s.db.read(ctx, nil, func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(ctx, query, params...)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning subscription: %w", err)
+			return fmt.Errorf("error getting subscriptions: %w", err)
+		}
+		defer rows.Close()
+
+		subscriptions = nil
+		for rows.Next() {
+			var sub models.Subscription
+			err = scanSubscription(rows, &sub)
+			if err != nil {
+				return fmt.Errorf("error scanning subscription: %w", err)
+			}
+			subscription := models.NewAdminSubscriptionResponse(sub)
+			subscriptions = append(subscriptions, subscription)
 		}
-		subscription := models.NewAdminSubscriptionResponse(sub)
-		subscriptions = append(subscriptions, subscription)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return subscriptions, nil
 }
 
 func (s *SubscriptionRepo) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
-	query, params, err := sq.Select("*").From("subscriptions").Where("user_id = ?", userID).Where("deleted = false").PlaceholderFormat(sq.Dollar).ToSql()
+	query, params, err := sq.Select(columns...).From("subscriptions").Where("user_id = ?", userID).Where("deleted = false").PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("error creating query: %w", err)
 	}
 
-	rows, err := s.pool.Query(ctx, query, params...)
+	var subscriptions []models.SubscriptionResponse
+	err = s.db.read(ctx, []string{userKey(userID)}, func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(ctx, query, params...)
+		if err != nil {
+			return fmt.Errorf("error getting subscriptions: %w", err)
+		}
+		defer rows.Close()
+
+		subscriptions = nil
+		for rows.Next() {
+			var sub models.Subscription
+			err = scanSubscription(rows, &sub)
+			if err != nil {
+				return fmt.Errorf("error scanning subscription: %w", err)
+			}
+			subscription := models.NewSubscriptionResponse(sub)
+			subscriptions = append(subscriptions, subscription)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting subscriptions: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return subscriptions, nil
+}
 
-	var subscriptions []models.SubscriptionResponse
-	for rows.Next() {
-		var sub models.Subscription
-		err = rows.Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.Deleted)
+// GetByUserIDs returns the non-deleted subscriptions of several users in one query, grouped by user.
+// Users without subscriptions are absent from the map.
+func (s *SubscriptionRepo) GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	subscriptions := make(map[uuid.UUID][]models.SubscriptionResponse, len(userIDs))
+	if len(userIDs) == 0 {
+		return subscriptions, nil
+	}
+
+	ids := make([]string, 0, len(userIDs))
+	keys := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		ids = append(ids, id.String())
+		keys = append(keys, userKey(id))
+	}
+
+	query, params, err := sq.Select(columns...).From("subscriptions").Where("user_id = ANY(?::uuid[])", ids).Where("deleted = false").OrderBy("id").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error creating query: %w", err)
+	}
+
+	err = s.db.read(ctx, keys, func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(ctx, query, params...)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning subscription: %w", err)
+			return fmt.Errorf("error getting subscriptions: %w", err)
+		}
+		defer rows.Close()
+
+		clear(subscriptions)
+		for rows.Next() {
+			var sub models.Subscription
+			err = scanSubscription(rows, &sub)
+			if err != nil {
+				return fmt.Errorf("error scanning subscription: %w", err)
+			}
+			subscriptions[sub.UserID] = append(subscriptions[sub.UserID], models.NewSubscriptionResponse(sub))
 		}
-		subscription := models.NewSubscriptionResponse(sub)
-		subscriptions = append(subscriptions, subscription)
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error getting subscriptions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return subscriptions, nil
 }
 
 func (s *SubscriptionRepo) GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error) {
-	query, params, err := sq.Select("*").From("subscriptions").Where("id = ?", id).Where("deleted = false").PlaceholderFormat(sq.Dollar).ToSql()
+	query, params, err := sq.Select(columns...).From("subscriptions").Where("id = ?", id).Where("deleted = false").PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return models.SubscriptionResponse{}, fmt.Errorf("error creating query: %w", err)
 	}
 
 	var sub models.Subscription
-	err = s.pool.QueryRow(ctx, query, params...).Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.Deleted)
+	err = s.db.read(ctx, []string{idKey(id)}, func(pool *pgxpool.Pool) error {
+		return scanSubscription(pool.QueryRow(ctx, query, params...), &sub)
+	})
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return models.SubscriptionResponse{}, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
@@ -163,60 +243,141 @@ func (s *SubscriptionRepo) GetByID(ctx context.Context, id uint64) (models.Subsc
 //   - ID of the new subscription
 //   - ErrSubscriptionNotFound if the original subscription doesn't exist
 func (s *SubscriptionRepo) RenewOrExtend(ctx context.Context, id uint64) (uint64, error) {
-	query, params, err := sq.Select(("*")).From("subscriptions").Where("id = ?", id).PlaceholderFormat(sq.Dollar).ToSql()
-	if err != nil {
-		return 0, fmt.Errorf("error creating query: %w", err)
-	}
+	var renewed models.Subscription
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		sub, err := lockSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	var sub models.Subscription
-	err = s.pool.QueryRow(ctx, query, params...).Scan(&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.Deleted)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return 0, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+		var newStartDate time.Time
+		if sub.EndDate.After(time.Now()) {
+			newStartDate = sub.EndDate
+		} else {
+			newStartDate = time.Now()
+		}
+		newSubscription := models.Subscription{
+			ServiceName: sub.ServiceName,
+			Price:       sub.Price,
+			UserID:      sub.UserID,
+			StartDate:   newStartDate,
+			EndDate:     newStartDate.Add(sub.EndDate.Sub(sub.StartDate)),
+			Deleted:     false,
 		}
-		return 0, fmt.Errorf("error getting subscription: %w", err)
-	}
 
-	var newStartDate time.Time
-	if sub.EndDate.After(time.Now()) {
-		newStartDate = sub.EndDate
-	} else {
-		newStartDate = time.Now()
-	}
-	newSubscription := models.Subscription{
-		ServiceName: sub.ServiceName,
-		Price:       sub.Price,
-		UserID:      sub.UserID,
-		StartDate:   newStartDate,
-		EndDate:     newStartDate.Add(sub.EndDate.Sub(sub.StartDate)),
-		Deleted:     false,
-	}
+		query, params, err := sq.Insert("subscriptions").
+			Columns("service_name", "price", "user_id", "start_date", "end_date", "deleted").
+			Values(newSubscription.ServiceName, newSubscription.Price, newSubscription.UserID, newSubscription.StartDate, newSubscription.EndDate, newSubscription.Deleted).
+			Suffix("RETURNING " + strings.Join(columns, ", ")).
+			PlaceholderFormat(sq.Dollar).ToSql()
 
-	query, params, err = sq.Insert("subscriptions").
-		Columns("service_name", "price", "user_id", "start_date", "end_date", "deleted").
-		Values(newSubscription.ServiceName, newSubscription.Price, newSubscription.UserID, newSubscription.StartDate, newSubscription.EndDate, newSubscription.Deleted).
-		Suffix("RETURNING id").
-		PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return fmt.Errorf("error creating query: %w", err)
+		}
 
+		err = scanSubscription(tx.QueryRow(ctx, query, params...), &renewed)
+		if err != nil {
+			return fmt.Errorf("error getting subscription: %w", err)
+		}
+		return audit(ctx, tx, models.AuditRenew, &sub, &renewed)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("error creating query: %w", err)
+		return 0, err
 	}
+	s.db.wrote(userKey(renewed.UserID), idKey(renewed.ID))
+	return renewed.ID, nil
+}
+
+// Update applies a merge patch to a current (not deleted) subscription after validating:
+//   - Patched start/end dates (must be in "MM-YYYY" format; an empty end date is reset
+//     to one month after the start)
+//   - End date >= Start date, once patched
+//   - No overlapping subscriptions for the same user/service
+//
+// The row is locked while it is checked and updated, so the update only happens if it is still
+// at version, which it then increments.
+//
+// Returns:
+//   - The updated subscription, with its new version
+//   - ErrSubscriptionNotFound if the subscription doesn't exist or is deleted
+//   - ErrVersionMismatch if the subscription is not (or no longer) at version
+//   - ErrInvalidInput if dates are invalid or out of order
+//   - ErrAlreadyExists if the patched subscription overlaps another one
+func (s *SubscriptionRepo) Update(ctx context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+	var updated models.Subscription
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		before, err := lockSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.Deleted {
+			return fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+		}
+		if before.Version != version {
+			return fmt.Errorf("%w: current version is %d", errors.ErrVersionMismatch, before.Version)
+		}
+
+		sub := before
+		if patch.ServiceName != nil {
+			sub.ServiceName = *patch.ServiceName
+		}
+		if patch.Price != nil {
+			sub.Price = *patch.Price
+		}
+		if patch.StartDate != nil {
+			if sub.StartDate, err = utils.ParseMonthYear(*patch.StartDate); err != nil {
+				return fmt.Errorf("%w: invalid start date", errors.ErrInvalidInput)
+			}
+		}
+		if patch.EndDate != nil {
+			if *patch.EndDate == "" {
+				sub.EndDate = sub.StartDate.AddDate(0, 1, 0)
+			} else if sub.EndDate, err = utils.ParseMonthYear(*patch.EndDate); err != nil {
+				return fmt.Errorf("%w: invalid end date", errors.ErrInvalidInput)
+			}
+		}
+		if sub.EndDate.Before(sub.StartDate) {
+			return fmt.Errorf("%w: end date must be after start date", errors.ErrInvalidInput)
+		}
+
+		err = overlapCheck(ctx, tx, sub)
+		if err != nil {
+			return err
+		}
 
-	var newId uint64
-	err = s.pool.QueryRow(ctx, query, params...).Scan(&newId)
+		query, params, err := sq.Update("subscriptions").
+			Set("service_name", sub.ServiceName).
+			Set("price", sub.Price).
+			Set("start_date", sub.StartDate).
+			Set("end_date", sub.EndDate).
+			Set("version", sq.Expr("version + 1")).
+			Where("id = ?", id).
+			Suffix("RETURNING " + strings.Join(columns, ", ")).
+			PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return fmt.Errorf("error creating query: %w", err)
+		}
+
+		err = scanSubscription(tx.QueryRow(ctx, query, params...), &updated)
+		if err != nil {
+			return fmt.Errorf("error updating subscription: %w", err)
+		}
+		return audit(ctx, tx, models.AuditUpdate, &before, &updated)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("error getting subscription: %w", err)
+		return models.SubscriptionResponse{}, err
 	}
-	return newId, nil
+	s.db.wrote(userKey(updated.UserID), idKey(id))
+	return models.NewSubscriptionResponse(updated), nil
 }
 
 // GetCost calculates the total cost of subscriptions for a user/service
 // within a specific date range (inclusive).
 //
 // Returns:
-//   - Total cost (sum of prices) in rubles
+//   - Total cost (sum of prices) in rubles, 0 if no subscription matches
 func (s *SubscriptionRepo) GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
-	query, params, err := sq.Select("SUM(price) AS total").From("subscriptions").
+	query, params, err := sq.Select("COALESCE(SUM(price), 0) AS total").From("subscriptions").
 		Where("user_id = ?", userID).
 		Where("service_name = ?", serviceName).
 		Where("start_date >= ?", start).
@@ -227,7 +388,9 @@ func (s *SubscriptionRepo) GetCost(ctx context.Context, userID uuid.UUID, servic
 	}
 
 	var totalcost int
-	err = s.pool.QueryRow(ctx, query, params...).Scan(&totalcost)
+	err = s.db.read(ctx, []string{userKey(userID)}, func(pool *pgxpool.Pool) error {
+		return pool.QueryRow(ctx, query, params...).Scan(&totalcost)
+	})
 	if err != nil {
 		return 0, fmt.Errorf("error getting total: %w", err)
 	}
@@ -235,38 +398,405 @@ func (s *SubscriptionRepo) GetCost(ctx context.Context, userID uuid.UUID, servic
 }
 
 // (Soft) Delete marks a subscription as deleted
-//	by setting 'deleted' flag to true (does not permanently remove)
-func (s *SubscriptionRepo) Delete(ctx context.Context, id uint64) error {
-	query, params, err := sq.Update("subscriptions").Set("deleted", true).Where("id = ?", id).PlaceholderFormat(sq.Dollar).ToSql()
+//
+//	by setting 'deleted' flag to true (does not permanently remove),
+//	recording when and by which actor (taken from ctx) it was deleted
+//
+// Returns:
+//   - false if the subscription was already deleted (it is left unchanged)
+//   - ErrSubscriptionNotFound if the subscription doesn't exist
+func (s *SubscriptionRepo) Delete(ctx context.Context, id uint64) (bool, error) {
+	query, params, err := sq.Update("subscriptions").
+		Set("deleted", true).
+		Set("deleted_at", sq.Expr("NOW()")).
+		Set("deleted_by", actor.FromContext(ctx).String()).
+		Set("version", sq.Expr("version + 1")).
+		Where("id = ?", id).
+		Suffix("RETURNING " + strings.Join(columns, ", ")).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var deleted models.Subscription
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		before, err := lockSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.Deleted {
+			return nil
+		}
+		if err := scanSubscription(tx.QueryRow(ctx, query, params...), &deleted); err != nil {
+			return fmt.Errorf("error deleting subscription: %w", err)
+		}
+		return audit(ctx, tx, models.AuditDelete, &before, &deleted)
+	})
+	if err != nil || deleted.ID == 0 {
+		return false, err
+	}
+	s.db.wrote(userKey(deleted.UserID), idKey(id))
+	return true, nil
+}
+
+// GetDeletedByUserID returns the user's soft-deleted subscriptions, most recently deleted first
+func (s *SubscriptionRepo) GetDeletedByUserID(ctx context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+	query, params, err := sq.Select(columns...).From("subscriptions").Where("user_id = ?", userID).Where("deleted = true").OrderBy("deleted_at DESC", "id DESC").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var subscriptions []models.DeletedSubscriptionResponse
+	err = s.db.read(ctx, []string{userKey(userID)}, func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(ctx, query, params...)
+		if err != nil {
+			return fmt.Errorf("error getting subscriptions: %w", err)
+		}
+		defer rows.Close()
+
+		subscriptions = nil
+		for rows.Next() {
+			var sub models.Subscription
+			if err := scanSubscription(rows, &sub); err != nil {
+				return fmt.Errorf("error scanning subscription: %w", err)
+			}
+			subscriptions = append(subscriptions, models.NewDeletedSubscriptionResponse(sub))
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// Restore un-deletes a soft-deleted subscription after checking it does not overlap
+// a current subscription of the same user/service.
+//
+// Returns:
+//   - false if the subscription was not deleted (it is left unchanged)
+//   - ErrSubscriptionNotFound if the subscription doesn't exist
+//   - ErrAlreadyExists if it overlaps a current subscription
+func (s *SubscriptionRepo) Restore(ctx context.Context, id uint64) (bool, error) {
+	query, params, err := sq.Update("subscriptions").
+		Set("deleted", false).
+		Set("deleted_at", nil).
+		Set("deleted_by", nil).
+		Set("version", sq.Expr("version + 1")).
+		Where("id = ?", id).
+		Suffix("RETURNING " + strings.Join(columns, ", ")).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var restored models.Subscription
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		before, err := lockSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !before.Deleted {
+			return nil
+		}
+		if err := overlapCheck(ctx, tx, before); err != nil {
+			return err
+		}
+		if err := scanSubscription(tx.QueryRow(ctx, query, params...), &restored); err != nil {
+			return fmt.Errorf("error restoring subscription: %w", err)
+		}
+		return audit(ctx, tx, models.AuditRestore, &before, &restored)
+	})
+	if err != nil || restored.ID == 0 {
+		return false, err
+	}
+	s.db.wrote(userKey(restored.UserID), idKey(id))
+	return true, nil
+}
+
+// Purge permanently removes a soft-deleted subscription.
+//
+// Returns:
+//   - ErrSubscriptionNotFound if the subscription doesn't exist
+//   - ErrNotDeleted if the subscription is not soft-deleted
+func (s *SubscriptionRepo) Purge(ctx context.Context, id uint64) error {
+	query, params, err := sq.Delete("subscriptions").Where("id = ?", id).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return fmt.Errorf("error creating query: %w", err)
 	}
-	_, err = s.pool.Exec(ctx, query, params...)
+
+	var purged models.Subscription
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		purged, err = lockSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !purged.Deleted {
+			return fmt.Errorf("%w: delete the subscription before purging it", errors.ErrNotDeleted)
+		}
+		if _, err := tx.Exec(ctx, query, params...); err != nil {
+			return fmt.Errorf("error purging subscription: %w", err)
+		}
+		return audit(ctx, tx, models.AuditPurge, &purged, nil)
+	})
 	if err != nil {
-		return fmt.Errorf("error deleting subscription: %w", err)
+		return err
 	}
+	s.db.wrote(userKey(purged.UserID), idKey(id))
 	return nil
 }
 
+// PurgeDeleted permanently removes the subscriptions soft-deleted before the given time
+// (used by the trash retention job) and returns how many were removed
+func (s *SubscriptionRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query, params, err := sq.Delete("subscriptions").Where("deleted = true").Where("deleted_at < ?", before).
+		Suffix("RETURNING " + strings.Join(columns, ", ")).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var purged []models.Subscription
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, params...)
+		if err != nil {
+			return fmt.Errorf("error purging subscriptions: %w", err)
+		}
+		purged, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Subscription, error) {
+			var sub models.Subscription
+			err := scanSubscription(row, &sub)
+			return sub, err
+		})
+		if err != nil {
+			return fmt.Errorf("error purging subscriptions: %w", err)
+		}
+		for i := range purged {
+			if err := audit(ctx, tx, models.AuditPurge, &purged[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(purged)), nil
+}
+
+// GetHistory returns the audit log of a subscription, oldest first.
+//
+// Returns:
+//   - ErrSubscriptionNotFound if the subscription has no audit event and doesn't exist
+func (s *SubscriptionRepo) GetHistory(ctx context.Context, id uint64) ([]models.AuditEvent, error) {
+	query, params, err := sq.Select(auditColumns...).From("subscription_audit").Where("subscription_id = ?", id).OrderBy("id").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error creating query: %w", err)
+	}
+	existsQuery, existsParams, err := sq.Select("COUNT(*)").From("subscriptions").Where("id = ?", id).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var events []models.AuditEvent
+	err = s.db.read(ctx, []string{idKey(id)}, func(pool *pgxpool.Pool) error {
+		var err error
+		if events, err = queryAuditEvents(ctx, pool, query, params); err != nil || len(events) > 0 {
+			return err
+		}
+		// Subscriptions created before the audit log have no event
+		var count int
+		if err := pool.QueryRow(ctx, existsQuery, existsParams...).Scan(&count); err != nil {
+			return fmt.Errorf("error getting subscription: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// SearchHistory returns the audit events matching filter, newest first
+func (s *SubscriptionRepo) SearchHistory(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	q := sq.Select(auditColumns...).From("subscription_audit").OrderBy("id DESC").PlaceholderFormat(sq.Dollar)
+	if filter.SubscriptionID != 0 {
+		q = q.Where("subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.UserID != uuid.Nil {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Actor != "" {
+		q = q.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		q = q.Where("action = ?", string(filter.Action))
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(uint64(filter.Limit))
+	}
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var keys []string
+	if filter.UserID != uuid.Nil {
+		keys = append(keys, userKey(filter.UserID))
+	}
+	if filter.SubscriptionID != 0 {
+		keys = append(keys, idKey(filter.SubscriptionID))
+	}
+	var events []models.AuditEvent
+	err = s.db.read(ctx, keys, func(pool *pgxpool.Pool) error {
+		var err error
+		events, err = queryAuditEvents(ctx, pool, query, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// auditColumns are the subscription_audit columns, in the order read by queryAuditEvents
+var auditColumns = []string{"id", "subscription_id", "user_id", "action", "actor", "request_id", "before", "after", "created_at"}
+
+// queryAuditEvents runs a query selecting auditColumns and returns the events read
+func queryAuditEvents(ctx context.Context, pool *pgxpool.Pool, query string, params []any) ([]models.AuditEvent, error) {
+	rows, err := pool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting audit events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.AuditEvent, error) {
+		var event models.AuditEvent
+		err := row.Scan(&event.ID, &event.SubscriptionID, &event.UserID, &event.Action, &event.Actor, &event.RequestID, &event.Before, &event.After, &event.CreatedAt)
+		return event, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning audit event: %w", err)
+	}
+	return events, nil
+}
+
+// audit records the change of a subscription from before to after in the audit log, in the
+// transaction making it, with the actor and request ID of ctx
+func audit(ctx context.Context, tx pgx.Tx, action models.AuditAction, before, after *models.Subscription) error {
+	event := models.NewAuditEvent(action, actor.FromContext(ctx).String(), logging.RequestIDFromContext(ctx), before, after)
+	beforeJSON, err := snapshotJSON(event.Before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshotJSON(event.After)
+	if err != nil {
+		return err
+	}
+
+	query, params, err := sq.Insert("subscription_audit").
+		Columns("subscription_id", "user_id", "action", "actor", "request_id", "before", "after").
+		Values(event.SubscriptionID, event.UserID, string(event.Action), event.Actor, event.RequestID, beforeJSON, afterJSON).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("error creating query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, params...); err != nil {
+		return fmt.Errorf("error recording audit event: %w", err)
+	}
+	return nil
+}
+
+// parseRequest converts a creation request to a subscription, parsing and checking its dates; the
+// end date defaults to one month after the start
+func parseRequest(sub *models.SubscriptionRequest) (models.Subscription, error) {
+	startDate, err := utils.ParseMonthYear(sub.StartDate)
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: invalid start date", errors.ErrInvalidInput)
+	}
+	endDate := startDate.AddDate(0, 1, 0)
+
+	if sub.EndDate != "" {
+		endDate, err = utils.ParseMonthYear(sub.EndDate)
+		if err != nil {
+			return models.Subscription{}, fmt.Errorf("%w: invalid end date", errors.ErrInvalidInput)
+		}
+		if endDate.Before(startDate) {
+			return models.Subscription{}, fmt.Errorf("%w: end date must be after start date", errors.ErrInvalidInput)
+		}
+	}
+	return models.RequestToSubscription(*sub, startDate, endDate), nil
+}
+
+// snapshotJSON encodes a snapshot for a JSONB column, nil being NULL
+func snapshotJSON(snapshot *models.AuditSnapshot) ([]byte, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding audit snapshot: %w", err)
+	}
+	return b, nil
+}
+
+// lockSubscription reads a subscription, deleted or not, and locks its row until tx ends
+//
+// Returns:
+//   - ErrSubscriptionNotFound if the subscription doesn't exist
+func lockSubscription(ctx context.Context, tx pgx.Tx, id uint64) (models.Subscription, error) {
+	query, params, err := sq.Select(columns...).From("subscriptions").Where("id = ?", id).Suffix("FOR UPDATE").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var sub models.Subscription
+	err = scanSubscription(tx.QueryRow(ctx, query, params...), &sub)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return models.Subscription{}, fmt.Errorf("%w: subscription not found", errors.ErrSubscriptionNotFound)
+		}
+		return models.Subscription{}, fmt.Errorf("error getting subscription: %w", err)
+	}
+	return sub, nil
+}
+
 // OverlapCheck verifies no existing subscription for the same user/service
-// overlaps with the proposed date range.
+// overlaps with the proposed date range. Soft-deleted subscriptions and the
+// subscription itself (when sub.ID is set) are ignored.
 //
 // Returns:
 //   - ErrAlreadyExists if an overlap is detected
 func (s *SubscriptionRepo) OverlapCheck(ctx context.Context, sub models.Subscription) error {
+	return overlapCheck(ctx, s.pool, sub)
+}
+
+// querier runs queries on the pool or within a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// overlapCheck is OverlapCheck, run by q
+func overlapCheck(ctx context.Context, q querier, sub models.Subscription) error {
 	query, params, err := sq.Select("COUNT(*)").
 		From("subscriptions").
 		Where("user_id = ?", sub.UserID).
 		Where("service_name = ?", sub.ServiceName).
 		Where("end_date > ?", sub.StartDate).
 		Where("start_date < ?", sub.EndDate).
+		Where("deleted = false").
+		Where("id <> ?", sub.ID).
 		PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return fmt.Errorf("error creating query: %w", err)
 	}
 
 	var count int
-	err = s.pool.QueryRow(ctx, query, params...).Scan(&count)
+	err = q.QueryRow(ctx, query, params...).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("error checking overlap: %w", err)
 	}
@@ -277,3 +807,23 @@ func (s *SubscriptionRepo) OverlapCheck(ctx context.Context, sub models.Subscrip
 
 	return nil
 }
+
+// Stats returns aggregate figures over all subscriptions (used for business metrics).
+// A subscription is active when it is not deleted and its end date is in the future.
+func (s *SubscriptionRepo) Stats(ctx context.Context) (models.SubscriptionStats, error) {
+	query, params, err := sq.Select(
+		"COUNT(*) FILTER (WHERE deleted = false AND end_date > NOW())",
+		"COALESCE(SUM(price) FILTER (WHERE deleted = false AND end_date > NOW()), 0)",
+		"COUNT(*) FILTER (WHERE deleted = true)",
+	).From("subscriptions").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return models.SubscriptionStats{}, fmt.Errorf("error creating query: %w", err)
+	}
+
+	var stats models.SubscriptionStats
+	err = s.pool.QueryRow(ctx, query, params...).Scan(&stats.Active, &stats.ActivePriceSum, &stats.Deleted)
+	if err != nil {
+		return models.SubscriptionStats{}, fmt.Errorf("error getting stats: %w", err)
+	}
+	return stats, nil
+}
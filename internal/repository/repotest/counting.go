@@ -0,0 +1,54 @@
+package repotest
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Counting wraps a repository and counts the reads reaching it, for tests of the layers that
+// batch or cache them
+type Counting struct {
+	repository.SubscriptionRepository
+	ByID, ByUser, ByUsers, Cost atomic.Int32
+	Gate                        chan struct{} // if set, reads wait for it to be closed
+}
+
+// NewCounting returns a Counting wrapping next
+func NewCounting(next repository.SubscriptionRepository) *Counting {
+	return &Counting{SubscriptionRepository: next}
+}
+
+func (c *Counting) wait() {
+	if c.Gate != nil {
+		<-c.Gate
+	}
+}
+
+func (c *Counting) GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error) {
+	c.ByID.Add(1)
+	c.wait()
+	return c.SubscriptionRepository.GetByID(ctx, id)
+}
+
+func (c *Counting) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	c.ByUser.Add(1)
+	c.wait()
+	return c.SubscriptionRepository.GetByUserID(ctx, userID)
+}
+
+func (c *Counting) GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	c.ByUsers.Add(1)
+	c.wait()
+	return c.SubscriptionRepository.GetByUserIDs(ctx, userIDs)
+}
+
+func (c *Counting) GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
+	c.Cost.Add(1)
+	c.wait()
+	return c.SubscriptionRepository.GetCost(ctx, userID, serviceName, start, end)
+}
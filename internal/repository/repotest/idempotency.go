@@ -0,0 +1,139 @@
+package repotest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+)
+
+// IdempotencyFactory returns an empty idempotency repository for one subtest
+type IdempotencyFactory func(t *testing.T) repository.IdempotencyRepository
+
+// RunIdempotency runs the contract suite of repository.IdempotencyRepository: reservations, replays
+// of completed requests, releases and expiry
+func RunIdempotency(t *testing.T, newRepo IdempotencyFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.IdempotencyRepository)
+	}{
+		{"ReserveAndComplete", testReserveAndComplete},
+		{"ReserveExpired", testReserveExpired},
+		{"Release", testRelease},
+		{"CompleteOtherRequest", testCompleteOtherRequest},
+		{"DeleteExpired", testDeleteExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func reserve(t *testing.T, repo repository.IdempotencyRepository, key, hash string, expiresAt time.Time) (models.IdempotencyRecord, bool) {
+	t.Helper()
+	record, reserved, err := repo.Reserve(context.Background(), key, hash, expiresAt)
+	if err != nil {
+		t.Fatalf("Reserve(%s): %v", key, err)
+	}
+	return record, reserved
+}
+
+func testReserveAndComplete(t *testing.T, repo repository.IdempotencyRepository) {
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+
+	if _, reserved := reserve(t, repo, "key-1", "hash-1", later); !reserved {
+		t.Fatal("first Reserve did not reserve the key")
+	}
+	record, reserved := reserve(t, repo, "key-1", "hash-2", later)
+	if reserved || record.Status != 0 || record.RequestHash != "hash-1" {
+		t.Fatalf("Reserve while in flight = %+v, %v; want the in-flight record of hash-1", record, reserved)
+	}
+
+	completed := models.IdempotencyRecord{
+		Key:         "key-1",
+		RequestHash: "hash-1",
+		Status:      http.StatusCreated,
+		Header:      http.Header{"Content-Type": {"application/json"}},
+		Body:        []byte(`{"id":1}`),
+		ExpiresAt:   later.Add(time.Hour),
+	}
+	if err := repo.Complete(ctx, completed); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	record, reserved = reserve(t, repo, "key-1", "hash-1", later)
+	if reserved {
+		t.Fatal("Reserve after Complete reserved the key again")
+	}
+	if record.Status != http.StatusCreated || record.Header.Get("Content-Type") != "application/json" || string(record.Body) != `{"id":1}` {
+		t.Errorf("Reserve after Complete = %+v, want the stored response", record)
+	}
+
+	if _, reserved := reserve(t, repo, "key-2", "hash-1", later); !reserved {
+		t.Error("Reserve of another key did not reserve it")
+	}
+}
+
+func testReserveExpired(t *testing.T, repo repository.IdempotencyRepository) {
+	reserve(t, repo, "key-1", "hash-1", time.Now().Add(-time.Hour))
+
+	record, reserved := reserve(t, repo, "key-1", "hash-2", time.Now().Add(time.Hour))
+	if !reserved || record.RequestHash != "hash-2" {
+		t.Errorf("Reserve of an expired key = %+v, %v; want it reserved for hash-2", record, reserved)
+	}
+}
+
+func testRelease(t *testing.T, repo repository.IdempotencyRepository) {
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+	reserve(t, repo, "key-1", "hash-1", later)
+
+	if err := repo.Release(ctx, "key-1", "hash-2"); err != nil {
+		t.Fatalf("Release(other request): %v", err)
+	}
+	if _, reserved := reserve(t, repo, "key-1", "hash-1", later); reserved {
+		t.Fatal("Release of another request freed the key")
+	}
+
+	if err := repo.Release(ctx, "key-1", "hash-1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, reserved := reserve(t, repo, "key-1", "hash-1", later); !reserved {
+		t.Error("Reserve after Release did not reserve the key")
+	}
+}
+
+func testCompleteOtherRequest(t *testing.T, repo repository.IdempotencyRepository) {
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+	reserve(t, repo, "key-1", "hash-1", later)
+
+	err := repo.Complete(ctx, models.IdempotencyRecord{Key: "key-1", RequestHash: "hash-2", Status: http.StatusOK, ExpiresAt: later})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if record, _ := reserve(t, repo, "key-1", "hash-1", later); record.Status != 0 {
+		t.Errorf("Complete of another request stored status %d", record.Status)
+	}
+}
+
+func testDeleteExpired(t *testing.T, repo repository.IdempotencyRepository) {
+	now := time.Now()
+	reserve(t, repo, "expired", "hash-1", now.Add(-time.Hour))
+	reserve(t, repo, "current", "hash-1", now.Add(time.Hour))
+
+	removed, err := repo.DeleteExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("DeleteExpired removed %d records, want 1", removed)
+	}
+	if _, reserved := reserve(t, repo, "current", "hash-1", now.Add(time.Hour)); reserved {
+		t.Error("DeleteExpired removed an unexpired record")
+	}
+}
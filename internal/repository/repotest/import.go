@@ -0,0 +1,139 @@
+package repotest
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+)
+
+// importRows imports the requests as the rows of a file, from line 2 as after a CSV header, and
+// fails the test on error
+func importRows(t *testing.T, repo repository.SubscriptionRepository, opts models.ImportOptions, reqs ...models.SubscriptionRequest) []models.ImportOutcome {
+	t.Helper()
+	rows := make([]models.ImportRow, len(reqs))
+	for i, req := range reqs {
+		rows[i] = models.ImportRow{Line: i + 2, Request: req}
+	}
+	outcomes, err := repo.Import(context.Background(), rows, opts)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(outcomes) != len(rows) {
+		t.Fatalf("Import returned %d outcomes for %d rows", len(outcomes), len(rows))
+	}
+	return outcomes
+}
+
+// aliceSubscriptions returns the IDs of the current subscriptions of alice
+func aliceSubscriptions(t *testing.T, repo repository.SubscriptionRepository) []uint64 {
+	t.Helper()
+	subs, err := repo.GetByUserID(context.Background(), alice)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	return responseIDs(subs)
+}
+
+func testImport(t *testing.T, repo repository.SubscriptionRepository) {
+	inserted := importRows(t, repo, models.ImportOptions{Mode: models.ImportAllOrNothing},
+		request(alice, "Yandex Plus", 400, "01-2025", "03-2025"),
+		request(alice, "Kinopoisk", 299, "01-2025", ""),
+	)
+	copied := importRows(t, repo, models.ImportOptions{Mode: models.ImportAllOrNothing, Copy: true},
+		request(alice, "Yandex Plus", 400, "01-2026", "03-2026"),
+		request(alice, "Kinopoisk", 299, "01-2026", ""),
+	)
+
+	for i, outcome := range append(inserted, copied...) {
+		if outcome.Err != nil || outcome.ID == 0 {
+			t.Fatalf("Import row %d = %+v, want a created subscription", i, outcome)
+		}
+		got, err := repo.GetByID(context.Background(), outcome.ID)
+		if err != nil {
+			t.Fatalf("GetByID(%d): %v", outcome.ID, err)
+		}
+		if got.UserID != alice || got.Version != 1 {
+			t.Errorf("imported subscription = %+v", got)
+		}
+		if events := history(t, repo, outcome.ID); len(events) != 1 || events[0].Action != models.AuditCreate || events[0].After == nil {
+			t.Errorf("history of imported subscription %d = %v, want one create", outcome.ID, actions(events))
+		}
+	}
+	if got, err := repo.GetByID(context.Background(), copied[1].ID); err != nil || got.EndDate != "02-2026" {
+		t.Errorf("copied subscription without end date = %+v, %v; want it to end in 02-2026", got, err)
+	}
+	if got := aliceSubscriptions(t, repo); len(got) != 4 {
+		t.Errorf("alice has %d subscriptions after two imports, want 4", len(got))
+	}
+}
+
+func testImportOverlapInFile(t *testing.T, repo repository.SubscriptionRepository) {
+	outcomes := importRows(t, repo, models.ImportOptions{Mode: models.ImportBestEffort},
+		request(alice, "Yandex Plus", 400, "01-2025", "06-2025"),
+		request(alice, "Yandex Plus", 400, "03-2025", "04-2025"), // overlaps line 2
+		request(bob, "Yandex Plus", 400, "03-2025", "04-2025"),
+		request(alice, "Yandex Plus", 400, "06-2025", "07-2025"), // starts as line 2 ends
+	)
+	if outcomes[0].ID == 0 || outcomes[2].ID == 0 || outcomes[3].ID == 0 {
+		t.Errorf("Import = %+v, want rows 1, 3 and 4 created", outcomes)
+	}
+	if !stderrors.Is(outcomes[1].Err, errors.ErrAlreadyExists) || outcomes[1].ID != 0 {
+		t.Errorf("overlapping row = %+v, want ErrAlreadyExists", outcomes[1])
+	}
+}
+
+func testImportOverlapExisting(t *testing.T, repo repository.SubscriptionRepository) {
+	create(t, repo, request(alice, "Yandex Plus", 400, "01-2025", "06-2025"))
+	deleted := create(t, repo, request(alice, "Kinopoisk", 299, "01-2025", "06-2025"))
+	if _, err := repo.Delete(context.Background(), deleted); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	outcomes := importRows(t, repo, models.ImportOptions{Mode: models.ImportBestEffort},
+		request(alice, "Yandex Plus", 400, "05-2025", ""),
+		request(alice, "Kinopoisk", 299, "03-2025", ""), // a deleted subscription does not overlap
+		request(alice, "Okko", 199, "13-2025", ""),
+	)
+	if !stderrors.Is(outcomes[0].Err, errors.ErrAlreadyExists) {
+		t.Errorf("row overlapping an existing subscription = %+v, want ErrAlreadyExists", outcomes[0])
+	}
+	if outcomes[1].Err != nil || outcomes[1].ID == 0 {
+		t.Errorf("row overlapping a deleted subscription = %+v, want it created", outcomes[1])
+	}
+	if !stderrors.Is(outcomes[2].Err, errors.ErrInvalidInput) {
+		t.Errorf("row with an invalid date = %+v, want ErrInvalidInput", outcomes[2])
+	}
+}
+
+func testImportAllOrNothing(t *testing.T, repo repository.SubscriptionRepository) {
+	outcomes := importRows(t, repo, models.ImportOptions{Mode: models.ImportAllOrNothing},
+		request(alice, "Yandex Plus", 400, "01-2025", ""),
+		request(alice, "Yandex Plus", 400, "01-2025", ""),
+	)
+	if outcomes[0].Err != nil || outcomes[0].ID != 0 {
+		t.Errorf("valid row = %+v, want it not created", outcomes[0])
+	}
+	if !stderrors.Is(outcomes[1].Err, errors.ErrAlreadyExists) {
+		t.Errorf("overlapping row = %+v, want ErrAlreadyExists", outcomes[1])
+	}
+	if got := aliceSubscriptions(t, repo); len(got) != 0 {
+		t.Errorf("a failed all-or-nothing import created %v", got)
+	}
+}
+
+func testImportDryRun(t *testing.T, repo repository.SubscriptionRepository) {
+	outcomes := importRows(t, repo, models.ImportOptions{Mode: models.ImportBestEffort, DryRun: true},
+		request(alice, "Yandex Plus", 400, "01-2025", ""),
+		request(alice, "Yandex Plus", 400, "01-2025", ""),
+	)
+	if outcomes[0].Err != nil || outcomes[0].ID != 0 || !stderrors.Is(outcomes[1].Err, errors.ErrAlreadyExists) {
+		t.Errorf("Import(dry run) = %+v, want the first row valid and the second overlapping", outcomes)
+	}
+	if got := aliceSubscriptions(t, repo); len(got) != 0 {
+		t.Errorf("a dry run created %v", got)
+	}
+}
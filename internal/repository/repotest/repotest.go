@@ -0,0 +1,863 @@
+// Package repotest is a contract test suite for repository.SubscriptionRepository implementations.
+//
+// Run checks the documented behavior every implementation must share:
+//   - "MM-YYYY" date validation and end dates defaulting to one month after the start
+//   - rejection of overlapping subscriptions of the same user and service
+//   - soft deletes hiding rows from GetByID, GetByUserID and GetByUserIDs but not from GetAll
+//   - merge patch updates guarded by versions that every write bumps
+//   - the audit log: one event per change with its actor, request ID and snapshots, kept after purges
+//   - the trash: listing, restoring (unless it overlaps) and purging soft-deleted rows
+//   - renewal date math (start at the end of an active subscription, or now, same duration)
+//   - cost sums over the subscriptions within a date range
+//   - imports: per-row outcomes, overlaps within the file and with stored rows, all-or-nothing
+//     and best-effort modes, dry runs and COPY
+//
+// Each subtest gets a fresh, empty repository from the Factory. RunIdempotency does the same for
+// repository.IdempotencyRepository implementations.
+//
+// Counting is a shared fake for the tests of layers above a repository, counting the reads reaching it.
+package repotest
+
+import (
+	"context"
+	stderrors "errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/actor"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Factory returns an empty repository for one subtest. It registers its own cleanup with t.
+type Factory func(t *testing.T) repository.SubscriptionRepository
+
+// Run runs the contract suite against the repositories returned by newRepo
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.SubscriptionRepository)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"CreateDefaultEndDate", testCreateDefaultEndDate},
+		{"CreateInvalidDates", testCreateInvalidDates},
+		{"Overlap", testOverlap},
+		{"SoftDelete", testSoftDelete},
+		{"DeleteTwice", testDeleteTwice},
+		{"DeleteNotFound", testDeleteNotFound},
+		{"Update", testUpdate},
+		{"UpdateVersionMismatch", testUpdateVersionMismatch},
+		{"UpdateOverlap", testUpdateOverlap},
+		{"UpdateEndDateReset", testUpdateEndDateReset},
+		{"UpdateDeleted", testUpdateDeleted},
+		{"Trash", testTrash},
+		{"Restore", testRestore},
+		{"RestoreOverlap", testRestoreOverlap},
+		{"RestoreNotFound", testRestoreNotFound},
+		{"Purge", testPurge},
+		{"OverlapIgnoresDeleted", testOverlapIgnoresDeleted},
+		{"PurgeDeleted", testPurgeDeleted},
+		{"History", testHistory},
+		{"HistoryRenew", testHistoryRenew},
+		{"HistoryPurge", testHistoryPurge},
+		{"HistoryNotFound", testHistoryNotFound},
+		{"SearchHistory", testSearchHistory},
+		{"GetByUserIDs", testGetByUserIDs},
+		{"RenewActive", testRenewActive},
+		{"RenewExpired", testRenewExpired},
+		{"RenewNotFound", testRenewNotFound},
+		{"Cost", testCost},
+		{"Import", testImport},
+		{"ImportOverlapInFile", testImportOverlapInFile},
+		{"ImportOverlapExisting", testImportOverlapExisting},
+		{"ImportAllOrNothing", testImportAllOrNothing},
+		{"ImportDryRun", testImportDryRun},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+var (
+	alice = uuid.MustParse("0b6f2a4e-1c3d-4e5f-8a9b-0c1d2e3f4a5b")
+	bob   = uuid.MustParse("9a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d")
+)
+
+// create stores the subscription described by req and fails the test on error
+func create(t *testing.T, repo repository.SubscriptionRepository, req models.SubscriptionRequest) uint64 {
+	t.Helper()
+	id, err := repo.Create(context.Background(), &req)
+	if err != nil {
+		t.Fatalf("Create(%+v): %v", req, err)
+	}
+	return id
+}
+
+func request(user uuid.UUID, service string, price int, start, end string) models.SubscriptionRequest {
+	return models.SubscriptionRequest{ServiceName: service, Price: price, UserID: user, StartDate: start, EndDate: end}
+}
+
+func testCreateAndGet(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", "12-2025"))
+
+	got, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	want := models.SubscriptionResponse{ID: id, ServiceName: "Yandex Plus", Price: 400, UserID: alice, StartDate: "07-2025", EndDate: "12-2025"}
+	if got.ID != want.ID || got.ServiceName != want.ServiceName || got.Price != want.Price ||
+		got.UserID != want.UserID || got.StartDate != want.StartDate || got.EndDate != want.EndDate {
+		t.Errorf("GetByID = %+v, want %+v", got, want)
+	}
+	if !got.StartTime.Equal(date(2025, time.July)) || !got.EndTime.Equal(date(2025, time.December)) {
+		t.Errorf("GetByID times = %s..%s, want 2025-07-01..2025-12-01", got.StartTime, got.EndTime)
+	}
+
+	other := create(t, repo, request(alice, "Kinopoisk", 299, "07-2025", ""))
+	if other == id {
+		t.Errorf("Create returned the same ID %d twice", id)
+	}
+
+	if _, err := repo.GetByID(ctx, other+100); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("GetByID(unknown) error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testCreateDefaultEndDate(t *testing.T, repo repository.SubscriptionRepository) {
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "12-2025", ""))
+	got, err := repo.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.EndDate != "01-2026" {
+		t.Errorf("EndDate = %q, want one month after the start (01-2026)", got.EndDate)
+	}
+}
+
+func testCreateInvalidDates(t *testing.T, repo repository.SubscriptionRepository) {
+	tests := []struct {
+		name       string
+		start, end string
+	}{
+		{"empty start", "", ""},
+		{"ISO start", "2025-07", ""},
+		{"month 13", "13-2025", ""},
+		{"full date", "01-07-2025", ""},
+		{"invalid end", "07-2025", "2025-12"},
+		{"end before start", "07-2025", "06-2025"},
+	}
+	for _, tt := range tests {
+		req := request(alice, "Yandex Plus", 400, tt.start, tt.end)
+		if _, err := repo.Create(context.Background(), &req); !stderrors.Is(err, errors.ErrInvalidInput) {
+			t.Errorf("%s: Create error = %v, want ErrInvalidInput", tt.name, err)
+		}
+	}
+
+	all, err := repo.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("invalid requests stored %d subscriptions", len(all))
+	}
+}
+
+func testOverlap(t *testing.T, repo repository.SubscriptionRepository) {
+	create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+
+	overlapping := []models.SubscriptionRequest{
+		request(alice, "Yandex Plus", 400, "03-2025", "06-2025"), // same range
+		request(alice, "Yandex Plus", 400, "05-2025", "08-2025"), // starts before the end
+		request(alice, "Yandex Plus", 400, "01-2025", "04-2025"), // ends after the start
+		request(alice, "Yandex Plus", 400, "04-2025", ""),        // inside
+		request(alice, "Yandex Plus", 400, "01-2025", "12-2025"), // around
+	}
+	for _, req := range overlapping {
+		if _, err := repo.Create(context.Background(), &req); !stderrors.Is(err, errors.ErrAlreadyExists) {
+			t.Errorf("Create(%s..%s) error = %v, want ErrAlreadyExists", req.StartDate, req.EndDate, err)
+		}
+	}
+
+	// Adjacent ranges, other services and other users do not overlap
+	create(t, repo, request(alice, "Yandex Plus", 400, "06-2025", "07-2025"))
+	create(t, repo, request(alice, "Yandex Plus", 400, "02-2025", "03-2025"))
+	create(t, repo, request(alice, "Kinopoisk", 299, "03-2025", "06-2025"))
+	create(t, repo, request(bob, "Yandex Plus", 400, "03-2025", "06-2025"))
+
+	sub := models.Subscription{ServiceName: "Yandex Plus", UserID: alice, StartDate: date(2025, time.April), EndDate: date(2025, time.May)}
+	if err := repo.OverlapCheck(context.Background(), sub); !stderrors.Is(err, errors.ErrAlreadyExists) {
+		t.Errorf("OverlapCheck error = %v, want ErrAlreadyExists", err)
+	}
+	sub.StartDate, sub.EndDate = date(2025, time.August), date(2025, time.September)
+	if err := repo.OverlapCheck(context.Background(), sub); err != nil {
+		t.Errorf("OverlapCheck(free range) error = %v", err)
+	}
+}
+
+func testSoftDelete(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	kept := create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", ""))
+	deleted := create(t, repo, request(alice, "Kinopoisk", 299, "07-2025", ""))
+
+	if ok, err := repo.Delete(actor.With(ctx, actor.APIKey), deleted); err != nil || !ok {
+		t.Fatalf("Delete = %v, %v; want true", ok, err)
+	}
+
+	if _, err := repo.GetByID(ctx, deleted); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("GetByID(deleted) error = %v, want ErrSubscriptionNotFound", err)
+	}
+	if _, err := repo.GetByID(ctx, kept); err != nil {
+		t.Errorf("GetByID(kept): %v", err)
+	}
+
+	subs, err := repo.GetByUserID(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if ids := responseIDs(subs); !slices.Equal(ids, []uint64{kept}) {
+		t.Errorf("GetByUserID IDs = %v, want only %d", ids, kept)
+	}
+
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	found := map[uint64]bool{}
+	for _, sub := range all {
+		found[sub.ID] = sub.Deleted
+		switch {
+		case sub.ID == deleted && (sub.DeletedAt == nil || sub.DeletedBy != actor.APIKey.String()):
+			t.Errorf("deleted subscription: deleted_at %v, deleted_by %q; want a time and %q", sub.DeletedAt, sub.DeletedBy, actor.APIKey)
+		case sub.ID == kept && (sub.DeletedAt != nil || sub.DeletedBy != ""):
+			t.Errorf("kept subscription: deleted_at %v, deleted_by %q; want none", sub.DeletedAt, sub.DeletedBy)
+		}
+	}
+	if deletedFlag, ok := found[deleted]; !ok || !deletedFlag {
+		t.Errorf("GetAll must list the deleted subscription %d with deleted=true, got %+v", deleted, all)
+	}
+	if deletedFlag, ok := found[kept]; !ok || deletedFlag {
+		t.Errorf("GetAll must list the kept subscription %d with deleted=false, got %+v", kept, all)
+	}
+}
+
+func testDeleteTwice(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", ""))
+
+	if ok, err := repo.Delete(ctx, id); err != nil || !ok {
+		t.Fatalf("first Delete = %v, %v; want true", ok, err)
+	}
+	before := deletedAt(t, repo, id)
+	if ok, err := repo.Delete(actor.With(ctx, actor.APIKey), id); err != nil || ok {
+		t.Fatalf("second Delete = %v, %v; want false", ok, err)
+	}
+
+	// The second call leaves the first deletion untouched
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	for _, sub := range all {
+		if sub.ID == id && (sub.DeletedBy != actor.User.String() || !sub.DeletedAt.Equal(before)) {
+			t.Errorf("after the second Delete: deleted_by %q, deleted_at %v; want %q, %v", sub.DeletedBy, sub.DeletedAt, actor.User, before)
+		}
+	}
+}
+
+func testDeleteNotFound(t *testing.T, repo repository.SubscriptionRepository) {
+	if _, err := repo.Delete(context.Background(), 999); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("Delete(999) error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	sub, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if sub.Version != 1 {
+		t.Errorf("new subscription version = %d, want 1", sub.Version)
+	}
+
+	price, end := 450, "09-2025"
+	updated, err := repo.Update(ctx, id, sub.Version, models.SubscriptionPatch{Price: &price, EndDate: &end})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.Version != 2 || updated.Price != 450 || updated.ServiceName != "Yandex Plus" ||
+		updated.StartDate != "03-2025" || updated.EndDate != "09-2025" {
+		t.Errorf("Update = %+v; want the price and end date changed at version 2", updated)
+	}
+	if got, err := repo.GetByID(ctx, id); err != nil || got != updated {
+		t.Errorf("GetByID after Update = %+v, %v; want %+v", got, err, updated)
+	}
+
+	invalid := "03-2026"
+	if _, err := repo.Update(ctx, id, updated.Version, models.SubscriptionPatch{StartDate: &invalid}); !stderrors.Is(err, errors.ErrInvalidInput) {
+		t.Errorf("Update(start after end) error = %v, want ErrInvalidInput", err)
+	}
+}
+
+func testUpdateVersionMismatch(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	price := 450
+
+	if _, err := repo.Update(ctx, id, 1, models.SubscriptionPatch{Price: &price}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := repo.Update(ctx, id, 1, models.SubscriptionPatch{Price: &price}); !stderrors.Is(err, errors.ErrVersionMismatch) {
+		t.Errorf("Update(stale version) error = %v, want ErrVersionMismatch", err)
+	}
+
+	// Deleting and restoring are changes too
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.Restore(ctx, id); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := repo.Update(ctx, id, 2, models.SubscriptionPatch{Price: &price}); !stderrors.Is(err, errors.ErrVersionMismatch) {
+		t.Errorf("Update(version before a delete and restore) error = %v, want ErrVersionMismatch", err)
+	}
+	if sub, err := repo.GetByID(ctx, id); err != nil || sub.Version != 4 {
+		t.Errorf("GetByID = version %d, %v; want 4", sub.Version, err)
+	}
+}
+
+func testUpdateOverlap(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	create(t, repo, request(alice, "Yandex Plus", 400, "08-2025", "10-2025"))
+
+	// Moving within its own range does not overlap with itself
+	start := "04-2025"
+	updated, err := repo.Update(ctx, id, 1, models.SubscriptionPatch{StartDate: &start})
+	if err != nil {
+		t.Fatalf("Update(within own range): %v", err)
+	}
+
+	end := "09-2025"
+	if _, err := repo.Update(ctx, id, updated.Version, models.SubscriptionPatch{EndDate: &end}); !stderrors.Is(err, errors.ErrAlreadyExists) {
+		t.Errorf("Update(overlapping) error = %v, want ErrAlreadyExists", err)
+	}
+	if sub, err := repo.GetByID(ctx, id); err != nil || sub != updated {
+		t.Errorf("GetByID after a refused update = %+v, %v; want %+v", sub, err, updated)
+	}
+}
+
+func testUpdateEndDateReset(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "12-2025"))
+
+	start, end := "05-2025", ""
+	updated, err := repo.Update(ctx, id, 1, models.SubscriptionPatch{StartDate: &start, EndDate: &end})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.StartDate != "05-2025" || updated.EndDate != "06-2025" {
+		t.Errorf("Update = %s to %s, want the end date reset to one month after the start", updated.StartDate, updated.EndDate)
+	}
+}
+
+func testUpdateDeleted(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	price := 450
+	for _, id := range []uint64{id, 999} {
+		if _, err := repo.Update(ctx, id, 2, models.SubscriptionPatch{Price: &price}); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+			t.Errorf("Update(%d) error = %v, want ErrSubscriptionNotFound", id, err)
+		}
+	}
+}
+
+func testTrash(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", ""))
+	first := create(t, repo, request(alice, "Kinopoisk", 299, "07-2025", ""))
+	second := create(t, repo, request(alice, "Okko", 199, "07-2025", ""))
+	other := create(t, repo, request(bob, "Kinopoisk", 299, "07-2025", ""))
+	for _, id := range []uint64{first, second, other} {
+		if _, err := repo.Delete(ctx, id); err != nil {
+			t.Fatalf("Delete(%d): %v", id, err)
+		}
+	}
+
+	trash, err := repo.GetDeletedByUserID(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetDeletedByUserID: %v", err)
+	}
+	var ids []uint64
+	for _, sub := range trash {
+		ids = append(ids, sub.ID)
+		if sub.DeletedAt.IsZero() {
+			t.Errorf("subscription %d listed without its deletion time", sub.ID)
+		}
+	}
+	// Most recently deleted first; current subscriptions and other users are not listed
+	if !slices.Equal(ids, []uint64{second, first}) {
+		t.Errorf("GetDeletedByUserID IDs = %v, want %v", ids, []uint64{second, first})
+	}
+}
+
+func testRestore(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", ""))
+
+	if ok, err := repo.Restore(ctx, id); err != nil || ok {
+		t.Fatalf("Restore(not deleted) = %v, %v; want false", ok, err)
+	}
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if ok, err := repo.Restore(ctx, id); err != nil || !ok {
+		t.Fatalf("Restore = %v, %v; want true", ok, err)
+	}
+
+	if _, err := repo.GetByID(ctx, id); err != nil {
+		t.Errorf("GetByID(restored): %v", err)
+	}
+	if trash, err := repo.GetDeletedByUserID(ctx, alice); err != nil || len(trash) != 0 {
+		t.Errorf("GetDeletedByUserID = %v, %v; want an empty trash", trash, err)
+	}
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	for _, sub := range all {
+		if sub.ID == id && (sub.Deleted || sub.DeletedAt != nil || sub.DeletedBy != "") {
+			t.Errorf("restored subscription: deleted %v, deleted_at %v, deleted_by %q; want none", sub.Deleted, sub.DeletedAt, sub.DeletedBy)
+		}
+	}
+}
+
+func testRestoreOverlap(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	deleted := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	if _, err := repo.Delete(ctx, deleted); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// The range of the deleted subscription is free again
+	create(t, repo, request(alice, "Yandex Plus", 400, "05-2025", "08-2025"))
+
+	if _, err := repo.Restore(ctx, deleted); !stderrors.Is(err, errors.ErrAlreadyExists) {
+		t.Fatalf("Restore(overlapping) error = %v, want ErrAlreadyExists", err)
+	}
+	if _, err := repo.GetByID(ctx, deleted); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("GetByID after a refused restore error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testRestoreNotFound(t *testing.T, repo repository.SubscriptionRepository) {
+	if _, err := repo.Restore(context.Background(), 999); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("Restore(999) error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testPurge(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", ""))
+
+	if err := repo.Purge(ctx, id); !stderrors.Is(err, errors.ErrNotDeleted) {
+		t.Fatalf("Purge(not deleted) error = %v, want ErrNotDeleted", err)
+	}
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Purge(ctx, id); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("GetAll listed %d subscriptions after the purge, want none", len(all))
+	}
+	if err := repo.Purge(ctx, id); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("Purge(purged) error = %v, want ErrSubscriptionNotFound", err)
+	}
+	if _, err := repo.Restore(ctx, id); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("Restore(purged) error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testOverlapIgnoresDeleted(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+}
+
+// purger is implemented by the storage backends, for the trash retention job
+type purger interface {
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+func testPurgeDeleted(t *testing.T, repo repository.SubscriptionRepository) {
+	p, ok := repo.(purger)
+	if !ok {
+		t.Skip("the repository has no PurgeDeleted")
+	}
+	ctx := context.Background()
+	kept := create(t, repo, request(alice, "Yandex Plus", 400, "07-2025", ""))
+	id := create(t, repo, request(alice, "Kinopoisk", 299, "07-2025", ""))
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	at := deletedAt(t, repo, id)
+
+	if n, err := p.PurgeDeleted(ctx, at); err != nil || n != 0 {
+		t.Errorf("PurgeDeleted(deletion time) = %d, %v; want 0", n, err)
+	}
+	if n, err := p.PurgeDeleted(ctx, at.Add(time.Millisecond)); err != nil || n != 1 {
+		t.Errorf("PurgeDeleted(after the deletion) = %d, %v; want 1", n, err)
+	}
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(all) != 1 || all[0].ID != kept {
+		t.Errorf("GetAll after PurgeDeleted = %+v, want only %d", all, kept)
+	}
+}
+
+// deletedAt returns the deletion time of the subscription, as listed by GetAll
+func deletedAt(t *testing.T, repo repository.SubscriptionRepository, id uint64) time.Time {
+	t.Helper()
+	all, err := repo.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	for _, sub := range all {
+		if sub.ID == id && sub.DeletedAt != nil {
+			return *sub.DeletedAt
+		}
+	}
+	t.Fatalf("subscription %d is not listed as deleted", id)
+	return time.Time{}
+}
+
+// history returns the actions recorded for a subscription, failing the test on error
+func history(t *testing.T, repo repository.SubscriptionRepository, id uint64) []models.AuditEvent {
+	t.Helper()
+	events, err := repo.GetHistory(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetHistory(%d): %v", id, err)
+	}
+	return events
+}
+
+func actions(events []models.AuditEvent) []models.AuditAction {
+	var actions []models.AuditAction
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+func testHistory(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+
+	price := 450
+	if _, err := repo.Update(ctx, id, 1, models.SubscriptionPatch{Price: &price}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := repo.Delete(actor.With(ctx, actor.APIKey), id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// Changes that change nothing are not recorded
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete(deleted): %v", err)
+	}
+	if _, err := repo.Restore(ctx, id); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := repo.Update(ctx, id, 1, models.SubscriptionPatch{Price: &price}); !stderrors.Is(err, errors.ErrVersionMismatch) {
+		t.Fatalf("Update(stale version) error = %v, want ErrVersionMismatch", err)
+	}
+
+	events := history(t, repo, id)
+	want := []models.AuditAction{models.AuditCreate, models.AuditUpdate, models.AuditDelete, models.AuditRestore}
+	if got := actions(events); !slices.Equal(got, want) {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+	for i, event := range events {
+		if event.SubscriptionID != id || event.UserID != alice || event.CreatedAt.IsZero() {
+			t.Errorf("%s event = %+v", event.Action, event)
+		}
+		if i > 0 && event.ID <= events[i-1].ID {
+			t.Errorf("event IDs %d then %d, want increasing", events[i-1].ID, event.ID)
+		}
+	}
+
+	created, updated, deleted, restored := events[0], events[1], events[2], events[3]
+	if created.Before != nil || created.After == nil || created.After.Price != 400 || created.After.Version != 1 ||
+		created.After.StartDate != "2025-03-01" || created.After.EndDate != "2025-06-01" || created.Actor != "user" || created.RequestID != "" {
+		t.Errorf("create event = %+v, after %+v", created, created.After)
+	}
+	if updated.Before == nil || updated.After == nil || updated.Before.Price != 400 || updated.After.Price != 450 ||
+		updated.After.Version != 2 || updated.RequestID != "req-1" {
+		t.Errorf("update event = %+v, before %+v, after %+v", updated, updated.Before, updated.After)
+	}
+	if deleted.Actor != "api_key" || deleted.Before == nil || deleted.Before.Deleted || deleted.After == nil || !deleted.After.Deleted ||
+		deleted.After.DeletedBy != "api_key" || deleted.After.DeletedAt == nil {
+		t.Errorf("delete event = %+v, before %+v, after %+v", deleted, deleted.Before, deleted.After)
+	}
+	if restored.Before == nil || !restored.Before.Deleted || restored.After == nil || restored.After.Deleted || restored.After.Version != 4 {
+		t.Errorf("restore event = %+v, before %+v, after %+v", restored, restored.Before, restored.After)
+	}
+}
+
+func testHistoryRenew(t *testing.T, repo repository.SubscriptionRepository) {
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	newID, err := repo.RenewOrExtend(context.Background(), id)
+	if err != nil {
+		t.Fatalf("RenewOrExtend: %v", err)
+	}
+
+	events := history(t, repo, newID)
+	if got := actions(events); !slices.Equal(got, []models.AuditAction{models.AuditRenew}) {
+		t.Fatalf("history of the renewal = %v, want [renew]", got)
+	}
+	// The renewal records the subscription it renews
+	if renew := events[0]; renew.Before == nil || renew.Before.ID != id || renew.After == nil || renew.After.ID != newID {
+		t.Errorf("renew event = %+v, before %+v, after %+v", renew, renew.Before, renew.After)
+	}
+	if got := actions(history(t, repo, id)); !slices.Equal(got, []models.AuditAction{models.AuditCreate}) {
+		t.Errorf("history of the renewed subscription = %v, want [create]", got)
+	}
+}
+
+func testHistoryPurge(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := actor.With(context.Background(), actor.APIKey)
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	if _, err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Purge(ctx, id); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	// The history outlives the subscription
+	events := history(t, repo, id)
+	want := []models.AuditAction{models.AuditCreate, models.AuditDelete, models.AuditPurge}
+	if got := actions(events); !slices.Equal(got, want) {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+	if purge := events[2]; purge.Actor != "api_key" || purge.After != nil || purge.Before == nil || !purge.Before.Deleted {
+		t.Errorf("purge event = %+v, before %+v", purge, purge.Before)
+	}
+}
+
+func testHistoryNotFound(t *testing.T, repo repository.SubscriptionRepository) {
+	if _, err := repo.GetHistory(context.Background(), 999); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("GetHistory(999) error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testSearchHistory(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	first := create(t, repo, request(alice, "Yandex Plus", 400, "03-2025", "06-2025"))
+	second := create(t, repo, request(alice, "Kinopoisk", 299, "03-2025", "06-2025"))
+	create(t, repo, request(bob, "Yandex Plus", 400, "03-2025", "06-2025"))
+	if _, err := repo.Delete(actor.With(ctx, actor.APIKey), first); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	search := func(filter models.AuditFilter) []models.AuditEvent {
+		t.Helper()
+		events, err := repo.SearchHistory(ctx, filter)
+		if err != nil {
+			t.Fatalf("SearchHistory(%+v): %v", filter, err)
+		}
+		return events
+	}
+
+	all := search(models.AuditFilter{})
+	if len(all) != 4 || all[0].Action != models.AuditDelete || all[0].SubscriptionID != first {
+		t.Fatalf("SearchHistory(all) = %v, want 4 events, the delete first", actions(all))
+	}
+	if got := search(models.AuditFilter{UserID: alice}); len(got) != 3 {
+		t.Errorf("SearchHistory(alice) returned %d events, want 3", len(got))
+	}
+	if got := search(models.AuditFilter{SubscriptionID: second}); len(got) != 1 || got[0].SubscriptionID != second {
+		t.Errorf("SearchHistory(subscription) = %+v", got)
+	}
+	if got := search(models.AuditFilter{Actor: "api_key", Action: models.AuditDelete}); len(got) != 1 || got[0].SubscriptionID != first {
+		t.Errorf("SearchHistory(api_key deletes) = %+v", got)
+	}
+	if got := search(models.AuditFilter{Action: models.AuditCreate, Limit: 2}); len(got) != 2 || got[0].ID < got[1].ID {
+		t.Errorf("SearchHistory(2 creates) = %+v, want the 2 newest", got)
+	}
+	if got := search(models.AuditFilter{From: time.Now().Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("SearchHistory(future) returned %d events", len(got))
+	}
+	if got := search(models.AuditFilter{To: all[len(all)-1].CreatedAt}); len(got) != 0 {
+		t.Errorf("SearchHistory(before the first event) returned %d events", len(got))
+	}
+}
+
+func testGetByUserIDs(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	a1 := create(t, repo, request(alice, "Yandex Plus", 400, "01-2025", ""))
+	a2 := create(t, repo, request(alice, "Kinopoisk", 299, "02-2025", ""))
+	b1 := create(t, repo, request(bob, "Yandex Plus", 400, "01-2025", ""))
+	if _, err := repo.Delete(ctx, a2); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	nobody := uuid.MustParse("00000000-0000-4000-8000-000000000001")
+	got, err := repo.GetByUserIDs(ctx, []uuid.UUID{alice, bob, nobody})
+	if err != nil {
+		t.Fatalf("GetByUserIDs: %v", err)
+	}
+	if ids := responseIDs(got[alice]); !slices.Equal(ids, []uint64{a1}) {
+		t.Errorf("alice IDs = %v, want [%d]", ids, a1)
+	}
+	if ids := responseIDs(got[bob]); !slices.Equal(ids, []uint64{b1}) {
+		t.Errorf("bob IDs = %v, want [%d]", ids, b1)
+	}
+	if _, ok := got[nobody]; ok {
+		t.Errorf("users without subscriptions must be absent, got %v", got[nobody])
+	}
+
+	empty, err := repo.GetByUserIDs(ctx, nil)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("GetByUserIDs(nil) = %v, %v, want an empty map", empty, err)
+	}
+}
+
+func testRenewActive(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	// An active subscription: from this month, for three months
+	start := thisMonth()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, start.Format("01-2006"), start.AddDate(0, 3, 0).Format("01-2006")))
+	old, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	newID, err := repo.RenewOrExtend(ctx, id)
+	if err != nil {
+		t.Fatalf("RenewOrExtend: %v", err)
+	}
+	renewed, err := repo.GetByID(ctx, newID)
+	if err != nil {
+		t.Fatalf("GetByID(renewed): %v", err)
+	}
+
+	if !renewed.StartTime.Equal(old.EndTime) {
+		t.Errorf("renewed start = %s, want the end of the active subscription %s", renewed.StartTime, old.EndTime)
+	}
+	if got, want := renewed.EndTime.Sub(renewed.StartTime), old.EndTime.Sub(old.StartTime); got != want {
+		t.Errorf("renewed duration = %s, want the original %s", got, want)
+	}
+	if renewed.ServiceName != old.ServiceName || renewed.Price != old.Price || renewed.UserID != old.UserID {
+		t.Errorf("renewed = %+v, want the service, price and user of %+v", renewed, old)
+	}
+}
+
+func testRenewExpired(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	id := create(t, repo, request(alice, "Yandex Plus", 400, "01-2020", "03-2020"))
+	old, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	before := time.Now().UTC().Truncate(24 * time.Hour)
+	newID, err := repo.RenewOrExtend(ctx, id)
+	if err != nil {
+		t.Fatalf("RenewOrExtend: %v", err)
+	}
+	after := time.Now().UTC()
+
+	renewed, err := repo.GetByID(ctx, newID)
+	if err != nil {
+		t.Fatalf("GetByID(renewed): %v", err)
+	}
+	// The new subscription starts now (implementations may store the day only)
+	if renewed.StartTime.Before(before) || renewed.StartTime.After(after) {
+		t.Errorf("renewed start = %s, want now (%s..%s)", renewed.StartTime, before, after)
+	}
+	if got, want := renewed.EndTime.Sub(renewed.StartTime), old.EndTime.Sub(old.StartTime); got != want {
+		t.Errorf("renewed duration = %s, want the original %s", got, want)
+	}
+}
+
+func testRenewNotFound(t *testing.T, repo repository.SubscriptionRepository) {
+	if _, err := repo.RenewOrExtend(context.Background(), 4242); !stderrors.Is(err, errors.ErrSubscriptionNotFound) {
+		t.Errorf("RenewOrExtend(unknown) error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func testCost(t *testing.T, repo repository.SubscriptionRepository) {
+	ctx := context.Background()
+	create(t, repo, request(alice, "Yandex Plus", 400, "01-2025", "02-2025"))
+	create(t, repo, request(alice, "Yandex Plus", 450, "02-2025", "04-2025"))
+	create(t, repo, request(alice, "Yandex Plus", 500, "06-2025", "09-2025")) // ends after the range
+	create(t, repo, request(alice, "Kinopoisk", 299, "01-2025", "02-2025"))   // other service
+	create(t, repo, request(bob, "Yandex Plus", 400, "01-2025", "02-2025"))   // other user
+
+	tests := []struct {
+		name     string
+		user     uuid.UUID
+		service  string
+		from, to time.Time
+		want     int
+	}{
+		{"within range", alice, "Yandex Plus", date(2025, time.January), date(2025, time.June), 850},
+		{"bounds inclusive", alice, "Yandex Plus", date(2025, time.February), date(2025, time.April), 450},
+		{"whole year", alice, "Yandex Plus", date(2025, time.January), date(2025, time.December), 1350},
+		{"other service", alice, "Kinopoisk", date(2025, time.January), date(2025, time.December), 299},
+		{"no match", alice, "Spotify", date(2025, time.January), date(2025, time.December), 0},
+		{"empty range", bob, "Yandex Plus", date(2024, time.January), date(2024, time.December), 0},
+	}
+	for _, tt := range tests {
+		got, err := repo.GetCost(ctx, tt.user, tt.service, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("%s: GetCost: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: GetCost = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// responseIDs returns the sorted IDs of subs
+func responseIDs(subs []models.SubscriptionResponse) []uint64 {
+	ids := make([]uint64, 0, len(subs))
+	for _, sub := range subs {
+		ids = append(ids, sub.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func date(year int, month time.Month) time.Time {
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// thisMonth returns the first day of the current month
+func thisMonth() time.Time {
+	now := time.Now().UTC()
+	return date(now.Year(), now.Month())
+}
@@ -0,0 +1,105 @@
+// Package router registers the versioned API routes.
+//
+// Layout:
+//   - /v1/...  the original API (MM-YYYY dates)
+//   - /v2/...  the same endpoints with ISO 8601 dates in responses
+//   - /...     unversioned aliases of /v1, answering with Deprecation and Sunset headers
+//
+// The POST routes honor the Idempotency-Key header when Options.Idempotency is set.
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/handlers"
+	mw "github.com/Joshdike/subscriptions_aggregator/internal/middleware"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// Options holds what the API routes need
+type Options struct {
+	Handler     *handlers.SubscriptionHandler
+	AdminSecret string
+
+	// LegacyDeprecatedAt and LegacySunset are announced on the unversioned aliases
+	LegacyDeprecatedAt time.Time
+	LegacySunset       time.Time
+
+	// Idempotency stores the responses of POST requests sent with an Idempotency-Key header;
+	// without it the header is ignored
+	Idempotency        repository.IdempotencyRepository
+	IdempotencyOptions mw.IdempotencyOptions
+}
+
+// New returns a router serving every API version and the deprecated unversioned aliases
+func New(opts Options) chi.Router {
+	r := chi.NewRouter()
+	admin := mw.AdminSecretMiddleware(opts.AdminSecret)
+	optionalAdmin := mw.OptionalAdminSecretMiddleware(opts.AdminSecret)
+	v2 := handlers.NewV2(opts.Handler)
+	idempotent := func(next http.Handler) http.Handler { return next }
+	if opts.Idempotency != nil {
+		idempotent = mw.IdempotencyMiddleware(opts.Idempotency, opts.IdempotencyOptions)
+	}
+
+	r.Route("/v1", func(r chi.Router) {
+		RegisterV1(r, opts.Handler, admin, optionalAdmin, idempotent)
+	})
+	r.Route("/v2", func(r chi.Router) {
+		RegisterV2(r, v2, admin, optionalAdmin, idempotent)
+	})
+
+	// Unversioned aliases kept for existing clients
+	r.Group(func(r chi.Router) {
+		r.Use(mw.DeprecationMiddleware(opts.LegacyDeprecatedAt, opts.LegacySunset, "/v1"))
+		RegisterV1(r, opts.Handler, admin, optionalAdmin, idempotent)
+	})
+
+	return r
+}
+
+// RegisterV1 defines the v1 routes and their handler functions on r; admin guards the admin
+// routes, optionalAdmin lets admins use the routes open to users with higher limits and
+// idempotent wraps the POST routes
+func RegisterV1(r chi.Router, h *handlers.SubscriptionHandler, admin, optionalAdmin, idempotent func(http.Handler) http.Handler) {
+	r.With(idempotent).Post("/subscriptions", h.CreateSubscription)
+	r.With(optionalAdmin, idempotent).Post("/subscriptions/import", h.ImportSubscriptions)
+	r.Get("/subscriptions/user/{user_id}", h.GetSubscriptionByUserID)
+	r.Get("/subscriptions/{id}", h.GetSubscriptionByID)
+	r.With(idempotent).Post("/subscriptions/{id}", h.RenewOrExtendSubscription)
+	r.Delete("/subscriptions/{id}", h.DeleteSubscription)
+	r.Patch("/subscriptions/{id}", h.PatchSubscription) // merge patch update, or the legacy verb of DELETE
+	r.Get("/subscriptions/user/{user_id}/trash", h.GetDeletedSubscriptionsByUserID)
+	r.With(idempotent).Post("/subscriptions/{id}/restore", h.RestoreSubscription)
+	r.Get("/subscriptions/{id}/history", h.GetSubscriptionHistory)
+
+	r.Get("/costs/{user_id}", h.GetCostByDateRange)
+
+	// Admin routes
+	r.With(admin).Get("/subscriptions", h.GetSubscriptions)
+	r.With(admin).Delete("/subscriptions/{id}/purge", h.PurgeSubscription)
+	r.With(admin).Get("/audit", h.SearchAuditLog)
+}
+
+// RegisterV2 defines the v2 routes and their handler functions on r, like RegisterV1
+func RegisterV2(r chi.Router, h *handlers.V2Handler, admin, optionalAdmin, idempotent func(http.Handler) http.Handler) {
+	r.With(idempotent).Post("/subscriptions", h.CreateSubscription)
+	r.With(optionalAdmin, idempotent).Post("/subscriptions/import", h.ImportSubscriptions)
+	r.Get("/subscriptions/user/{user_id}", h.GetSubscriptionByUserID)
+	r.Get("/subscriptions/{id}", h.GetSubscriptionByID)
+	r.With(idempotent).Post("/subscriptions/{id}", h.RenewOrExtendSubscription)
+	r.Delete("/subscriptions/{id}", h.DeleteSubscription)
+	r.Patch("/subscriptions/{id}", h.UpdateSubscription) // merge patch update only, v2 has no legacy clients
+	r.Get("/subscriptions/user/{user_id}/trash", h.GetDeletedSubscriptionsByUserID)
+	r.With(idempotent).Post("/subscriptions/{id}/restore", h.RestoreSubscription)
+	r.Get("/subscriptions/{id}/history", h.GetSubscriptionHistory)
+
+	r.Get("/costs/{user_id}", h.GetCostByDateRange)
+
+	// Admin routes
+	r.With(admin).Get("/subscriptions", h.GetSubscriptions)
+	r.With(admin).Delete("/subscriptions/{id}/purge", h.PurgeSubscription)
+	r.With(admin).Get("/audit", h.SearchAuditLog)
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/repository"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Repository decorates a SubscriptionRepository, starting a span for every method call
+type Repository struct {
+	next repository.SubscriptionRepository
+}
+
+var _ repository.SubscriptionRepository = (*Repository)(nil)
+
+func NewRepository(next repository.SubscriptionRepository) *Repository {
+	return &Repository{next: next}
+}
+
+// start opens a span named after the repository method
+func (r *Repository) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "SubscriptionRepository."+method, trace.WithAttributes(attrs...))
+}
+
+func (r *Repository) Create(ctx context.Context, sub *models.SubscriptionRequest) (uint64, error) {
+	ctx, span := r.start(ctx, "Create",
+		attribute.String("subscription.user_id", sub.UserID.String()),
+		attribute.String("subscription.service_name", sub.ServiceName),
+	)
+	id, err := r.next.Create(ctx, sub)
+	span.SetAttributes(attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	finish(span, err)
+	return id, err
+}
+
+func (r *Repository) Import(ctx context.Context, rows []models.ImportRow, opts models.ImportOptions) ([]models.ImportOutcome, error) {
+	ctx, span := r.start(ctx, "Import",
+		attribute.Int("import.rows", len(rows)),
+		attribute.String("import.mode", string(opts.Mode)),
+		attribute.Bool("import.dry_run", opts.DryRun),
+		attribute.Bool("import.copy", opts.Copy),
+	)
+	outcomes, err := r.next.Import(ctx, rows, opts)
+	created := 0
+	for _, outcome := range outcomes {
+		if outcome.ID != 0 {
+			created++
+		}
+	}
+	span.SetAttributes(attribute.Int("import.created", created))
+	finish(span, err)
+	return outcomes, err
+}
+
+func (r *Repository) GetAll(ctx context.Context) ([]models.AdminSubscriptionResponse, error) {
+	ctx, span := r.start(ctx, "GetAll")
+	subs, err := r.next.GetAll(ctx)
+	finish(span, err)
+	return subs, err
+}
+
+func (r *Repository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionResponse, error) {
+	ctx, span := r.start(ctx, "GetByUserID", attribute.String("subscription.user_id", userID.String()))
+	subs, err := r.next.GetByUserID(ctx, userID)
+	finish(span, err)
+	return subs, err
+}
+
+func (r *Repository) GetByUserIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]models.SubscriptionResponse, error) {
+	ctx, span := r.start(ctx, "GetByUserIDs", attribute.Int("subscription.user_count", len(userIDs)))
+	subs, err := r.next.GetByUserIDs(ctx, userIDs)
+	finish(span, err)
+	return subs, err
+}
+
+func (r *Repository) GetByID(ctx context.Context, id uint64) (models.SubscriptionResponse, error) {
+	ctx, span := r.start(ctx, "GetByID", attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	sub, err := r.next.GetByID(ctx, id)
+	finish(span, err)
+	return sub, err
+}
+
+func (r *Repository) Delete(ctx context.Context, id uint64) (bool, error) {
+	ctx, span := r.start(ctx, "Delete", attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	deleted, err := r.next.Delete(ctx, id)
+	span.SetAttributes(attribute.Bool("subscription.deleted", deleted))
+	finish(span, err)
+	return deleted, err
+}
+
+func (r *Repository) GetDeletedByUserID(ctx context.Context, userID uuid.UUID) ([]models.DeletedSubscriptionResponse, error) {
+	ctx, span := r.start(ctx, "GetDeletedByUserID", attribute.String("user.id", userID.String()))
+	subs, err := r.next.GetDeletedByUserID(ctx, userID)
+	finish(span, err)
+	return subs, err
+}
+
+func (r *Repository) GetHistory(ctx context.Context, id uint64) ([]models.AuditEvent, error) {
+	ctx, span := r.start(ctx, "GetHistory", attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	events, err := r.next.GetHistory(ctx, id)
+	finish(span, err)
+	return events, err
+}
+
+func (r *Repository) SearchHistory(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	ctx, span := r.start(ctx, "SearchHistory",
+		attribute.String("audit.action", string(filter.Action)),
+		attribute.Int("audit.limit", filter.Limit),
+	)
+	events, err := r.next.SearchHistory(ctx, filter)
+	span.SetAttributes(attribute.Int("audit.events", len(events)))
+	finish(span, err)
+	return events, err
+}
+
+func (r *Repository) Restore(ctx context.Context, id uint64) (bool, error) {
+	ctx, span := r.start(ctx, "Restore", attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	restored, err := r.next.Restore(ctx, id)
+	span.SetAttributes(attribute.Bool("subscription.restored", restored))
+	finish(span, err)
+	return restored, err
+}
+
+func (r *Repository) Purge(ctx context.Context, id uint64) error {
+	ctx, span := r.start(ctx, "Purge", attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	err := r.next.Purge(ctx, id)
+	finish(span, err)
+	return err
+}
+
+func (r *Repository) RenewOrExtend(ctx context.Context, id uint64) (uint64, error) {
+	ctx, span := r.start(ctx, "RenewOrExtend", attribute.String("subscription.id", strconv.FormatUint(id, 10)))
+	newID, err := r.next.RenewOrExtend(ctx, id)
+	span.SetAttributes(attribute.String("subscription.new_id", strconv.FormatUint(newID, 10)))
+	finish(span, err)
+	return newID, err
+}
+
+func (r *Repository) Update(ctx context.Context, id uint64, version int, patch models.SubscriptionPatch) (models.SubscriptionResponse, error) {
+	ctx, span := r.start(ctx, "Update",
+		attribute.String("subscription.id", strconv.FormatUint(id, 10)),
+		attribute.Int("subscription.version", version))
+	sub, err := r.next.Update(ctx, id, version, patch)
+	finish(span, err)
+	return sub, err
+}
+
+func (r *Repository) GetCost(ctx context.Context, userID uuid.UUID, serviceName string, start, end time.Time) (int, error) {
+	ctx, span := r.start(ctx, "GetCost",
+		attribute.String("subscription.user_id", userID.String()),
+		attribute.String("subscription.service_name", serviceName),
+	)
+	total, err := r.next.GetCost(ctx, userID, serviceName, start, end)
+	finish(span, err)
+	return total, err
+}
+
+func (r *Repository) OverlapCheck(ctx context.Context, sub models.Subscription) error {
+	ctx, span := r.start(ctx, "OverlapCheck",
+		attribute.String("subscription.user_id", sub.UserID.String()),
+		attribute.String("subscription.service_name", sub.ServiceName),
+	)
+	err := r.next.OverlapCheck(ctx, sub)
+	finish(span, err)
+	return err
+}
@@ -2,13 +2,16 @@ package utils
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	er "github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
 )
 
 // ParseMonthYear takes a string in the format "MM-YYYY" and returns a time.Time object representing the corresponding month and year.
@@ -25,60 +28,99 @@ func ParseMonthYear(dateStr string) (time.Time, error) {
 	return time.Parse(layout, dateStr)
 }
 
-// ErrorResponse structure
+// ErrorResponse structure, the legacy error format kept for clients accepting only application/json
 // swagger:model ErrorResponse
 type ErrorResponse struct {
 	Error   string      `json:"error"`
-	Details interface{} `json:"details,omitempty"`
+	Details interface{} `json:"details,omitempty"` // a message, or the list of field violations ({field, code, message}) of invalid input
 }
 
-// WriteError writes a structures JSON error response based on the error type
-// 500 Internal Server Error is the default response for unknown errors
-func WriteError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Default error message
-	message := "An error occurred"
-	var status int
-	var details string
+// legacyMessages keeps the English "error" texts of the legacy format where they differ from the problem title
+var legacyMessages = map[string]string{
+	problem.MalformedRequest.Code: "Invalid Request Format",
+	problem.EncodingFailed.Code:   "Failed to process Response",
+	problem.AlreadyExists.Code:    "Validation failed",
+	problem.Internal.Code:         "An error occurred",
+}
 
-	// Unwrap the error to check for known types
-	switch {
-	case errors.Is(err, er.ErrDecodingJSON):
-		message = "Invalid Request Format"
-		status = http.StatusBadRequest
-	case errors.Is(err, er.ErrEncodingJSON):
-		message = "Failed to process Response"
-		status = http.StatusInternalServerError
-	case errors.Is(err, er.ErrInvalidInput):
-		message = "Validation failed"
-		status = http.StatusBadRequest
-		details = err.Error()
-	case errors.Is(err, er.ErrSubscriptionNotFound):
-		message = "No subscription found"
-		status = http.StatusNotFound
+// WriteError writes the error response matching err, as chosen by the problem registry
+// Clients explicitly accepting application/problem+json get RFC 9457 problem details;
+// every other client, including those sending no Accept header, gets the legacy ErrorResponse
+// Every 5xx response is logged together with the full wrapped error chain and the request ID
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	lang := i18n.FromContext(r.Context())
+	p := problem.New(err, logging.RequestIDFromContext(r.Context()), lang)
+	if p.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", p.Status),
+			slog.String("code", p.Code),
+			slog.Any("error_chain", logging.ErrorChain(err)),
+		)
+	}
 
-	case errors.Is(err, er.ErrAlreadyExists):
-		message = "Validation failed"
-		status = http.StatusConflict
-		details = err.Error()
-	case errors.Is(err, er.ErrUnauthorized):
-		status = http.StatusUnauthorized
-		message = err.Error()
-	default:
-		status = http.StatusInternalServerError
-		details = "Internal server error"
+	var body interface{} = p
+	contentType := problem.ContentType
+	if !acceptsProblem(r.Header.Values("Accept")) {
+		body = legacyResponse(p, lang)
+		contentType = "application/json"
 	}
-	w.WriteHeader(status)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(p.Status)
 
 	// Write the error response
-	writeErr := json.NewEncoder(w).Encode(ErrorResponse{
-		Error:   message,
-		Details: details,
-	})
+	writeErr := json.NewEncoder(w).Encode(body)
 	// Handle encoding errors
 	if writeErr != nil {
 		http.Error(w, `{"error": "failed to encode error"}`, http.StatusInternalServerError)
 		return
 	}
 }
+
+// legacyResponse converts p, written in lang, to the legacy error format
+func legacyResponse(p problem.Problem, lang i18n.Lang) ErrorResponse {
+	message, ok := legacyMessages[p.Code]
+	if !ok || lang != i18n.EN {
+		message = p.Title
+	}
+	var details interface{} = p.Detail
+	if p.Errors != nil {
+		details = p.Errors
+	}
+	if p.Code == problem.Unauthorized.Code {
+		// 401 responses carried the error itself as their message
+		return ErrorResponse{Error: p.Detail}
+	}
+	return ErrorResponse{Error: message, Details: details}
+}
+
+// acceptsProblem reports whether the Accept header values explicitly list application/problem+json.
+// Wildcards do not count, so that clients predating problem details keep the legacy format.
+func acceptsProblem(accept []string) bool {
+	for _, value := range accept {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, _ := strings.Cut(mediaRange, ";")
+			if rejected(params) {
+				continue
+			}
+			if strings.EqualFold(strings.TrimSpace(mediaType), problem.ContentType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rejected reports whether the parameters of a media range carry q=0 (not acceptable)
+func rejected(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(name, "q") {
+			q, err := strconv.ParseFloat(value, 64)
+			return err == nil && q == 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/logging"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/Joshdike/subscriptions_aggregator/internal/problem"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"*/*"}, false},
+		{[]string{"application/json"}, false},
+		{[]string{"application/problem+json"}, true},
+		{[]string{"application/problem+json, application/json"}, true},
+		{[]string{"application/json", "application/problem+json;q=0.5"}, true},
+		{[]string{"application/problem+json;q=0, application/json"}, false},
+		{[]string{"text/html, */*;q=0.8"}, false},
+		{[]string{"Application/Problem+JSON"}, true},
+	}
+	for _, tt := range tests {
+		if got := acceptsProblem(tt.accept); got != tt.want {
+			t.Errorf("acceptsProblem(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	err := fmt.Errorf("%w: wait till current subscription ends or extend it", errors.ErrAlreadyExists)
+
+	t.Run("problem", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/subscriptions", nil)
+		r.Header.Set("Accept", problem.ContentType)
+		r = r.WithContext(logging.WithRequestID(r.Context(), "req-42"))
+		w := httptest.NewRecorder()
+		WriteError(w, r, err)
+
+		if w.Code != http.StatusConflict || w.Header().Get("Content-Type") != problem.ContentType {
+			t.Fatalf("got %d %q, want 409 %q", w.Code, w.Header().Get("Content-Type"), problem.ContentType)
+		}
+		var p problem.Problem
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Code != "subscription_already_exists" || p.Instance != "req-42" || p.Detail != err.Error() || p.Type != problem.TypeURI(p.Code) {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	})
+
+	for name, accept := range map[string]string{"legacy": "application/json", "without_accept": ""} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/subscriptions", nil)
+			if accept != "" {
+				r.Header.Set("Accept", accept)
+			}
+			w := httptest.NewRecorder()
+			WriteError(w, r, err)
+
+			want := `{"error":"Validation failed","details":"subscription already exists: wait till current subscription ends or extend it"}` + "\n"
+			if w.Code != http.StatusConflict || w.Header().Get("Content-Type") != "application/json" || w.Body.String() != want {
+				t.Errorf("got %d %q %s, want 409 application/json %s", w.Code, w.Header().Get("Content-Type"), w.Body, want)
+			}
+		})
+	}
+
+	t.Run("legacy_unauthorized", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/subscriptions", nil)
+		w := httptest.NewRecorder()
+		WriteError(w, r, fmt.Errorf("%w: secret-key header is missing or invalid", errors.ErrUnauthorized))
+
+		want := `{"error":"unauthorized: secret-key header is missing or invalid"}` + "\n"
+		if w.Code != http.StatusUnauthorized || w.Body.String() != want {
+			t.Errorf("got %d %s, want 401 %s", w.Code, w.Body, want)
+		}
+	})
+}
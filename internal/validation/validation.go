@@ -0,0 +1,369 @@
+// Package validation checks API input field by field and reports every violation at once.
+//
+// All limits are defined here, next to the database constraints they mirror. A failed validation
+// returns *Error, which wraps errors.ErrInvalidInput and carries the list of violations written
+// in utils.ErrorResponse.Details. Violation messages are English; Error.Localize translates them
+// with the i18n catalog.
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/i18n"
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	"github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// Limits of the accepted values
+const (
+	MaxServiceNameLength = 255       // subscriptions.service_name is VARCHAR(255)
+	MinPrice             = 1         // rubles
+	MaxPrice             = 1_000_000 // rubles; subscriptions.price is INT
+	MinYear              = 2000      // earliest year of a subscription date
+	MaxYear              = 2100      // latest year of a subscription date
+
+	// MonthLayout is the "MM-YYYY" format of subscription dates
+	MonthLayout = "01-2006"
+
+	DefaultAuditLimit = 100  // audit events returned by a search without limit
+	MaxAuditLimit     = 1000 // most audit events returned by a search
+
+	MaxImportRows       = 1000                     // rows of a file imported by a user
+	MaxAdminImportRows  = 100_000                  // rows of a file imported with the admin key
+	CopyImportRows      = 1000                     // admin imports of more rows are written with COPY
+	MaxImportBytes      = MaxImportRows << 10      // bytes of a file imported by a user, 1 KiB per row
+	MaxAdminImportBytes = MaxAdminImportRows << 10 // bytes of a file imported with the admin key
+)
+
+// Violation codes
+const (
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeOutOfRange    = "out_of_range"
+	CodeInvalidFormat = "invalid_format"
+	CodeBeforeStart   = "before_start"
+)
+
+// Violation is a problem with a single field
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	key  i18n.Key // catalog message of Message
+	args []any
+}
+
+// Error lists the violations found in a request
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Field+": "+v.Message)
+	}
+	return fmt.Sprintf("%s: %s", errors.ErrInvalidInput, strings.Join(msgs, "; "))
+}
+
+func (e *Error) Unwrap() error {
+	return errors.ErrInvalidInput
+}
+
+// Localize returns a copy of e with the violation messages translated into lang
+func (e *Error) Localize(lang i18n.Lang) error {
+	localized := &Error{Violations: make([]Violation, len(e.Violations))}
+	for i, v := range e.Violations {
+		if v.key != "" {
+			v.Message = i18n.Translate(lang, v.key, v.args...)
+		}
+		localized.Violations[i] = v
+	}
+	return localized
+}
+
+// Details returns the violations, written as the details of the error response
+func (e *Error) Details() any {
+	return e.Violations
+}
+
+// Validator collects violations
+type Validator struct {
+	violations []Violation
+}
+
+// Add records a violation of field, described by the catalog message key formatted with args
+func (v *Validator) Add(field, code string, key i18n.Key, args ...any) {
+	v.violations = append(v.violations, Violation{
+		Field:   field,
+		Code:    code,
+		Message: i18n.Translate(i18n.EN, key, args...),
+		key:     key,
+		args:    args,
+	})
+}
+
+// Err returns *Error listing the violations, or nil if there are none
+func (v *Validator) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &Error{Violations: v.violations}
+}
+
+// ServiceName checks a required service name against the column length
+func (v *Validator) ServiceName(field, name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		v.Add(field, CodeRequired, i18n.ValidationRequired)
+	case utf8.RuneCountInString(name) > MaxServiceNameLength:
+		v.Add(field, CodeTooLong, i18n.ValidationTooLong, MaxServiceNameLength)
+	}
+}
+
+// Price checks a price in rubles against the price bounds
+func (v *Validator) Price(field string, price int) {
+	if price < MinPrice || price > MaxPrice {
+		v.Add(field, CodeOutOfRange, i18n.ValidationPriceRange, MinPrice, MaxPrice)
+	}
+}
+
+// UserID checks that a parsed user ID is set
+func (v *Validator) UserID(field string, id uuid.UUID) {
+	if id == uuid.Nil {
+		v.Add(field, CodeRequired, i18n.ValidationRequired)
+	}
+}
+
+// ParseUserID parses and checks a user ID given as a UUID string
+func (v *Validator) ParseUserID(field, raw string) uuid.UUID {
+	if raw == "" {
+		v.Add(field, CodeRequired, i18n.ValidationRequired)
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, i18n.ValidationUUID)
+		return uuid.Nil
+	}
+	v.UserID(field, id)
+	return id
+}
+
+// ParseSubscriptionID parses and checks a positive subscription ID
+func (v *Validator) ParseSubscriptionID(field, raw string) uint64 {
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || id == 0 {
+		v.Add(field, CodeInvalidFormat, i18n.ValidationPositiveInteger)
+		return 0
+	}
+	return id
+}
+
+// ParseMonth parses a required "MM-YYYY" month and checks it is within the date window
+func (v *Validator) ParseMonth(field, raw string) (time.Time, bool) {
+	if raw == "" {
+		v.Add(field, CodeRequired, i18n.ValidationRequired)
+		return time.Time{}, false
+	}
+	month, err := time.Parse(MonthLayout, raw)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, i18n.ValidationMonthFormat)
+		return time.Time{}, false
+	}
+	if month.Year() < MinYear || month.Year() > MaxYear {
+		v.Add(field, CodeOutOfRange, i18n.ValidationYearRange, MinYear, MaxYear)
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// ParseTimestamp parses an optional RFC 3339 timestamp, the zero time if raw is empty
+func (v *Validator) ParseTimestamp(field, raw string) (time.Time, bool) {
+	if raw == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		v.Add(field, CodeInvalidFormat, i18n.ValidationTimestamp)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// MonthRange checks that end is not before start, reporting the violation on field
+func (v *Validator) MonthRange(field string, start, end time.Time) {
+	if end.Before(start) {
+		v.Add(field, CodeBeforeStart, i18n.ValidationBeforeStart)
+	}
+}
+
+// SubscriptionRequest validates every field of a creation request
+func SubscriptionRequest(req models.SubscriptionRequest) error {
+	var v Validator
+	v.ServiceName("service_name", req.ServiceName)
+	v.Price("price", req.Price)
+	v.UserID("user_id", req.UserID)
+	v.subscriptionDates(req)
+	return v.Err()
+}
+
+// SubscriptionRecord parses and validates a creation request given as text fields, as in a CSV
+// record: price and user_id are parsed, then every field is checked like SubscriptionRequest
+func SubscriptionRecord(serviceName, price, userID, startDate, endDate string) (models.SubscriptionRequest, error) {
+	var v Validator
+	req := models.SubscriptionRequest{ServiceName: serviceName, StartDate: startDate, EndDate: endDate}
+	v.ServiceName("service_name", req.ServiceName)
+	price = strings.TrimSpace(price)
+	if price == "" {
+		v.Add("price", CodeRequired, i18n.ValidationRequired)
+	} else if parsed, err := strconv.Atoi(price); err != nil {
+		v.Add("price", CodeInvalidFormat, i18n.ValidationPositiveInteger)
+	} else {
+		req.Price = parsed
+		v.Price("price", req.Price)
+	}
+	req.UserID = v.ParseUserID("user_id", strings.TrimSpace(userID))
+	v.subscriptionDates(req)
+	return req, v.Err()
+}
+
+// subscriptionDates checks the required start date and the optional end date of a request
+func (v *Validator) subscriptionDates(req models.SubscriptionRequest) {
+	start, startOK := v.ParseMonth("start_date", req.StartDate)
+	if req.EndDate != "" {
+		end, endOK := v.ParseMonth("end_date", req.EndDate)
+		if startOK && endOK {
+			v.MonthRange("end_date", start, end)
+		}
+	}
+}
+
+// CostQuery holds the validated parameters of a cost request
+type CostQuery struct {
+	UserID      uuid.UUID
+	ServiceName string
+	From, To    time.Time
+}
+
+// ParseCostQuery validates the raw parameters of a cost request
+func ParseCostQuery(userID, serviceName, from, to string) (CostQuery, error) {
+	var v Validator
+	q := CostQuery{ServiceName: serviceName}
+	q.UserID = v.ParseUserID("user_id", userID)
+	v.ServiceName("service_name", serviceName)
+
+	var fromOK, toOK bool
+	q.From, fromOK = v.ParseMonth("from", from)
+	q.To, toOK = v.ParseMonth("to", to)
+	if fromOK && toOK {
+		v.MonthRange("to", q.From, q.To)
+	}
+
+	if err := v.Err(); err != nil {
+		return CostQuery{}, err
+	}
+	return q, nil
+}
+
+// SubscriptionPatch validates the fields set by a merge patch. An empty end date resets it and
+// is valid; the order of the dates is checked again once the patch is applied.
+func SubscriptionPatch(patch models.SubscriptionPatch) error {
+	var v Validator
+	if patch.ServiceName != nil {
+		v.ServiceName("service_name", *patch.ServiceName)
+	}
+	if patch.Price != nil {
+		v.Price("price", *patch.Price)
+	}
+
+	var start, end time.Time
+	var startOK, endOK bool
+	if patch.StartDate != nil {
+		start, startOK = v.ParseMonth("start_date", *patch.StartDate)
+	}
+	if patch.EndDate != nil && *patch.EndDate != "" {
+		end, endOK = v.ParseMonth("end_date", *patch.EndDate)
+	}
+	if startOK && endOK {
+		v.MonthRange("end_date", start, end)
+	}
+	return v.Err()
+}
+
+// ParseAuditQuery validates the parameters of an audit log search: subscription_id, user_id,
+// actor, action, from and to (RFC 3339, to excluded) and limit. Missing parameters match every
+// event; the limit defaults to DefaultAuditLimit.
+func ParseAuditQuery(query url.Values) (models.AuditFilter, error) {
+	var v Validator
+	filter := models.AuditFilter{Actor: query.Get("actor"), Limit: DefaultAuditLimit}
+	if raw := query.Get("subscription_id"); raw != "" {
+		filter.SubscriptionID = v.ParseSubscriptionID("subscription_id", raw)
+	}
+	if raw := query.Get("user_id"); raw != "" {
+		filter.UserID = v.ParseUserID("user_id", raw)
+	}
+	if raw := query.Get("action"); raw != "" {
+		filter.Action = models.AuditAction(raw)
+		if !slices.Contains(models.AuditActions, filter.Action) {
+			names := make([]string, 0, len(models.AuditActions))
+			for _, action := range models.AuditActions {
+				names = append(names, string(action))
+			}
+			v.Add("action", CodeInvalidFormat, i18n.ValidationOneOf, strings.Join(names, ", "))
+		}
+	}
+
+	var fromOK, toOK bool
+	filter.From, fromOK = v.ParseTimestamp("from", query.Get("from"))
+	filter.To, toOK = v.ParseTimestamp("to", query.Get("to"))
+	if fromOK && toOK && !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		v.Add("to", CodeBeforeStart, i18n.ValidationBeforeStart)
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxAuditLimit {
+			v.Add("limit", CodeOutOfRange, i18n.ValidationIntRange, 1, MaxAuditLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if err := v.Err(); err != nil {
+		return models.AuditFilter{}, err
+	}
+	return filter, nil
+}
+
+// ParseImportQuery validates the parameters of an import: mode (all_or_nothing by default, or
+// best_effort) and dry_run (a boolean)
+func ParseImportQuery(query url.Values) (models.ImportOptions, error) {
+	var v Validator
+	opts := models.ImportOptions{Mode: models.ImportAllOrNothing}
+	if raw := query.Get("mode"); raw != "" {
+		opts.Mode = models.ImportMode(raw)
+		if opts.Mode != models.ImportAllOrNothing && opts.Mode != models.ImportBestEffort {
+			v.Add("mode", CodeInvalidFormat, i18n.ValidationOneOf, strings.Join([]string{string(models.ImportAllOrNothing), string(models.ImportBestEffort)}, ", "))
+		}
+	}
+	if raw := query.Get("dry_run"); raw != "" {
+		dryRun, err := strconv.ParseBool(raw)
+		if err != nil {
+			v.Add("dry_run", CodeInvalidFormat, i18n.ValidationOneOf, "true, false")
+		}
+		opts.DryRun = dryRun
+	}
+
+	if err := v.Err(); err != nil {
+		return models.ImportOptions{}, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,248 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Joshdike/subscriptions_aggregator/internal/models"
+	er "github.com/Joshdike/subscriptions_aggregator/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestSubscriptionRequest(t *testing.T) {
+	valid := models.SubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: uuid.New(), StartDate: "01-2025", EndDate: "03-2025"}
+
+	tests := []struct {
+		name   string
+		modify func(*models.SubscriptionRequest)
+		want   []Violation // only field and code are compared
+	}{
+		{"valid", func(*models.SubscriptionRequest) {}, nil},
+		{"valid without end date", func(r *models.SubscriptionRequest) { r.EndDate = "" }, nil},
+		{"every field invalid", func(r *models.SubscriptionRequest) {
+			*r = models.SubscriptionRequest{ServiceName: " ", Price: 0, StartDate: "13-2025", EndDate: "01-3000"}
+		}, []Violation{
+			{Field: "service_name", Code: CodeRequired},
+			{Field: "price", Code: CodeOutOfRange},
+			{Field: "user_id", Code: CodeRequired},
+			{Field: "start_date", Code: CodeInvalidFormat},
+			{Field: "end_date", Code: CodeOutOfRange},
+		}},
+		{"service name too long", func(r *models.SubscriptionRequest) { r.ServiceName = strings.Repeat("я", MaxServiceNameLength+1) },
+			[]Violation{{Field: "service_name", Code: CodeTooLong}}},
+		{"service name at the limit", func(r *models.SubscriptionRequest) { r.ServiceName = strings.Repeat("я", MaxServiceNameLength) }, nil},
+		{"price too high", func(r *models.SubscriptionRequest) { r.Price = MaxPrice + 1 },
+			[]Violation{{Field: "price", Code: CodeOutOfRange}}},
+		{"missing start date", func(r *models.SubscriptionRequest) { r.StartDate = "" },
+			[]Violation{{Field: "start_date", Code: CodeRequired}}},
+		{"year before the window", func(r *models.SubscriptionRequest) { r.StartDate = "01-1999" },
+			[]Violation{{Field: "start_date", Code: CodeOutOfRange}}},
+		{"end before start", func(r *models.SubscriptionRequest) { r.EndDate = "12-2024" },
+			[]Violation{{Field: "end_date", Code: CodeBeforeStart}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+
+			err := SubscriptionRequest(req)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr *Error
+			if !errors.As(err, &verr) || !errors.Is(err, er.ErrInvalidInput) {
+				t.Fatalf("error = %v, want *Error wrapping ErrInvalidInput", err)
+			}
+			if len(verr.Violations) != len(tt.want) {
+				t.Fatalf("violations = %+v, want %+v", verr.Violations, tt.want)
+			}
+			for i, v := range verr.Violations {
+				if v.Field != tt.want[i].Field || v.Code != tt.want[i].Code || v.Message == "" {
+					t.Errorf("violation %d = %+v, want field %q code %q", i, v, tt.want[i].Field, tt.want[i].Code)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  []Violation // only field and code are compared
+	}{
+		{"empty", `{}`, nil},
+		{"price", `{"price": 450}`, nil},
+		{"every field", `{"service_name": "Kinopoisk", "price": 299, "start_date": "02-2025", "end_date": "05-2025"}`, nil},
+		{"end date reset", `{"end_date": null}`, nil},
+		{"cleared fields", `{"service_name": null, "price": null, "start_date": null}`, []Violation{
+			{Field: "service_name", Code: CodeRequired},
+			{Field: "price", Code: CodeOutOfRange},
+			{Field: "start_date", Code: CodeRequired},
+		}},
+		{"invalid values", `{"price": 0, "end_date": "2025-05"}`, []Violation{
+			{Field: "price", Code: CodeOutOfRange},
+			{Field: "end_date", Code: CodeInvalidFormat},
+		}},
+		{"end before start", `{"start_date": "05-2025", "end_date": "02-2025"}`,
+			[]Violation{{Field: "end_date", Code: CodeBeforeStart}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch models.SubscriptionPatch
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+
+			err := SubscriptionPatch(patch)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr *Error
+			if !errors.As(err, &verr) || len(verr.Violations) != len(tt.want) {
+				t.Fatalf("error = %v, want violations %+v", err, tt.want)
+			}
+			for i, v := range verr.Violations {
+				if v.Field != tt.want[i].Field || v.Code != tt.want[i].Code {
+					t.Errorf("violation %d = %+v, want field %q code %q", i, v, tt.want[i].Field, tt.want[i].Code)
+				}
+			}
+		})
+	}
+
+	for _, doc := range []string{`{"user_id": "6f1c8b2e-4a7d-4e21-9c33-2b5d8e9f0a11"}`, `{"price": "450"}`, `[]`} {
+		var patch models.SubscriptionPatch
+		if err := json.Unmarshal([]byte(doc), &patch); err == nil {
+			t.Errorf("decoding %s succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestParseCostQuery(t *testing.T) {
+	user := uuid.New()
+
+	q, err := ParseCostQuery(user.String(), "Netflix", "01-2025", "12-2025")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.UserID != user || q.ServiceName != "Netflix" || q.From.Month() != 1 || q.To.Month() != 12 {
+		t.Errorf("query = %+v", q)
+	}
+
+	_, err = ParseCostQuery("not-a-uuid", "", "12-2025", "01-2025")
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	var fields []string
+	for _, v := range verr.Violations {
+		fields = append(fields, v.Field+":"+v.Code)
+	}
+	if got, want := strings.Join(fields, ","), "user_id:invalid_format,service_name:required,to:before_start"; got != want {
+		t.Errorf("violations = %s, want %s", got, want)
+	}
+}
+
+func TestParseAuditQuery(t *testing.T) {
+	user := uuid.New()
+
+	filter, err := ParseAuditQuery(url.Values{})
+	if err != nil || filter != (models.AuditFilter{Limit: DefaultAuditLimit}) {
+		t.Errorf("ParseAuditQuery(no parameters) = %+v, %v; want every event up to the default limit", filter, err)
+	}
+
+	filter, err = ParseAuditQuery(url.Values{
+		"subscription_id": {"7"}, "user_id": {user.String()}, "actor": {"api_key"}, "action": {"delete"},
+		"from": {"2025-07-01T00:00:00Z"}, "to": {"2025-08-01T00:00:00+03:00"}, "limit": {"20"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter.SubscriptionID != 7 || filter.UserID != user || filter.Actor != "api_key" || filter.Action != models.AuditDelete ||
+		filter.From.Month() != time.July || filter.To.UTC().Month() != time.July || filter.Limit != 20 {
+		t.Errorf("filter = %+v", filter)
+	}
+
+	_, err = ParseAuditQuery(url.Values{
+		"subscription_id": {"0"}, "user_id": {"not-a-uuid"}, "action": {"edit"},
+		"from": {"2025-08-01T00:00:00Z"}, "to": {"2025-07-01T00:00:00Z"}, "limit": {"1001"},
+	})
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	var fields []string
+	for _, v := range verr.Violations {
+		fields = append(fields, v.Field+":"+v.Code)
+	}
+	want := "subscription_id:invalid_format,user_id:invalid_format,action:invalid_format,to:before_start,limit:out_of_range"
+	if got := strings.Join(fields, ","); got != want {
+		t.Errorf("violations = %s, want %s", got, want)
+	}
+
+	if _, err := ParseAuditQuery(url.Values{"from": {"07-2025"}}); !errors.As(err, &verr) || verr.Violations[0].Code != CodeInvalidFormat {
+		t.Errorf("ParseAuditQuery(from=07-2025) error = %v, want an invalid_format violation", err)
+	}
+}
+
+func TestSubscriptionRecord(t *testing.T) {
+	user := uuid.New()
+
+	req, err := SubscriptionRecord("Yandex Plus", " 400 ", user.String(), "01-2025", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (models.SubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: user, StartDate: "01-2025"}); req != want {
+		t.Errorf("request = %+v, want %+v", req, want)
+	}
+
+	_, err = SubscriptionRecord("", "four hundred", "not-a-uuid", "01-2025", "12-2024")
+	var verr *Error
+	if !errors.As(err, &verr) || !errors.Is(err, er.ErrInvalidInput) {
+		t.Fatalf("error = %v, want *Error wrapping ErrInvalidInput", err)
+	}
+	var fields []string
+	for _, v := range verr.Violations {
+		fields = append(fields, v.Field+":"+v.Code)
+	}
+	if got, want := strings.Join(fields, ","), "service_name:required,price:invalid_format,user_id:invalid_format,end_date:before_start"; got != want {
+		t.Errorf("violations = %s, want %s", got, want)
+	}
+}
+
+func TestParseImportQuery(t *testing.T) {
+	opts, err := ParseImportQuery(url.Values{})
+	if err != nil || opts != (models.ImportOptions{Mode: models.ImportAllOrNothing}) {
+		t.Errorf("ParseImportQuery(no parameters) = %+v, %v; want an all-or-nothing import", opts, err)
+	}
+
+	opts, err = ParseImportQuery(url.Values{"mode": {"best_effort"}, "dry_run": {"true"}})
+	if err != nil || opts != (models.ImportOptions{Mode: models.ImportBestEffort, DryRun: true}) {
+		t.Errorf("ParseImportQuery(best_effort, dry run) = %+v, %v", opts, err)
+	}
+
+	_, err = ParseImportQuery(url.Values{"mode": {"some"}, "dry_run": {"maybe"}})
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	var fields []string
+	for _, v := range verr.Violations {
+		fields = append(fields, v.Field+":"+v.Code)
+	}
+	if got, want := strings.Join(fields, ","), "mode:invalid_format,dry_run:invalid_format"; got != want {
+		t.Errorf("violations = %s, want %s", got, want)
+	}
+}
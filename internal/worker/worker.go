@@ -0,0 +1,92 @@
+// Package worker runs background jobs tied to the lifetime of the process.
+//
+// Jobs are started with the application context; on shutdown that context is canceled and
+// Wait blocks until every job has returned or the shutdown deadline expires.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Func is a background job. It must return promptly once ctx is canceled.
+type Func func(ctx context.Context) error
+
+// Group tracks running background jobs
+type Group struct {
+	logger *slog.Logger
+	wg     sync.WaitGroup
+}
+
+func NewGroup(logger *slog.Logger) *Group {
+	return &Group{logger: logger}
+}
+
+// Job is a handle on a started background job, reporting whether it is still running
+type Job struct {
+	running atomic.Bool
+}
+
+// Running reports whether the job has not returned yet (used by the readiness check)
+func (j *Job) Running() bool {
+	return j.running.Load()
+}
+
+// Go starts fn in its own goroutine. A job returning before ctx is canceled is logged as an error.
+func (g *Group) Go(ctx context.Context, name string, fn Func) *Job {
+	job := &Job{}
+	job.running.Store(true)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer job.running.Store(false)
+
+		err := fn(ctx)
+		if ctx.Err() == nil {
+			g.logger.Error("background job stopped unexpectedly", slog.String("job", name), slog.Any("error", err))
+			return
+		}
+		g.logger.Info("background job stopped", slog.String("job", name))
+	}()
+	return job
+}
+
+// Every starts a job calling fn every interval until ctx is canceled. Errors returned by fn are
+// logged and do not stop the job.
+func (g *Group) Every(ctx context.Context, name string, interval time.Duration, fn Func) *Job {
+	return g.Go(ctx, name, func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+				if err := fn(ctx); err != nil {
+					g.logger.ErrorContext(ctx, "background job run failed", slog.String("job", name), slog.Any("error", err))
+				}
+			}
+		}
+	})
+}
+
+// Wait blocks until every job has returned, or returns an error once ctx expires
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for background jobs: %w", ctx.Err())
+	}
+}
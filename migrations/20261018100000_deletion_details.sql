@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE subscriptions
+    ADD COLUMN deleted_at TIMESTAMPTZ,
+    ADD COLUMN deleted_by TEXT;
+-- Rows deleted before this migration keep an unknown author; their deletion time starts now
+UPDATE subscriptions SET deleted_at = NOW() WHERE deleted;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE subscriptions
+    DROP COLUMN deleted_at,
+    DROP COLUMN deleted_by;
+-- +goose StatementEnd
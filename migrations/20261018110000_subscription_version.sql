@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Incremented on every change of the row, sent as the ETag of the subscription
+ALTER TABLE subscriptions
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE subscriptions
+    DROP COLUMN version;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Append-only log of the changes of subscriptions. Rows are kept when their subscription is purged,
+-- hence no foreign key.
+CREATE TABLE IF NOT EXISTS subscription_audit (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT NOT NULL,
+    user_id UUID NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'renew', 'update', 'delete', 'restore', 'purge')),
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS subscription_audit_subscription_id_idx ON subscription_audit (subscription_id, id);
+CREATE INDEX IF NOT EXISTS subscription_audit_user_id_idx ON subscription_audit (user_id, id);
+CREATE INDEX IF NOT EXISTS subscription_audit_created_at_idx ON subscription_audit (created_at);
+
+CREATE OR REPLACE FUNCTION subscription_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'subscription_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER subscription_audit_append_only
+    BEFORE UPDATE OR DELETE ON subscription_audit
+    FOR EACH ROW EXECUTE FUNCTION subscription_audit_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS subscription_audit;
+DROP FUNCTION IF EXISTS subscription_audit_append_only();
+-- +goose StatementEnd